@@ -1,5 +1,18 @@
 package athenadriver
 
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
 // QIDMetaData is the meta data for QID
 type QIDMetaData struct {
 	QID         string
@@ -18,3 +31,254 @@ type AthenaCache interface {
 	// GetQuery is to get query string from cache by QID
 	GetQuery(QID string) string
 }
+
+// ResultCache maps a query to the ID of a finished execution of the same query, so the result of a repeated
+// query is read from the output bucket of Athena instead of running the query again.
+// The key is built by the driver from the normalized query text, database, workgroup and parameters.
+// A ResultCache must be safe for concurrent use.
+type ResultCache interface {
+	// Get returns the query ID cached for key, and false if there is none or it has expired.
+	Get(key string) (string, bool)
+
+	// Set caches queryID for key.
+	Set(key string, queryID string)
+
+	// Delete removes key from the cache, e.g. when the result of the cached query ID can't be read anymore.
+	Delete(key string)
+}
+
+// memoryResultCacheEntry is an entry of MemoryResultCache.
+type memoryResultCacheEntry struct {
+	key     string
+	queryID string
+	expires time.Time
+}
+
+// MemoryResultCache is an in-memory ResultCache, which evicts the least recently used entry when it is full.
+type MemoryResultCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+// NewMemoryResultCache is to create a MemoryResultCache holding up to capacity entries for ttl each.
+// The entries never expire if ttl is not positive.
+func NewMemoryResultCache(capacity int, ttl time.Duration) *MemoryResultCache {
+	if capacity <= 0 {
+		capacity = DefaultResultCacheSize
+	}
+	return &MemoryResultCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the query ID cached for key.
+func (m *MemoryResultCache) Get(key string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*memoryResultCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		m.lru.Remove(e)
+		delete(m.entries, key)
+		return "", false
+	}
+	m.lru.MoveToFront(e)
+	return entry.queryID, true
+}
+
+// Set caches queryID for key.
+func (m *MemoryResultCache) Set(key string, queryID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expires time.Time
+	if m.ttl > 0 {
+		expires = time.Now().Add(m.ttl)
+	}
+	if e, ok := m.entries[key]; ok {
+		entry := e.Value.(*memoryResultCacheEntry)
+		entry.queryID = queryID
+		entry.expires = expires
+		m.lru.MoveToFront(e)
+		return
+	}
+	m.entries[key] = m.lru.PushFront(&memoryResultCacheEntry{
+		key:     key,
+		queryID: queryID,
+		expires: expires,
+	})
+	for m.lru.Len() > m.capacity {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryResultCacheEntry).key)
+	}
+}
+
+// Delete removes key from the cache.
+func (m *MemoryResultCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.lru.Remove(e)
+		delete(m.entries, key)
+	}
+}
+
+// Len returns the number of entries in the cache, including the expired ones not evicted yet.
+func (m *MemoryResultCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// FileResultCache is a ResultCache in a local directory, with a file per entry.
+// It can be shared by the processes on the same host, and survives restarts.
+type FileResultCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewFileResultCache is to create a FileResultCache in dir, which is created if it doesn't exist.
+// The entries never expire if ttl is not positive.
+func NewFileResultCache(dir string, ttl time.Duration) (*FileResultCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileResultCache{
+		dir: dir,
+		ttl: ttl,
+	}, nil
+}
+
+// path is to get the file of key. The key is hashed, so it is always a valid file name.
+func (f *FileResultCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the query ID cached for key. The age of an entry is the modification time of its file.
+func (f *FileResultCache) Get(key string) (string, bool) {
+	p := f.path(key)
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", false
+	}
+	if f.ttl > 0 && time.Since(info.ModTime()) > f.ttl {
+		_ = os.Remove(p)
+		return "", false
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil || len(b) == 0 {
+		return "", false
+	}
+	return string(b), true
+}
+
+// Set caches queryID for key. The file is written to a temporary file first and renamed,
+// so a concurrent Get never reads a partial query ID.
+func (f *FileResultCache) Set(key string, queryID string) {
+	tmp, err := ioutil.TempFile(f.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.WriteString(queryID)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	if err = os.Rename(tmp.Name(), f.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// Delete removes key from the cache.
+func (f *FileResultCache) Delete(key string) {
+	_ = os.Remove(f.path(key))
+}
+
+var _ ResultCache = (*MemoryResultCache)(nil)
+var _ ResultCache = (*FileResultCache)(nil)
+
+// nonDeterministicPattern matches the functions whose value changes from one run of a query to another.
+var nonDeterministicPattern = regexp.MustCompile(`(?i)\b(now|rand|random|uuid|shuffle|current_timestamp|` +
+	`current_date|current_time|localtime|localtimestamp|current_timezone)\b`)
+
+// isCacheableQuery is to check if the result of query can be served from a ResultCache.
+// Write statements and queries calling non-deterministic functions are never cached.
+func isCacheableQuery(query string) bool {
+	if !isReadOnlyStatement(query) || IsQID(query) {
+		return false
+	}
+	for _, t := range lexSQL(query) {
+		if t.kind == sqlCode && nonDeterministicPattern.MatchString(query[t.start:t.end]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeQuery is to turn the equivalent forms of a query into the same text: comments are removed,
+// whitespace is collapsed, and everything outside string literals and quoted identifiers is lower-cased.
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	space := false
+	for _, t := range lexSQL(query) {
+		switch t.kind {
+		case sqlLineComment, sqlBlockComment:
+			space = true
+		case sqlString, sqlQuotedIdentifier:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteString(query[t.start:t.end])
+		default:
+			for i := t.start; i < t.end; i++ {
+				ch := query[i]
+				if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+					space = true
+					continue
+				}
+				if space && b.Len() > 0 {
+					b.WriteByte(' ')
+				}
+				space = false
+				if ch >= 'A' && ch <= 'Z' {
+					ch += 'a' - 'A'
+				}
+				b.WriteByte(ch)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "; ")
+}
+
+// resultCacheKey is to build the ResultCache key of a query run in database db and workgroup wg
+// with the execution parameters params.
+func resultCacheKey(query string, db string, wg string, params []*string) string {
+	var b strings.Builder
+	b.WriteString(normalizeQuery(query))
+	b.WriteByte(0)
+	b.WriteString(db)
+	b.WriteByte(0)
+	b.WriteString(wg)
+	for _, p := range params {
+		b.WriteByte(0)
+		if p != nil {
+			b.WriteString(*p)
+		}
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
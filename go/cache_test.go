@@ -0,0 +1,208 @@
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestMemoryResultCache(t *testing.T) {
+	c := NewMemoryResultCache(2, 0)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("a", "qid-a")
+	c.Set("b", "qid-b")
+	qid, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "qid-a", qid)
+
+	// b is the least recently used
+	c.Set("c", "qid-c")
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+
+	c.Set("a", "qid-a2")
+	qid, _ = c.Get("a")
+	assert.Equal(t, "qid-a2", qid)
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	c.Delete("a")
+	assert.Equal(t, 1, c.Len())
+
+	assert.Equal(t, DefaultResultCacheSize, NewMemoryResultCache(0, 0).capacity)
+}
+
+func TestMemoryResultCache_TTL(t *testing.T) {
+	c := NewMemoryResultCache(10, time.Millisecond)
+	c.Set("a", "qid-a")
+	time.Sleep(5 * time.Millisecond)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestFileResultCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "athenadriver-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := NewFileResultCache(dir, time.Hour)
+	assert.Nil(t, err)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	c.Set("a", "qid-a")
+	qid, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "qid-a", qid)
+
+	// another cache in the same directory sees the entry
+	c2, err := NewFileResultCache(dir, time.Hour)
+	assert.Nil(t, err)
+	qid, ok = c2.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "qid-a", qid)
+
+	c.Delete("a")
+	_, ok = c2.Get("a")
+	assert.False(t, ok)
+
+	c.Set("b", "qid-b")
+	old := time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, os.Chtimes(c.path("b"), old, old))
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, err = os.Stat(c.path("b"))
+	assert.True(t, os.IsNotExist(err))
+
+	f, err := ioutil.TempFile(dir, "file")
+	assert.Nil(t, err)
+	f.Close()
+	_, err = NewFileResultCache(f.Name(), time.Hour)
+	assert.NotNil(t, err)
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, "select * from t where a = 'Hello  World'",
+		normalizeQuery("SELECT *\n  FROM t -- all rows\n WHERE a = 'Hello  World';"))
+	assert.Equal(t, `select "MyCol" from t where b = 'it''s'`,
+		normalizeQuery(`select /* c */ "MyCol"   from T where B = 'it''s'`))
+	assert.Equal(t, "select 'unterminated", normalizeQuery("select 'unterminated"))
+	assert.Equal(t, "select 1", normalizeQuery("select 1 /* unterminated"))
+}
+
+func TestIsCacheableQuery(t *testing.T) {
+	assert.True(t, isCacheableQuery("SELECT * FROM t"))
+	assert.True(t, isCacheableQuery("WITH x AS (SELECT 1) SELECT * FROM x"))
+	assert.True(t, isCacheableQuery("SELECT 'now()' FROM t"))
+	assert.False(t, isCacheableQuery("SELECT now()"))
+	assert.False(t, isCacheableQuery("SELECT * FROM t WHERE d = CURRENT_DATE"))
+	assert.False(t, isCacheableQuery("SELECT RAND() FROM t"))
+	assert.False(t, isCacheableQuery("INSERT INTO t VALUES (1)"))
+	assert.False(t, isCacheableQuery("DROP TABLE t"))
+	assert.False(t, isCacheableQuery("00000000-0000-0000-0000-000000000000"))
+}
+
+func TestResultCacheKey(t *testing.T) {
+	k := resultCacheKey("SELECT * FROM t", "db", "wg", nil)
+	assert.Equal(t, k, resultCacheKey("select *  from t;", "db", "wg", nil))
+	assert.NotEqual(t, k, resultCacheKey("SELECT * FROM t", "db2", "wg", nil))
+	assert.NotEqual(t, k, resultCacheKey("SELECT * FROM t", "db", "wg2", nil))
+	assert.NotEqual(t, resultCacheKey("SELECT * FROM t WHERE a = ?", "db", "wg", []*string{aws.String("1")}),
+		resultCacheKey("SELECT * FROM t WHERE a = ?", "db", "wg", []*string{aws.String("2")}))
+}
+
+func TestConnection_QueryContext_ResultCache(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	c.connector.config.SetMetrics(true)
+	scope := tally.NewTestScope("", nil)
+	c.connector.tracer = NewObservability(c.connector.config, zap.NewNop(), scope)
+	c.connector.SetResultCache(NewMemoryResultCache(10, time.Hour))
+
+	for i := 0; i < 3; i++ {
+		rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+		assert.Nil(t, err)
+		assert.NotNil(t, rows)
+	}
+	assert.Equal(t, 1, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(1), counters[DriverName+".resultcache.miss+"].Value())
+	assert.Equal(t, int64(2), counters[DriverName+".resultcache.hit+"].Value())
+
+	// a cached query ID whose result can't be read
+	key := resultCacheKey("SELECTQueryContext_OK", c.connector.config.GetDB(), "primary", []*string{})
+	c.connector.cache.Set(key, "c89088ab-595d-4ee6-a9ce-73b55aeb8111")
+	rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, 2, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+
+	// write statements bypass the cache
+	_, err = c.QueryContext(context.Background(), "StartQueryExecution_nil_error", []driver.NamedValue{})
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(2), scope.Snapshot().Counters()[DriverName+".resultcache.miss+"].Value())
+}
+
+func TestSQLConnector_ResultCache(t *testing.T) {
+	config := NewNoOpsConfig()
+	assert.Nil(t, NewSQLConnector(config).resultCache())
+
+	config.SetResultCache("memory")
+	config.SetResultCacheSize(5)
+	cache := NewSQLConnector(config).resultCache()
+	assert.Equal(t, 5, cache.(*MemoryResultCache).capacity)
+
+	dir, err := ioutil.TempDir("", "athenadriver-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	config.SetResultCache("file")
+	config.SetResultCacheDir(dir)
+	cache = NewSQLConnector(config).resultCache()
+	assert.Equal(t, dir, cache.(*FileResultCache).dir)
+
+	config.SetResultCacheDir("/dev/null/athenadriver")
+	assert.Nil(t, NewSQLConnector(config).resultCache())
+	config.SetResultCache("redis")
+	assert.Nil(t, NewSQLConnector(config).resultCache())
+
+	connector := NewSQLConnector(config)
+	connector.SetResultCache(NewMemoryResultCache(1, 0))
+	assert.NotNil(t, connector.resultCache())
+	connector.SetResultCache(nil)
+	assert.Nil(t, connector.resultCache())
+}
+
+func TestSQLConnector_SetResultCache_Concurrent(t *testing.T) {
+	config := NewNoOpsConfig()
+	config.SetResultCache("memory")
+	connector := NewSQLConnector(config)
+	cache := NewMemoryResultCache(1, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			connector.SetResultCache(cache)
+		}()
+		go func() {
+			defer wg.Done()
+			connector.resultCache()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, cache, connector.resultCache())
+}
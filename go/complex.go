@@ -0,0 +1,786 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// This file decodes the text rendering of ARRAY, MAP and ROW values returned by GetQueryResults, e.g.
+//
+//	[1, 2, 3]                  ARRAY(INTEGER)
+//	{a=1, b=null}              MAP(VARCHAR, INTEGER)
+//	{x=1, y=[foo, bar]}        ROW(x INTEGER, y ARRAY(VARCHAR))
+//
+// Strings aren't quoted in the rendering, so separators are ambiguous if strings contain `, ` or `=`. The type
+// signature of a column resolves most of them: the field names of a ROW delimit its values, and the keys of a MAP
+// must be valid keys of its type. A string element `null` can't be told apart from NULL, though.
+
+// RowValue is a decoded ROW value, its fields in order.
+type RowValue []RowField
+
+// RowField is a field of a ROW value.
+type RowField struct {
+	Name  string
+	Value interface{}
+}
+
+// Get returns the value of a field by name. Names are case insensitive, like in Athena.
+func (r RowValue) Get(name string) (interface{}, bool) {
+	for _, f := range r {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// typeSignature is a parsed Athena type like array(row(a integer, b decimal(10, 2))).
+type typeSignature struct {
+	name string
+	// params are the element type of an array, the key and value types of a map, and the field types of a row.
+	params []*typeSignature
+	// fields are the field names of a row.
+	fields    []string
+	precision int64
+	scale     int64
+}
+
+// hiveTypeNames are the Hive names of types used in DDL, e.g. array<int>, which Athena has different names for.
+var hiveTypeNames = map[string]string{
+	"int":    "integer",
+	"struct": "row",
+}
+
+// parseTypeSignature parses a type in Athena's syntax, e.g. map(varchar, array(integer)), or Hive's syntax,
+// e.g. map<string,array<int>>.
+func parseTypeSignature(s string) (*typeSignature, error) {
+	p := &signatureParser{s: s}
+	sig, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpaces(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return sig, nil
+}
+
+// athenaTypeName returns the name of a type without its parameters, e.g. decimal for decimal(10, 2),
+// timestamp with time zone for timestamp(3) with time zone.
+func athenaTypeName(athenaType string) string {
+	if !strings.ContainsAny(athenaType, "(<") {
+		return athenaType
+	}
+	if sig, err := parseTypeSignature(athenaType); err == nil {
+		return sig.name
+	}
+	return athenaType
+}
+
+// isComplex is to check if the values of the type are decoded from their text rendering.
+func (t *typeSignature) isComplex() bool {
+	return t == nil || t.name == "array" || t.name == "map" || t.name == "row"
+}
+
+type signatureParser struct {
+	s   string
+	pos int
+}
+
+func (p *signatureParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format+" in %q", append([]interface{}{ErrComplexType}, append(args, p.s)...)...)
+}
+
+func (p *signatureParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// words reads a type name, which can be several words, e.g. interval day to second.
+func (p *signatureParser) words() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(`(<,)>:"`, rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return strings.Join(strings.Fields(strings.ToLower(p.s[start:p.pos])), " ")
+}
+
+// identifier reads a field name, which is quoted with double quotes if it isn't a plain word.
+func (p *signatureParser) identifier() (string, error) {
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		var name strings.Builder
+		for p.pos++; p.pos < len(p.s); p.pos++ {
+			if p.s[p.pos] == '"' {
+				if p.pos+1 < len(p.s) && p.s[p.pos+1] == '"' {
+					p.pos++
+				} else {
+					p.pos++
+					return name.String(), nil
+				}
+			}
+			name.WriteByte(p.s[p.pos])
+		}
+		return "", p.errorf("unterminated field name")
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(` (<,)>:"`, rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *signatureParser) expect(c byte) error {
+	if p.skipSpaces(); p.pos >= len(p.s) || p.s[p.pos] != c {
+		return p.errorf("%q expected", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *signatureParser) parse() (*typeSignature, error) {
+	p.skipSpaces()
+	name := p.words()
+	if name == "" {
+		return nil, p.errorf("type expected")
+	}
+	if hiveName, ok := hiveTypeNames[name]; ok {
+		name = hiveName
+	}
+	sig := &typeSignature{name: name}
+	if p.pos >= len(p.s) || (p.s[p.pos] != '(' && p.s[p.pos] != '<') {
+		return sig, nil
+	}
+	closing := byte(')')
+	if p.s[p.pos] == '<' {
+		closing = '>'
+	}
+	p.pos++
+	var err error
+	switch name {
+	case "array":
+		var elem *typeSignature
+		if elem, err = p.parse(); err != nil {
+			return nil, err
+		}
+		sig.params = []*typeSignature{elem}
+	case "map":
+		var key, value *typeSignature
+		if key, err = p.parse(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(','); err != nil {
+			return nil, err
+		}
+		if value, err = p.parse(); err != nil {
+			return nil, err
+		}
+		sig.params = []*typeSignature{key, value}
+	case "row":
+		if err = p.parseFields(sig); err != nil {
+			return nil, err
+		}
+	default:
+		// e.g. decimal(10, 2), varchar(10), timestamp(3)
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] != closing {
+			p.pos++
+		}
+		var numbers []int64
+		for _, n := range strings.Split(p.s[start:p.pos], ",") {
+			i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+			if err != nil {
+				return nil, p.errorf("invalid parameter %q", n)
+			}
+			numbers = append(numbers, i)
+		}
+		if name == "decimal" {
+			sig.precision = numbers[0]
+			if len(numbers) > 1 {
+				sig.scale = numbers[1]
+			}
+		}
+	}
+	if err = p.expect(closing); err != nil {
+		return nil, err
+	}
+	// e.g. timestamp(3) with time zone
+	if rest := p.words(); rest != "" {
+		if sig.isComplex() {
+			return nil, p.errorf("unexpected %q", rest)
+		}
+		sig.name += " " + rest
+	}
+	return sig, nil
+}
+
+// parseFields parses the fields of a row, which are `name type` or `name:type`, or only `type` if the row is
+// anonymous and its fields are named field0, field1 etc.
+func (p *signatureParser) parseFields(sig *typeSignature) error {
+	for i := 0; ; i++ {
+		if i > 0 {
+			if p.skipSpaces(); p.pos < len(p.s) && p.s[p.pos] != ',' {
+				return nil
+			}
+			p.pos++
+		}
+		start := p.pos
+		name, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		p.skipSpaces()
+		if p.pos < len(p.s) && p.s[p.pos] == ':' {
+			p.pos++
+		} else if p.pos >= len(p.s) || strings.ContainsRune("(<,)>", rune(p.s[p.pos])) ||
+			isAthenaTypeName(name+" "+p.peekWords()) {
+			// no field name, e.g. row(integer, varchar) or row(timestamp with time zone)
+			p.pos, name = start, "field"+strconv.Itoa(i)
+		}
+		fieldType, err := p.parse()
+		if err != nil {
+			return err
+		}
+		sig.fields = append(sig.fields, name)
+		sig.params = append(sig.params, fieldType)
+	}
+}
+
+func (p *signatureParser) peekWords() string {
+	pos := p.pos
+	words := p.words()
+	p.pos = pos
+	return words
+}
+
+func isAthenaTypeName(name string) bool {
+	name = strings.ToLower(name)
+	for _, t := range AthenaColumnTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// complexDecoder decodes the text rendering of ARRAY, MAP and ROW values. The other values are converted by
+// convert. An element without a type signature is kept as a string, because a string starting with [ or { would
+// be mistaken for an ARRAY or a MAP, and it isn't known if a nested {} is a MAP or a ROW.
+type complexDecoder struct {
+	convert func(sig *typeSignature, text string) (interface{}, error)
+}
+
+func (d complexDecoder) decode(sig *typeSignature, text string) (interface{}, error) {
+	if text == "null" {
+		return nil, nil
+	}
+	if sig == nil {
+		return text, nil
+	}
+	switch sig.name {
+	case "array":
+		return d.decodeArray(sig, text)
+	case "map":
+		return d.decodeMap(sig, text)
+	case "row":
+		return d.decodeRow(sig, text)
+	}
+	return d.convert(sig, text)
+}
+
+// param returns the i-th parameter of a type, which is nil if the type has no signature.
+func (t *typeSignature) param(i int) *typeSignature {
+	if i < len(t.params) {
+		return t.params[i]
+	}
+	return nil
+}
+
+func enclosed(text string, open, close byte) (string, error) {
+	if len(text) < 2 || text[0] != open || text[len(text)-1] != close {
+		return "", fmt.Errorf("%w: %q isn't enclosed in %c%c", ErrComplexValue, text, open, close)
+	}
+	return text[1 : len(text)-1], nil
+}
+
+// indexSeparator returns the index of the first sep in s, which is outside of [] and {} if nested.
+func indexSeparator(s string, sep string, nested bool) int {
+	depth := 0
+	for i := 0; i+len(sep) <= len(s); i++ {
+		if nested {
+			switch s[i] {
+			case '[', '{':
+				depth++
+				continue
+			case ']', '}':
+				depth--
+				continue
+			}
+		}
+		if depth == 0 && strings.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitElements splits the elements of an array or the entries of a map, which are separated by `, `.
+func splitElements(s string, nested bool) []string {
+	var elements []string
+	for {
+		i := indexSeparator(s, ", ", nested)
+		if i < 0 {
+			return append(elements, s)
+		}
+		elements = append(elements, s[:i])
+		s = s[i+2:]
+	}
+}
+
+func (d complexDecoder) decodeArray(sig *typeSignature, text string) (interface{}, error) {
+	inner, err := enclosed(text, '[', ']')
+	if err != nil {
+		return nil, err
+	}
+	values := []interface{}{}
+	if inner == "" {
+		return values, nil
+	}
+	elem := sig.param(0)
+	for _, element := range splitElements(inner, elem.isComplex()) {
+		v, err := d.decode(elem, element)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// entries splits the `key=value` entries of a map or a row. A part which isn't a valid entry belongs to the value
+// of the previous entry, because the value has `, ` in it.
+func (d complexDecoder) entries(inner string, key *typeSignature, nested bool) ([][2]string, error) {
+	var entries [][2]string
+	for _, part := range splitElements(inner, nested) {
+		i := indexSeparator(part, "=", nested)
+		valid := i > 0
+		if valid && key != nil && !key.isComplex() && !isStringType(key.name) {
+			_, err := d.convert(key, part[:i])
+			valid = err == nil
+		}
+		switch {
+		case valid:
+			entries = append(entries, [2]string{part[:i], part[i+1:]})
+		case len(entries) > 0:
+			entries[len(entries)-1][1] += ", " + part
+		default:
+			return nil, fmt.Errorf("%w: %q isn't a key=value entry", ErrComplexValue, part)
+		}
+	}
+	return entries, nil
+}
+
+func isStringType(name string) bool {
+	switch name {
+	case "varchar", "char", "string", "json":
+		return true
+	}
+	return false
+}
+
+func (d complexDecoder) decodeMap(sig *typeSignature, text string) (interface{}, error) {
+	inner, err := enclosed(text, '{', '}')
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if inner == "" {
+		return values, nil
+	}
+	key, value := sig.param(0), sig.param(1)
+	entries, err := d.entries(inner, key, value.isComplex())
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if values[e[0]], err = d.decode(value, e[1]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (d complexDecoder) decodeRow(sig *typeSignature, text string) (interface{}, error) {
+	inner, err := enclosed(text, '{', '}')
+	if err != nil {
+		return nil, err
+	}
+	row := RowValue{}
+	if len(sig.fields) == 0 {
+		// without the field names, the values can only be told apart by `, `.
+		if inner == "" {
+			return row, nil
+		}
+		entries, err := d.entries(inner, nil, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			v, err := d.decode(nil, e[1])
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, RowField{Name: e[0], Value: v})
+		}
+		return row, nil
+	}
+	return d.decodeFields(sig, 0, inner, text)
+}
+
+// decodeFields decodes the fields of a row from the i-th on. The value of a field ends where the next field starts,
+// and if there is more than one place it can start, the first one the following fields can be decoded from is taken.
+func (d complexDecoder) decodeFields(sig *typeSignature, i int, rest string, text string) (RowValue, error) {
+	name := sig.fields[i]
+	if len(rest) <= len(name) || !strings.EqualFold(rest[:len(name)+1], name+"=") {
+		return nil, fmt.Errorf("%w: field %s expected in %q", ErrComplexValue, name, text)
+	}
+	rest = rest[len(name)+1:]
+	if i == len(sig.fields)-1 {
+		v, err := d.decode(sig.params[i], rest)
+		if err != nil {
+			return nil, err
+		}
+		return RowValue{{Name: name, Value: v}}, nil
+	}
+	err := fmt.Errorf("%w: field %s expected in %q", ErrComplexValue, sig.fields[i+1], text)
+	sep := ", " + sig.fields[i+1] + "="
+	for end := 0; ; end += len(sep) {
+		j := indexSeparator(rest[end:], sep, sig.params[i].isComplex())
+		if j < 0 {
+			return nil, err
+		}
+		end += j
+		var v interface{}
+		if v, err = d.decode(sig.params[i], rest[:end]); err != nil {
+			continue
+		}
+		var row RowValue
+		if row, err = d.decodeFields(sig, i+1, rest[end+2:], text); err != nil {
+			continue
+		}
+		return append(RowValue{{Name: name, Value: v}}, row...), nil
+	}
+}
+
+// decodeComplexValue is to decode an ARRAY, MAP or ROW value with the type signature of its column, which is
+// set for the query by WithColumnTypeSignature or else comes from ColumnInfo.Type.
+func (r *Rows) decodeComplexValue(columnInfo *athena.ColumnInfo, val string, driverConfig *Config) (interface{},
+	error) {
+	signature, ok := columnTypeSignature(r.ctx, *columnInfo.Name)
+	if !ok {
+		signature = *columnInfo.Type
+	}
+	sig, err := parseTypeSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	decoder := complexDecoder{
+		convert: func(sig *typeSignature, text string) (interface{}, error) {
+			elemInfo := &athena.ColumnInfo{
+				Name:      columnInfo.Name,
+				Type:      aws.String(sig.name),
+				Precision: aws.Int64(sig.precision),
+				Scale:     aws.Int64(sig.scale),
+			}
+			return r.athenaTypeToGoType(elemInfo, &text, driverConfig)
+		},
+	}
+	return decoder.decode(sig, val)
+}
+
+// formatComplexValue renders a decoded ARRAY, MAP or ROW value the way Athena does. Map entries are sorted by key.
+func formatComplexValue(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		elements := make([]string, len(vv))
+		for i, e := range vv {
+			elements[i] = formatComplexValue(e)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			keys[i] = k + "=" + formatComplexValue(vv[k])
+		}
+		return "{" + strings.Join(keys, ", ") + "}"
+	case RowValue:
+		fields := make([]string, len(vv))
+		for i, f := range vv {
+			fields[i] = f.Name + "=" + formatComplexValue(f.Value)
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	var c textCell
+	_ = c.Scan(v)
+	return string(c)
+}
+
+// Complex returns a sql.Scanner which loads an ARRAY, MAP or ROW value into dest, which is a pointer to a slice,
+// array, map or struct, or to an interface{}. The values decoded by Config.SetDecodeComplexTypes are loaded as they
+// are. The strings returned otherwise are decoded with the type of dest, e.g. ARRAY(BIGINT) for []int64, and the
+// fields of a struct are named like the fields of a ROW query argument.
+//
+//	var tags []string
+//	err := rows.Scan(&id, athenadriver.Complex(&tags))
+func Complex(dest interface{}) sql.Scanner {
+	return complexScanner{dest: dest}
+}
+
+type complexScanner struct {
+	dest interface{}
+}
+
+// Scan is to implement interface sql.Scanner.
+func (s complexScanner) Scan(src interface{}) error {
+	dv := reflect.ValueOf(s.dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("%w: destination %T isn't a pointer", ErrComplexValue, s.dest)
+	}
+	if text, ok := src.(string); ok {
+		signature, err := athenaTypeWith(dv.Elem().Type(), scannerType)
+		if err == nil {
+			var sig *typeSignature
+			if sig, err = parseTypeSignature(signature); err == nil && !sig.isComplex() {
+				err = ErrComplexType
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%w: no ARRAY, MAP or ROW type for %T", ErrComplexValue, s.dest)
+		}
+		conf := NewNoOpsConfig()
+		r := &Rows{config: conf, tracer: NewDefaultObservability(conf)}
+		if src, err = r.decodeComplexValue(&athena.ColumnInfo{Name: aws.String(""), Type: aws.String(signature)},
+			text, conf); err != nil {
+			return err
+		}
+	}
+	return assignComplexValue(dv.Elem(), src)
+}
+
+// scannerType is the Athena type of the elements loaded by their own Scan: Decimal for decimal, and others from
+// their text.
+func scannerType(t reflect.Type) (string, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(Decimal{}) || t == reflect.TypeOf(NullDecimal{}):
+		return "decimal", true
+	case reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()):
+		return "varchar", true
+	}
+	return "", false
+}
+
+// assignComplexValue is to load a decoded value into dst.
+func assignComplexValue(dst reflect.Value, v interface{}) error {
+	if v == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if scanner, ok := dst.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(v)
+	}
+	sv := reflect.ValueOf(v)
+	switch dst.Kind() {
+	case reflect.Interface:
+		if sv.Type().AssignableTo(dst.Type()) {
+			dst.Set(sv)
+			return nil
+		}
+	case reflect.Ptr:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignComplexValue(elem.Elem(), v); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case reflect.Slice, reflect.Array:
+		var elements []interface{}
+		switch vv := v.(type) {
+		case []interface{}:
+			elements = vv
+		case RowValue:
+			for _, f := range vv {
+				elements = append(elements, f.Value)
+			}
+		default:
+			if s, ok := v.(string); ok && dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8 {
+				dst.SetBytes([]byte(s))
+				return nil
+			}
+			if sv.Type().AssignableTo(dst.Type()) {
+				dst.Set(sv)
+				return nil
+			}
+			return fmt.Errorf("%w: cannot load %T into %s", ErrComplexValue, v, dst.Type())
+		}
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(elements), len(elements)))
+		} else if dst.Len() != len(elements) {
+			return fmt.Errorf("%w: %d elements for %s", ErrComplexValue, len(elements), dst.Type())
+		}
+		for i, e := range elements {
+			if err := assignComplexValue(dst.Index(i), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		entries, ok := v.(map[string]interface{})
+		if row, isRow := v.(RowValue); isRow {
+			entries, ok = map[string]interface{}{}, true
+			for _, f := range row {
+				entries[f.Name] = f.Value
+			}
+		}
+		if !ok {
+			break
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(entries))
+		for k, e := range entries {
+			key := reflect.New(dst.Type().Key()).Elem()
+			if err := assignComplexValue(key, mapKeyValue(key.Kind(), k)); err != nil {
+				return err
+			}
+			value := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignComplexValue(value, e); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		dst.Set(m)
+		return nil
+	case reflect.Struct:
+		row, ok := v.(RowValue)
+		if !ok {
+			break
+		}
+		n := 0
+		for i := 0; i < dst.NumField(); i++ {
+			name, ok := rowFieldName(dst.Type().Field(i))
+			if !ok {
+				continue
+			}
+			value, found := row.Get(name)
+			if !found && n < len(row) && row[n].Name == "field"+strconv.Itoa(n) {
+				// the fields of an anonymous row are matched by position
+				value, found = row[n].Value, true
+			}
+			n++
+			if !found {
+				continue
+			}
+			if err := assignComplexValue(dst.Field(i), value); err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+		return nil
+	case reflect.Bool:
+		if b, ok := v.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.String:
+		if sv.Kind() == reflect.String {
+			dst.SetString(sv.String())
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(sv.Int()) {
+				return fmt.Errorf("%w: %v overflows %s", ErrComplexValue, v, dst.Type())
+			}
+			dst.SetInt(sv.Int())
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if sv.Int() < 0 || dst.OverflowUint(uint64(sv.Int())) {
+				return fmt.Errorf("%w: %v overflows %s", ErrComplexValue, v, dst.Type())
+			}
+			dst.SetUint(uint64(sv.Int()))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch sv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(sv.Float())
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst.SetFloat(float64(sv.Int()))
+			return nil
+		}
+	}
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+	return fmt.Errorf("%w: cannot load %T into %s", ErrComplexValue, v, dst.Type())
+}
+
+// mapKeyValue is to convert the text of a map key to a value for a key of kind k.
+func mapKeyValue(k reflect.Kind, key string) interface{} {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, err := strconv.ParseInt(key, 10, 64); err == nil {
+			return i
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(key, 64); err == nil {
+			return f
+		}
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(key); err == nil {
+			return b
+		}
+	}
+	return key
+}
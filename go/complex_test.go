@@ -0,0 +1,302 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTypeSignature(t *testing.T) {
+	sig, err := parseTypeSignature("array(row(a integer, \"B c\" map(varchar, decimal(10, 2)), d timestamp with time zone))")
+	assert.Nil(t, err)
+	assert.Equal(t, "array", sig.name)
+	row := sig.params[0]
+	assert.Equal(t, "row", row.name)
+	assert.Equal(t, []string{"a", "B c", "d"}, row.fields)
+	assert.Equal(t, "integer", row.params[0].name)
+	assert.Equal(t, "map", row.params[1].name)
+	assert.Equal(t, "varchar", row.params[1].params[0].name)
+	decimal := row.params[1].params[1]
+	assert.Equal(t, "decimal", decimal.name)
+	assert.Equal(t, int64(10), decimal.precision)
+	assert.Equal(t, int64(2), decimal.scale)
+	assert.Equal(t, "timestamp with time zone", row.params[2].name)
+
+	// Hive's syntax
+	sig, err = parseTypeSignature("map<string,struct<x:int,y:array<double>>>")
+	assert.Nil(t, err)
+	assert.Equal(t, "map", sig.name)
+	assert.Equal(t, "string", sig.params[0].name)
+	assert.Equal(t, "row", sig.params[1].name)
+	assert.Equal(t, []string{"x", "y"}, sig.params[1].fields)
+	assert.Equal(t, "integer", sig.params[1].params[0].name)
+	assert.Equal(t, "double", sig.params[1].params[1].params[0].name)
+
+	// anonymous rows
+	sig, err = parseTypeSignature("ROW(INTEGER, timestamp(3) with time zone, interval day to second, VARCHAR(10))")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"field0", "field1", "field2", "field3"}, sig.fields)
+	assert.Equal(t, "timestamp with time zone", sig.params[1].name)
+	assert.Equal(t, "interval day to second", sig.params[2].name)
+	assert.Equal(t, "varchar", sig.params[3].name)
+
+	for _, s := range []string{"", "array(", "array(integer", "map(varchar)", "array(integer) x", "decimal(a)",
+		"row(\"a integer)", "row()", "array<integer)"} {
+		_, err := parseTypeSignature(s)
+		assert.True(t, errors.Is(err, ErrComplexType), s)
+	}
+
+	assert.Equal(t, "decimal", athenaTypeName("decimal(10, 2)"))
+	assert.Equal(t, "array", athenaTypeName("array<int>"))
+	assert.Equal(t, "timestamp with time zone", athenaTypeName("timestamp(3) with time zone"))
+	assert.Equal(t, "varchar", athenaTypeName("varchar"))
+	assert.Equal(t, "array(", athenaTypeName("array("))
+}
+
+func decodeTestValue(t *testing.T, testConf *Config, athenaType string, val string) (interface{}, error) {
+	r, _ := NewRows(context.Background(), newMockAthenaClient(), "SELECT_OK", testConf,
+		NewDefaultObservability(testConf))
+	return r.athenaTypeToGoType(newColumnInfo("c", athenaType), aws.String(val), testConf)
+}
+
+func TestRows_DecodeComplexTypes(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	v, err := decodeTestValue(t, testConf, "array(integer)", "[1, 2]")
+	assert.Nil(t, err)
+	assert.Equal(t, "[1, 2]", v)
+
+	testConf.SetDecodeComplexTypes(true)
+	assert.True(t, testConf.IsDecodeComplexTypes())
+	ts, _ := scanTime("2020-01-20 12:00:00.000")
+	for _, test := range []struct {
+		athenaType string
+		val        string
+		expected   interface{}
+	}{
+		{"array(integer)", "[1, 2, null]", []interface{}{int32(1), int32(2), nil}},
+		{"array(integer)", "[]", []interface{}{}},
+		{"array(timestamp)", "[2020-01-20 12:00:00.000]", []interface{}{ts.Time}},
+		{"array(array(bigint))", "[[1], [], null, [2, 3]]",
+			[]interface{}{[]interface{}{int64(1)}, []interface{}{}, nil, []interface{}{int64(2), int64(3)}}},
+		// without a type signature, the elements are strings, even if they look like an ARRAY or a MAP
+		{"array", "[a, b, [c, d]]", []interface{}{"a", "b", "[c, d]"}},
+		{"array", "[[x, y], {not a map, z]", []interface{}{"[x, y]", "{not a map, z"}},
+		{"map(varchar, integer)", "{a=1, b=null}", map[string]interface{}{"a": int32(1), "b": nil}},
+		{"map(varchar, array(boolean))", "{a=[true, false], b=[]}",
+			map[string]interface{}{"a": []interface{}{true, false}, "b": []interface{}{}}},
+		// the keys tell where the values with `, ` end
+		{"map(integer, varchar)", "{1=a, b, 2=c=d, 3=x=y, z}", map[string]interface{}{"1": "a, b", "2": "c=d",
+			"3": "x=y, z"}},
+		{"map", "{a=1, b={c=2}}", map[string]interface{}{"a": "1", "b": "{c=2}"}},
+		{"map(varchar, integer)", "{}", map[string]interface{}{}},
+		// the field names tell where the values end
+		{"row(x integer, y array(varchar), z varchar)", "{x=1, y=[foo, bar], z=hello, world}",
+			RowValue{{"x", int32(1)}, {"y", []interface{}{"foo", "bar"}}, {"z", "hello, world"}}},
+		{"row(a varchar, b double)", "{a=x, b=y, b=1.5}", RowValue{{"a", "x, b=y"}, {"b", 1.5}}},
+		{"array(row(a integer, b varchar))", "[{a=1, b=x}, null, {a=2, b=y, z}]",
+			[]interface{}{RowValue{{"a", int32(1)}, {"b", "x"}}, nil, RowValue{{"a", int32(2)}, {"b", "y, z"}}}},
+		{"row(integer, double)", "{field0=1, field1=2.0}", RowValue{{"field0", int32(1)}, {"field1", 2.0}}},
+		{"struct<A:int,b:string>", "{a=1, b=null}", RowValue{{"A", int32(1)}, {"b", nil}}},
+		{"row", "{a=1, b={c=2}, d=[x, y], e={oops}",
+			RowValue{{"a", "1"}, {"b", "{c=2}"}, {"d", "[x, y]"}, {"e", "{oops"}}},
+	} {
+		v, err := decodeTestValue(t, testConf, test.athenaType, test.val)
+		assert.Nil(t, err, test.athenaType)
+		assert.Equal(t, test.expected, v, test.athenaType)
+	}
+
+	for athenaType, val := range map[string]string{
+		"array(integer)":                 "[1, x]",
+		"array(varchar)":                 "a, b",
+		"map(varchar, integer)":          "{a}",
+		"row(a integer, b integer)":      "{a=1, c=2}",
+		"row(a integer)":                 "{b=1}",
+		"array(weird_type(1, 2) x y z))": "[]",
+	} {
+		_, err := decodeTestValue(t, testConf, athenaType, val)
+		assert.NotNil(t, err, athenaType)
+	}
+
+	// decimal elements follow exactDecimal
+	v, err = decodeTestValue(t, testConf, "array(decimal(10, 2))", "[1.5]")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"1.5"}, v)
+	testConf.SetExactDecimal(true)
+	v, err = decodeTestValue(t, testConf, "array(decimal(10, 2))", "[1.5]")
+	assert.Nil(t, err)
+	d := v.([]interface{})[0].(Decimal)
+	assert.Equal(t, "1.50", d.String())
+	assert.Equal(t, int64(10), d.Precision())
+}
+
+func TestRows_DecodeComplexTypes_ColumnTypeSignature(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetDecodeComplexTypes(true)
+	ctx := WithColumnTypeSignature(context.Background(), "c", "array<bigint>")
+	ctx = WithColumnTypeSignature(ctx, "m", "map(varchar, integer)")
+	signature, ok := columnTypeSignature(ctx, "c")
+	assert.True(t, ok)
+	assert.Equal(t, "array<bigint>", signature)
+	_, ok = columnTypeSignature(ctx, "x")
+	assert.False(t, ok)
+	_, ok = columnTypeSignature(nil, "c")
+	assert.False(t, ok)
+
+	r, _ := NewRows(ctx, newMockAthenaClient(), "SELECT_OK", testConf, NewDefaultObservability(testConf))
+	v, err := r.athenaTypeToGoType(newColumnInfo("c", "array"), aws.String("[1, 2]"), testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, v)
+	v, err = r.athenaTypeToGoType(newColumnInfo("m", "map"), aws.String("{a=1}"), testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": int32(1)}, v)
+
+	// a signature set again replaces the previous one
+	ctx = WithColumnTypeSignature(ctx, "c", "array(varchar)")
+	signature, _ = columnTypeSignature(ctx, "c")
+	assert.Equal(t, "array(varchar)", signature)
+
+	// the signatures only apply to the query run with ctx
+	v, err = decodeTestValue(t, testConf, "array", "[1, 2]")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"1", "2"}, v)
+}
+
+func TestRows_DecodeComplexTypes_ColumnType(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := &Rows{
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{
+				ResultSetMetadata: &athena.ResultSetMetadata{
+					ColumnInfo: []*athena.ColumnInfo{newColumnInfo("a", "array"), newColumnInfo("m", "map"),
+						newColumnInfo("r", "row"), newColumnInfo("s", "struct<a:int>")},
+				},
+			},
+		},
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, reflect.TypeOf(""), r.ColumnTypeScanType(i))
+	}
+	assert.Equal(t, "", r.getDefaultValueForColumnType("array"))
+
+	testConf.SetDecodeComplexTypes(true)
+	assert.Equal(t, reflect.TypeOf([]interface{}{}), r.ColumnTypeScanType(0))
+	assert.Equal(t, reflect.TypeOf(map[string]interface{}{}), r.ColumnTypeScanType(1))
+	assert.Equal(t, reflect.TypeOf(RowValue{}), r.ColumnTypeScanType(2))
+	assert.Equal(t, reflect.TypeOf(RowValue{}), r.ColumnTypeScanType(3))
+	assert.Equal(t, []interface{}(nil), r.getDefaultValueForColumnType("array(integer)"))
+	assert.Equal(t, map[string]interface{}(nil), r.getDefaultValueForColumnType("map"))
+	assert.Equal(t, RowValue(nil), r.getDefaultValueForColumnType("row"))
+}
+
+type testComplexItem struct {
+	ID     int64
+	Name   string `athena:"name"`
+	Tags   []string
+	Price  Decimal
+	Parent *testComplexItem
+}
+
+type testComplexRow struct {
+	ID    int64
+	Name  string `athena:"name"`
+	Tags  []string
+	Price Decimal
+}
+
+func TestComplex(t *testing.T) {
+	var ids []int64
+	assert.Nil(t, Complex(&ids).Scan([]interface{}{int32(1), int64(2), nil}))
+	assert.Equal(t, []int64{1, 2, 0}, ids)
+	assert.Nil(t, Complex(&ids).Scan("[3, 4]"))
+	assert.Equal(t, []int64{3, 4}, ids)
+	assert.Nil(t, Complex(&ids).Scan(nil))
+	assert.Nil(t, ids)
+
+	var pair [2]float64
+	assert.Nil(t, Complex(&pair).Scan([]interface{}{int32(1), 2.5}))
+	assert.Equal(t, [2]float64{1, 2.5}, pair)
+	assert.True(t, errors.Is(Complex(&pair).Scan([]interface{}{1.0}), ErrComplexValue))
+
+	var counts map[string]int
+	assert.Nil(t, Complex(&counts).Scan(map[string]interface{}{"a": int32(1), "b": nil}))
+	assert.Equal(t, map[string]int{"a": 1, "b": 0}, counts)
+	var byID map[int]*string
+	assert.Nil(t, Complex(&byID).Scan("{1=a, b, 2=null}"))
+	assert.Equal(t, "a, b", *byID[1])
+	assert.Nil(t, byID[2])
+
+	var item testComplexItem
+	assert.Nil(t, Complex(&item).Scan(RowValue{{"id", int64(1)}, {"name", "a"}, {"tags", []interface{}{"x"}},
+		{"price", "1.50"}, {"parent", RowValue{{"id", int64(0)}, {"name", "root"}}}}))
+	assert.Equal(t, int64(1), item.ID)
+	assert.Equal(t, "a", item.Name)
+	assert.Equal(t, []string{"x"}, item.Tags)
+	assert.Equal(t, "1.50", item.Price.String())
+	assert.Equal(t, "root", item.Parent.Name)
+
+	// the type of the struct decodes the string returned without SetDecodeComplexTypes
+	var items []testComplexRow
+	assert.Nil(t, Complex(&items).Scan("[{id=2, name=b, c, tags=[], price=0.1}]"))
+	assert.Equal(t, []testComplexRow{{ID: 2, Name: "b, c", Tags: []string{}, Price: NewDecimal(big.NewInt(1), 1)}},
+		items)
+
+	// anonymous rows are matched by position
+	var point struct {
+		X, Y float64
+	}
+	assert.Nil(t, Complex(&point).Scan(RowValue{{"field0", 1.5}, {"field1", int32(2)}}))
+	assert.Equal(t, 1.5, point.X)
+	assert.Equal(t, 2.0, point.Y)
+
+	var value interface{}
+	assert.Nil(t, Complex(&value).Scan(RowValue{{"a", "1"}}))
+	assert.Equal(t, RowValue{{"a", "1"}}, value)
+
+	var small []int8
+	assert.True(t, errors.Is(Complex(&small).Scan([]interface{}{int64(300)}), ErrComplexValue))
+	var names []string
+	assert.True(t, errors.Is(Complex(&names).Scan([]interface{}{int64(1)}), ErrComplexValue))
+	assert.True(t, errors.Is(Complex(ids).Scan("[1]"), ErrComplexValue))
+	assert.True(t, errors.Is(Complex(&value).Scan("[1]"), ErrComplexValue))
+	assert.NotNil(t, Complex(&ids).Scan("[x]"))
+}
+
+func TestRowsToCSV_Complex(t *testing.T) {
+	assert.Equal(t, "[1, null, {a=x, b=[]}]", formatComplexValue([]interface{}{int32(1), nil,
+		map[string]interface{}{"b": []interface{}{}, "a": "x"}}))
+	assert.Equal(t, "{x=1.5, y=2020-01-20T12:00:00Z}", formatComplexValue(RowValue{{"x", 1.5},
+		{"y", time.Date(2020, 1, 20, 12, 0, 0, 0, time.UTC)}}))
+
+	var c textCell
+	assert.Nil(t, c.Scan(RowValue{{"a", []interface{}{"x", nil}}}))
+	assert.Equal(t, "{a=[x, null]}", string(c))
+}
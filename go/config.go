@@ -22,10 +22,15 @@ package athenadriver
 
 import (
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"strconv"
 	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
 )
 
 // Config is for AWS Athena Driver Config.
@@ -38,6 +43,8 @@ type Config struct {
 var reSecretAccessKey = regexp.MustCompile(`secretAccessKey=[^&]+`)
 var reAccessID = regexp.MustCompile(`accessID=[^&]+`)
 var reSessionToken = regexp.MustCompile(`sessionToken=[^&]+`)
+var reKMSKey = regexp.MustCompile(`kmsKey=[^&]+`)
+var reExpectedBucketOwner = regexp.MustCompile(`expectedBucketOwner=[^&]+`)
 
 var (
 	credAccessEnvKey = []string{
@@ -110,9 +117,37 @@ func NewConfig(s string) (*Config, error) {
 	if !a.isValid() {
 		return nil, ErrConfigInvalidConfig
 	}
+	if err == nil {
+		err = a.checkResultConfiguration()
+	}
 	return &a, err
 }
 
+// checkResultConfiguration is to check the encryption and ACL options of a DSN the same way as their setters do.
+func (c *Config) checkResultConfiguration() error {
+	if option := c.GetEncryptionOption(); option != "" {
+		if err := c.SetEncryption(option, c.GetKMSKey()); err != nil {
+			return err
+		}
+	}
+	if acl := c.GetS3ACLOption(); acl != "" {
+		return c.SetS3ACLOption(acl)
+	}
+	return nil
+}
+
+// clone is to copy c, so that the copy can be changed without changing c.
+func (c *Config) clone() *Config {
+	values := url.Values{}
+	for k, v := range c.values {
+		values[k] = append([]string(nil), v...)
+	}
+	return &Config{
+		dsn:    c.dsn,
+		values: values,
+	}
+}
+
 func (c *Config) isValid() bool {
 	return c.dsn.Scheme == "s3" && c.values.Get("region") != ""
 }
@@ -135,6 +170,8 @@ func (c *Config) SafeStringify() string {
 	s := reSecretAccessKey.ReplaceAllString(rawString, `secretAccessKey=*`)
 	s = reAccessID.ReplaceAllString(s, `accessID=*`)
 	s = reSessionToken.ReplaceAllString(s, `sessionToken=*`)
+	s = reKMSKey.ReplaceAllString(s, `kmsKey=*`)
+	s = reExpectedBucketOwner.ReplaceAllString(s, `expectedBucketOwner=*`)
 	return s
 }
 
@@ -159,6 +196,85 @@ func (c *Config) SetOutputBucket(o string) error {
 	return nil
 }
 
+// SetEncryption is to encrypt query results in the output bucket. option is one of athena.EncryptionOptionSseS3,
+// athena.EncryptionOptionSseKms and athena.EncryptionOptionCseKms. kmsKey is the ARN or ID of the KMS key, which
+// is required by SSE_KMS and CSE_KMS.
+func (c *Config) SetEncryption(option string, kmsKey string) error {
+	switch option {
+	case athena.EncryptionOptionSseS3:
+		kmsKey = ""
+	case athena.EncryptionOptionSseKms, athena.EncryptionOptionCseKms:
+		if kmsKey == "" {
+			return ErrConfigKMSKeyRequired
+		}
+	default:
+		return ErrConfigEncryptionOption
+	}
+	c.values.Set("encryptionOption", option)
+	c.values.Set("kmsKey", kmsKey)
+	return nil
+}
+
+// GetEncryptionOption is getter of encryptionOption.
+func (c *Config) GetEncryptionOption() string {
+	return c.values.Get("encryptionOption")
+}
+
+// GetKMSKey is getter of kmsKey.
+func (c *Config) GetKMSKey() string {
+	return c.values.Get("kmsKey")
+}
+
+// SetExpectedBucketOwner is a setter of the AWS account ID that must own the output bucket,
+// for output buckets in another account.
+func (c *Config) SetExpectedBucketOwner(o string) {
+	c.values.Set("expectedBucketOwner", o)
+}
+
+// GetExpectedBucketOwner is getter of expectedBucketOwner.
+func (c *Config) GetExpectedBucketOwner() string {
+	return c.values.Get("expectedBucketOwner")
+}
+
+// SetS3ACLOption is a setter of the canned ACL of query results, which can only be
+// athena.S3AclOptionBucketOwnerFullControl.
+func (c *Config) SetS3ACLOption(o string) error {
+	if o != athena.S3AclOptionBucketOwnerFullControl {
+		return ErrConfigS3ACLOption
+	}
+	c.values.Set("s3AclOption", o)
+	return nil
+}
+
+// GetS3ACLOption is getter of s3AclOption.
+func (c *Config) GetS3ACLOption() string {
+	return c.values.Get("s3AclOption")
+}
+
+// GetResultConfiguration is to get the athena.ResultConfiguration of queries and workgroups created remotely.
+func (c *Config) GetResultConfiguration() *athena.ResultConfiguration {
+	r := &athena.ResultConfiguration{
+		OutputLocation: aws.String(c.GetOutputBucket()),
+	}
+	if option := c.GetEncryptionOption(); option != "" {
+		r.EncryptionConfiguration = &athena.EncryptionConfiguration{
+			EncryptionOption: aws.String(option),
+		}
+		if kmsKey := c.GetKMSKey(); kmsKey != "" {
+			r.EncryptionConfiguration.KmsKey = aws.String(kmsKey)
+		}
+	}
+	if owner := c.GetExpectedBucketOwner(); owner != "" {
+		r.ExpectedBucketOwner = aws.String(owner)
+	}
+	if acl := c.GetS3ACLOption(); acl != "" {
+		r.AclConfiguration = &athena.AclConfiguration{
+			S3AclOption: aws.String(acl),
+		}
+	}
+	return r
+}
+
 // SetRegion is to set region.
 func (c *Config) SetRegion(o string) error {
 	if len(o) == 0 {
@@ -194,6 +310,17 @@ func (c *Config) GetDB() string {
 	return DefaultDBName
 }
 
+// SetCatalog is a setter of the data catalog of queries, like a Glue catalog in another account or a Lambda
+// federated catalog. Athena uses AwsDataCatalog if it is not set.
+func (c *Config) SetCatalog(o string) {
+	c.values.Set("catalog", o)
+}
+
+// GetCatalog is getter of catalog.
+func (c *Config) GetCatalog() string {
+	return c.values.Get("catalog")
+}
+
 // SetResultPollIntervalSeconds is a setter of Overriding poll interval.
 func (c *Config) SetResultPollIntervalSeconds(n int) {
 	c.values.Set("resultPollIntervalSeconds", strconv.Itoa(n))
@@ -211,6 +338,415 @@ func (c *Config) GetResultPollIntervalSeconds() time.Duration {
 	return time.Duration(PoolInterval) * time.Second
 }
 
+// SetResultPollInitialInterval is to poll the query status with a backoff PollStrategy, starting from
+// this interval. It is stored in milliseconds, so sub-second intervals are fine.
+func (c *Config) SetResultPollInitialInterval(d time.Duration) {
+	c.values.Set("resultPollInitialIntervalMs", strconv.FormatInt(d.Milliseconds(), 10))
+}
+
+// SetResultPollMaxInterval is a setter of the maximum interval of the backoff PollStrategy.
+func (c *Config) SetResultPollMaxInterval(d time.Duration) {
+	c.values.Set("resultPollMaxIntervalMs", strconv.FormatInt(d.Milliseconds(), 10))
+}
+
+// SetResultPollBackoffFactor is a setter of the growth factor of the backoff PollStrategy.
+func (c *Config) SetResultPollBackoffFactor(f float64) {
+	c.values.Set("resultPollBackoffFactor", strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// SetResultPollJitter is a setter of the jitter of the backoff PollStrategy, as a fraction of the interval.
+func (c *Config) SetResultPollJitter(f float64) {
+	c.values.Set("resultPollJitter", strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// GetPollStrategy is getter of the PollStrategy configured in the DSN.
+// A backoff PollStrategy is used if resultPollInitialIntervalMs is set. Its maximum interval
+// defaults to resultPollIntervalSeconds. Otherwise the query status is polled every resultPollIntervalSeconds.
+func (c *Config) GetPollStrategy() PollStrategy {
+	initial, err := strconv.ParseInt(c.values.Get("resultPollInitialIntervalMs"), 10, 64)
+	if err != nil || initial <= 0 {
+		return NewConstantPollStrategy(c.GetResultPollIntervalSeconds())
+	}
+	maxInterval := c.GetResultPollIntervalSeconds()
+	if n, err := strconv.ParseInt(c.values.Get("resultPollMaxIntervalMs"), 10, 64); err == nil && n > 0 {
+		maxInterval = time.Duration(n) * time.Millisecond
+	}
+	factor := DefaultPollBackoffFactor
+	if f, err := strconv.ParseFloat(c.values.Get("resultPollBackoffFactor"), 64); err == nil && f >= 1 {
+		factor = f
+	}
+	jitter, err := strconv.ParseFloat(c.values.Get("resultPollJitter"), 64)
+	if err != nil || jitter < 0 {
+		jitter = 0
+	}
+	return NewBackoffPollStrategy(time.Duration(initial)*time.Millisecond, maxInterval, factor, jitter)
+}
+
+// SetAPIRetryBudget is a setter of the number of times a throttled Athena API call is retried.
+// It is 0 by default, which means throttling errors are returned to the caller right away.
+func (c *Config) SetAPIRetryBudget(n int) {
+	c.values.Set("apiRetryBudget", strconv.Itoa(n))
+}
+
+// GetAPIRetryBudget is getter of apiRetryBudget.
+func (c *Config) GetAPIRetryBudget() int {
+	n, err := strconv.Atoi(c.values.Get("apiRetryBudget"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SetAPIRetryBaseDelay is a setter of the delay before the first retry of a throttled Athena API call.
+func (c *Config) SetAPIRetryBaseDelay(d time.Duration) {
+	c.values.Set("apiRetryBaseDelayMs", strconv.FormatInt(d.Milliseconds(), 10))
+}
+
+// GetAPIRetryBaseDelay is getter of apiRetryBaseDelayMs.
+func (c *Config) GetAPIRetryBaseDelay() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("apiRetryBaseDelayMs"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultAPIRetryBaseDelay * time.Millisecond
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// SetAPIRetryMaxDelay is a setter of the maximum delay between two retries of a throttled Athena API call.
+func (c *Config) SetAPIRetryMaxDelay(d time.Duration) {
+	c.values.Set("apiRetryMaxDelayMs", strconv.FormatInt(d.Milliseconds(), 10))
+}
+
+// GetAPIRetryMaxDelay is getter of apiRetryMaxDelayMs.
+func (c *Config) GetAPIRetryMaxDelay() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("apiRetryMaxDelayMs"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultAPIRetryMaxDelay * time.Millisecond
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// SetResubmitMaxAttempts is a setter of the number of times QueryContext resubmits a query which failed for
+// a transient reason. It is 0 by default, which means a failed query is never resubmitted.
+func (c *Config) SetResubmitMaxAttempts(n int) {
+	c.values.Set("resubmitMaxAttempts", strconv.Itoa(n))
+}
+
+// GetResubmitMaxAttempts is getter of resubmitMaxAttempts.
+func (c *Config) GetResubmitMaxAttempts() int {
+	n, err := strconv.Atoi(c.values.Get("resubmitMaxAttempts"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SetResubmitPatterns is a setter of the regular expressions matching the failure reasons of the queries to resubmit.
+// They replace DefaultResubmitPatterns. A query is resubmitted anyway if Athena marks its failure as retryable.
+func (c *Config) SetResubmitPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return err
+		}
+	}
+	c.values["resubmitPatterns"] = patterns
+	return nil
+}
+
+// GetResubmitPatterns is getter of resubmitPatterns. Invalid regular expressions are ignored.
+func (c *Config) GetResubmitPatterns() []*regexp.Regexp {
+	patterns, ok := c.values["resubmitPatterns"]
+	if !ok {
+		patterns = DefaultResubmitPatterns
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if r, err := regexp.Compile(p); err == nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// SetResubmitDelay is a setter of the delay before the first resubmission of a failed query.
+// The delay doubles with every resubmission.
+func (c *Config) SetResubmitDelay(d time.Duration) {
+	c.values.Set("resubmitDelayMs", strconv.FormatInt(d.Milliseconds(), 10))
+}
+
+// GetResubmitDelay is getter of resubmitDelayMs.
+func (c *Config) GetResubmitDelay() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("resubmitDelayMs"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultResubmitDelay * time.Millisecond
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// SetResultReuse is to let Athena reuse the result of a previous run of the same query.
+// https://docs.aws.amazon.com/athena/latest/ug/reusing-query-results.html
+func (c *Config) SetResultReuse(b bool) {
+	if b {
+		c.values.Set("resultReuse", "true")
+	} else {
+		c.values.Set("resultReuse", "false")
+	}
+}
+
+// IsResultReuseEnabled is to check if Athena reuses query results.
+func (c *Config) IsResultReuseEnabled() bool {
+	return c.values.Get("resultReuse") == "true"
+}
+
+// SetResultReuseMaxAge is a setter of the maximum age of a query result to reuse. It is rounded to minutes.
+func (c *Config) SetResultReuseMaxAge(d time.Duration) {
+	c.values.Set("resultReuseMaxAgeMinutes", strconv.FormatInt(int64(d/time.Minute), 10))
+}
+
+// GetResultReuseMaxAge is getter of resultReuseMaxAgeMinutes.
+func (c *Config) GetResultReuseMaxAge() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("resultReuseMaxAgeMinutes"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultResultReuseMaxAge * time.Minute
+	}
+	if n > MaxResultReuseMaxAge {
+		n = MaxResultReuseMaxAge
+	}
+	return time.Duration(n) * time.Minute
+}
+
+// GetResultReuseConfiguration is to get the athena.ResultReuseConfiguration for StartQueryExecution.
+// It is nil if result reuse is not enabled.
+func (c *Config) GetResultReuseConfiguration() *athena.ResultReuseConfiguration {
+	if !c.IsResultReuseEnabled() {
+		return nil
+	}
+	return newResultReuseConfiguration(true, c.GetResultReuseMaxAge())
+}
+
+// SetResultCache is a setter of the ResultCache backend the driver creates, which is "memory" or "file".
+// The result cache is disabled if it is not set. A custom ResultCache can be set with SQLConnector.SetResultCache.
+func (c *Config) SetResultCache(backend string) {
+	c.values.Set("resultCache", backend)
+}
+
+// GetResultCache is getter of resultCache.
+func (c *Config) GetResultCache() string {
+	return c.values.Get("resultCache")
+}
+
+// SetResultCacheTTL is a setter of how long the ID of a finished query stays in ResultCache.
+func (c *Config) SetResultCacheTTL(d time.Duration) {
+	c.values.Set("resultCacheTTLSeconds", strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// GetResultCacheTTL is getter of resultCacheTTLSeconds.
+func (c *Config) GetResultCacheTTL() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("resultCacheTTLSeconds"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultResultCacheTTL * time.Second
+	}
+	return time.Duration(n) * time.Second
+}
+
+// SetWGCacheTTL is a setter of how long a workgroup got from AWS is cached, before it is checked again.
+// Setting it to 0 disables the workgroup cache.
+func (c *Config) SetWGCacheTTL(d time.Duration) {
+	c.values.Set("wgCacheTTLSeconds", strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// GetWGCacheTTL is getter of wgCacheTTLSeconds.
+func (c *Config) GetWGCacheTTL() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("wgCacheTTLSeconds"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultWGCacheTTL * time.Second
+	}
+	return time.Duration(n) * time.Second
+}
+
+// SetWGCacheNegativeTTL is a setter of how long a workgroup which doesn't exist or is disabled is cached.
+// Setting it to 0 disables caching missing and disabled workgroups.
+func (c *Config) SetWGCacheNegativeTTL(d time.Duration) {
+	c.values.Set("wgCacheNegativeTTLSeconds", strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// GetWGCacheNegativeTTL is getter of wgCacheNegativeTTLSeconds.
+func (c *Config) GetWGCacheNegativeTTL() time.Duration {
+	n, err := strconv.ParseInt(c.values.Get("wgCacheNegativeTTLSeconds"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultWGCacheNegativeTTL * time.Second
+	}
+	return time.Duration(n) * time.Second
+}
+
+// SetResultMode is a setter of how query results are read, which is ResultModeAPI, ResultModeS3 or
+// ResultModeUnload.
+func (c *Config) SetResultMode(mode string) error {
+	switch mode {
+	case ResultModeAPI, ResultModeS3, ResultModeUnload:
+	default:
+		return ErrConfigResultMode
+	}
+	c.values.Set("resultMode", mode)
+	return nil
+}
+
+// GetResultMode is getter of resultMode. It is ResultModeAPI by default.
+func (c *Config) GetResultMode() string {
+	if mode := c.values.Get("resultMode"); mode != "" {
+		return mode
+	}
+	return ResultModeAPI
+}
+
+// SetS3ReadConcurrency is a setter of the number of parallel ranged GETs reading a query result from S3.
+func (c *Config) SetS3ReadConcurrency(n int) {
+	c.values.Set("s3ReadConcurrency", strconv.Itoa(n))
+}
+
+// GetS3ReadConcurrency is getter of s3ReadConcurrency.
+func (c *Config) GetS3ReadConcurrency() int {
+	n, err := strconv.Atoi(c.values.Get("s3ReadConcurrency"))
+	if err != nil || n <= 0 {
+		return DefaultS3ReadConcurrency
+	}
+	return n
+}
+
+// SetS3ReadPartSize is a setter of the number of bytes read from S3 by one ranged GET.
+func (c *Config) SetS3ReadPartSize(n int64) {
+	c.values.Set("s3ReadPartSize", strconv.FormatInt(n, 10))
+}
+
+// GetS3ReadPartSize is getter of s3ReadPartSize.
+func (c *Config) GetS3ReadPartSize() int64 {
+	n, err := strconv.ParseInt(c.values.Get("s3ReadPartSize"), 10, 64)
+	if err != nil || n <= 0 {
+		return DefaultS3ReadPartSize
+	}
+	return n
+}
+
+// SetResultPageSize is a setter of the maximum number of rows in a page of GetQueryResults. It is passed to
+// GetQueryResultsInput.MaxResults, which must be between 1 and MaxResultPageSize.
+func (c *Config) SetResultPageSize(n int) error {
+	if n < 1 || n > MaxResultPageSize {
+		return ErrConfigResultPageSize
+	}
+	c.values.Set("resultPageSize", strconv.Itoa(n))
+	return nil
+}
+
+// GetResultPageSize is getter of resultPageSize. 0 means MaxResults is not set and Athena decides the page size.
+func (c *Config) GetResultPageSize() int {
+	n, err := strconv.Atoi(c.values.Get("resultPageSize"))
+	if err != nil || n < 1 || n > MaxResultPageSize {
+		return 0
+	}
+	return n
+}
+
+// SetResultPrefetchDepth is a setter of the number of result pages fetched in the background ahead of Rows.Next.
+// 0 disables prefetching.
+func (c *Config) SetResultPrefetchDepth(n int) {
+	c.values.Set("resultPrefetchDepth", strconv.Itoa(n))
+}
+
+// GetResultPrefetchDepth is getter of resultPrefetchDepth.
+func (c *Config) GetResultPrefetchDepth() int {
+	n, err := strconv.Atoi(c.values.Get("resultPrefetchDepth"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SetResultCacheSize is a setter of the number of queries in the "memory" ResultCache.
+func (c *Config) SetResultCacheSize(n int) {
+	c.values.Set("resultCacheSize", strconv.Itoa(n))
+}
+
+// GetResultCacheSize is getter of resultCacheSize.
+func (c *Config) GetResultCacheSize() int {
+	n, err := strconv.Atoi(c.values.Get("resultCacheSize"))
+	if err != nil || n <= 0 {
+		return DefaultResultCacheSize
+	}
+	return n
+}
+
+// SetResultCacheDir is a setter of the directory of the "file" ResultCache.
+func (c *Config) SetResultCacheDir(dir string) {
+	c.values.Set("resultCacheDir", dir)
+}
+
+// GetResultCacheDir is getter of resultCacheDir. It is athenadriver in the temporary directory by default.
+func (c *Config) GetResultCacheDir() string {
+	if dir := c.values.Get("resultCacheDir"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "athenadriver")
+}
+
+// SetServerSidePrepare is to back every prepared statement with an Athena prepared statement in the workgroup.
+// https://docs.aws.amazon.com/athena/latest/ug/querying-with-prepared-statements.html
+func (c *Config) SetServerSidePrepare(b bool) {
+	if b {
+		c.values.Set("serverSidePrepare", "true")
+	} else {
+		c.values.Set("serverSidePrepare", "false")
+	}
+}
+
+// IsServerSidePrepareEnabled is to check if prepared statements are created in Athena.
+func (c *Config) IsServerSidePrepareEnabled() bool {
+	return c.values.Get("serverSidePrepare") == "true"
+}
+
+// SetKeepQueryDirectives is to keep the `-- athenadriver:` directive comments in the queries sent to Athena.
+// They are stripped by default.
+func (c *Config) SetKeepQueryDirectives(b bool) {
+	if b {
+		c.values.Set("keepQueryDirectives", "true")
+	} else {
+		c.values.Set("keepQueryDirectives", "false")
+	}
+}
+
+// IsKeepQueryDirectives is to check if directive comments are kept in queries.
+func (c *Config) IsKeepQueryDirectives() bool {
+	return c.values.Get("keepQueryDirectives") == "true"
+}
+
+// SetExactDecimal is to check decimal values and render them with the scale of their column, and to return the
+// decimals in ARRAY, MAP and ROW values as Decimal, which keeps their precision and scale, instead of strings.
+func (c *Config) SetExactDecimal(b bool) {
+	if b {
+		c.values.Set("exactDecimal", "true")
+	} else {
+		c.values.Set("exactDecimal", "false")
+	}
+}
+
+// IsExactDecimal is to check if decimal values are checked, and returned as Decimal in ARRAY, MAP and ROW values.
+func (c *Config) IsExactDecimal() bool {
+	return c.values.Get("exactDecimal") == "true"
+}
+
+// SetDecodeComplexTypes is to return ARRAY, MAP and ROW values as []interface{}, map[string]interface{} and
+// RowValue instead of their text rendering.
+func (c *Config) SetDecodeComplexTypes(b bool) {
+	if b {
+		c.values.Set("decodeComplexTypes", "true")
+	} else {
+		c.values.Set("decodeComplexTypes", "false")
+	}
+}
+
+// IsDecodeComplexTypes is to check if ARRAY, MAP and ROW values are decoded.
+func (c *Config) IsDecodeComplexTypes() bool {
+	return c.values.Get("decodeComplexTypes") == "true"
+}
+
 // SetWorkGroup is a setter of WorkGroup.
 func (c *Config) SetWorkGroup(w *Workgroup) error {
 	if w == nil {
@@ -302,6 +838,7 @@ func (c *Config) GetWorkgroup() Workgroup {
 			Config: GetDefaultWGConfig(),
 			Tags:   NewWGTags(),
 		}
+		wg.Config.ResultConfiguration = c.getWGResultConfiguration()
 		return wg
 	}
 	tags := strings.Split(tagString[1:], "|")
@@ -315,9 +852,19 @@ func (c *Config) GetWorkgroup() Workgroup {
 		Config: GetDefaultWGConfig(),
 		Tags:   t,
 	}
+	wg.Config.ResultConfiguration = c.getWGResultConfiguration()
 	return wg
 }
 
+// getWGResultConfiguration is to get the result configuration of a workgroup created remotely. The workgroup
+// enforces its configuration, so it only has one if encryption, the bucket owner or the ACL is set.
+func (c *Config) getWGResultConfiguration() *athena.ResultConfiguration {
+	if c.GetEncryptionOption() == "" && c.GetExpectedBucketOwner() == "" && c.GetS3ACLOption() == "" {
+		return nil
+	}
+	return c.GetResultConfiguration()
+}
+
 // IsMissingAsEmptyString return true if missing value is set to be returned as empty string.
 func (c *Config) IsMissingAsEmptyString() bool {
 	return c.values.Get("missingAsEmptyString") == "true"
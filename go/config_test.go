@@ -22,8 +22,12 @@ package athenadriver
 
 import (
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -333,3 +337,240 @@ func TestConfig_ResultPollIntervalDefault(t *testing.T) {
 	interval := testConf.GetResultPollIntervalSeconds()
 	assert.Equal(t, time.Second*time.Duration(PoolInterval), interval)
 }
+
+func TestConfig_GetPollStrategy(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, NewConstantPollStrategy(time.Second*time.Duration(PoolInterval)), testConf.GetPollStrategy())
+
+	testConf.SetResultPollInitialInterval(100 * time.Millisecond)
+	assert.Equal(t, NewBackoffPollStrategy(100*time.Millisecond, time.Second*time.Duration(PoolInterval),
+		DefaultPollBackoffFactor, 0), testConf.GetPollStrategy())
+
+	testConf.SetResultPollMaxInterval(1500 * time.Millisecond)
+	testConf.SetResultPollBackoffFactor(1.5)
+	testConf.SetResultPollJitter(0.2)
+	assert.Equal(t, NewBackoffPollStrategy(100*time.Millisecond, 1500*time.Millisecond, 1.5, 0.2),
+		testConf.GetPollStrategy())
+
+	dsn := "s3://bucket?region=us-east-1&resultPollInitialIntervalMs=50&resultPollBackoffFactor=0.5&resultPollJitter=-1"
+	testConf, err := NewConfig(dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, NewBackoffPollStrategy(50*time.Millisecond, time.Second*time.Duration(PoolInterval),
+		DefaultPollBackoffFactor, 0), testConf.GetPollStrategy())
+}
+
+func TestConfig_APIRetry(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, 0, testConf.GetAPIRetryBudget())
+	assert.Equal(t, DefaultAPIRetryBaseDelay*time.Millisecond, testConf.GetAPIRetryBaseDelay())
+	assert.Equal(t, DefaultAPIRetryMaxDelay*time.Millisecond, testConf.GetAPIRetryMaxDelay())
+
+	testConf.SetAPIRetryBudget(5)
+	testConf.SetAPIRetryBaseDelay(50 * time.Millisecond)
+	testConf.SetAPIRetryMaxDelay(2 * time.Second)
+	assert.Equal(t, 5, testConf.GetAPIRetryBudget())
+	assert.Equal(t, 50*time.Millisecond, testConf.GetAPIRetryBaseDelay())
+	assert.Equal(t, 2*time.Second, testConf.GetAPIRetryMaxDelay())
+
+	testConf.SetAPIRetryBudget(-1)
+	assert.Equal(t, 0, testConf.GetAPIRetryBudget())
+}
+
+func TestConfig_Resubmit(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, 0, testConf.GetResubmitMaxAttempts())
+	assert.Equal(t, DefaultResubmitDelay*time.Millisecond, testConf.GetResubmitDelay())
+	assert.Len(t, testConf.GetResubmitPatterns(), len(DefaultResubmitPatterns))
+
+	testConf.SetResubmitMaxAttempts(2)
+	testConf.SetResubmitDelay(10 * time.Second)
+	assert.Equal(t, 2, testConf.GetResubmitMaxAttempts())
+	assert.Equal(t, 10*time.Second, testConf.GetResubmitDelay())
+
+	assert.NotNil(t, testConf.SetResubmitPatterns([]string{"("}))
+	assert.Nil(t, testConf.SetResubmitPatterns([]string{"SlowDown", "HIVE_.*"}))
+	patterns := testConf.GetResubmitPatterns()
+	assert.Len(t, patterns, 2)
+	assert.Equal(t, "HIVE_.*", patterns[1].String())
+
+	dsn := "s3://bucket?region=us-east-1&resubmitMaxAttempts=3&resubmitPatterns=SlowDown&resubmitPatterns=("
+	testConf, err := NewConfig(dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, testConf.GetResubmitMaxAttempts())
+	assert.Len(t, testConf.GetResubmitPatterns(), 1)
+}
+
+func TestConfig_ResultReuse(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.False(t, testConf.IsResultReuseEnabled())
+	assert.Nil(t, testConf.GetResultReuseConfiguration())
+	assert.Equal(t, DefaultResultReuseMaxAge*time.Minute, testConf.GetResultReuseMaxAge())
+
+	testConf.SetResultReuse(true)
+	testConf.SetResultReuseMaxAge(90 * time.Minute)
+	assert.True(t, testConf.IsResultReuseEnabled())
+	assert.Equal(t, 90*time.Minute, testConf.GetResultReuseMaxAge())
+	assert.Equal(t, int64(90),
+		*testConf.GetResultReuseConfiguration().ResultReuseByAgeConfiguration.MaxAgeInMinutes)
+
+	testConf.SetResultReuseMaxAge(30 * 24 * time.Hour)
+	assert.Equal(t, MaxResultReuseMaxAge*time.Minute, testConf.GetResultReuseMaxAge())
+
+	testConf.SetResultReuse(false)
+	assert.False(t, testConf.IsResultReuseEnabled())
+}
+
+func TestConfig_ResultCache(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, "", testConf.GetResultCache())
+	assert.Equal(t, DefaultResultCacheTTL*time.Second, testConf.GetResultCacheTTL())
+	assert.Equal(t, DefaultResultCacheSize, testConf.GetResultCacheSize())
+	assert.Equal(t, filepath.Join(os.TempDir(), "athenadriver"), testConf.GetResultCacheDir())
+
+	testConf.SetResultCache("file")
+	testConf.SetResultCacheTTL(10 * time.Minute)
+	testConf.SetResultCacheSize(20)
+	testConf.SetResultCacheDir("/var/cache/athenadriver")
+	assert.Equal(t, "file", testConf.GetResultCache())
+	assert.Equal(t, 10*time.Minute, testConf.GetResultCacheTTL())
+	assert.Equal(t, 20, testConf.GetResultCacheSize())
+	assert.Equal(t, "/var/cache/athenadriver", testConf.GetResultCacheDir())
+}
+
+func TestConfig_Catalog(t *testing.T) {
+	testConf, err := NewConfig("s3://bucket?region=us-east-1&catalog=lambda_catalog")
+	assert.Nil(t, err)
+	assert.Equal(t, "lambda_catalog", testConf.GetCatalog())
+
+	testConf = NewNoOpsConfig()
+	assert.Equal(t, "", testConf.GetCatalog())
+	testConf.SetCatalog("glue_catalog")
+	assert.Equal(t, "glue_catalog", testConf.GetCatalog())
+}
+
+func TestConfig_ResultConfiguration(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := testConf.GetResultConfiguration()
+	assert.Equal(t, testConf.GetOutputBucket(), aws.StringValue(r.OutputLocation))
+	assert.Nil(t, r.EncryptionConfiguration)
+	assert.Nil(t, r.ExpectedBucketOwner)
+	assert.Nil(t, r.AclConfiguration)
+
+	assert.Equal(t, ErrConfigEncryptionOption, testConf.SetEncryption("AES", ""))
+	assert.Equal(t, ErrConfigKMSKeyRequired, testConf.SetEncryption(athena.EncryptionOptionSseKms, ""))
+	assert.Equal(t, ErrConfigS3ACLOption, testConf.SetS3ACLOption("PUBLIC_READ"))
+	assert.Nil(t, testConf.SetEncryption(athena.EncryptionOptionCseKms, "arn:aws:kms:us-east-1:123456789012:key/k"))
+	assert.Nil(t, testConf.SetS3ACLOption(athena.S3AclOptionBucketOwnerFullControl))
+	testConf.SetExpectedBucketOwner("123456789012")
+
+	r = testConf.GetResultConfiguration()
+	assert.Equal(t, athena.EncryptionOptionCseKms, aws.StringValue(r.EncryptionConfiguration.EncryptionOption))
+	assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/k", aws.StringValue(r.EncryptionConfiguration.KmsKey))
+	assert.Equal(t, "123456789012", aws.StringValue(r.ExpectedBucketOwner))
+	assert.Equal(t, athena.S3AclOptionBucketOwnerFullControl, aws.StringValue(r.AclConfiguration.S3AclOption))
+	assert.Equal(t, r, testConf.GetWorkgroup().Config.ResultConfiguration)
+
+	s := testConf.SafeStringify()
+	assert.Contains(t, s, "encryptionOption=CSE_KMS&expectedBucketOwner=*&kmsKey=*&")
+	assert.Contains(t, s, "s3AclOption=BUCKET_OWNER_FULL_CONTROL")
+	assert.NotContains(t, s, "123456789012")
+
+	// SSE_S3 doesn't use a KMS key
+	assert.Nil(t, testConf.SetEncryption(athena.EncryptionOptionSseS3, "ignored"))
+	assert.Equal(t, "", testConf.GetKMSKey())
+	r = testConf.GetResultConfiguration()
+	assert.Equal(t, athena.EncryptionOptionSseS3, aws.StringValue(r.EncryptionConfiguration.EncryptionOption))
+	assert.Nil(t, r.EncryptionConfiguration.KmsKey)
+
+	testConf, err := NewConfig("s3://bucket/path?region=us-east-1&encryptionOption=SSE_KMS&kmsKey=alias%2Fk" +
+		"&expectedBucketOwner=123456789012&s3AclOption=BUCKET_OWNER_FULL_CONTROL")
+	assert.Nil(t, err)
+	assert.Equal(t, athena.EncryptionOptionSseKms, testConf.GetEncryptionOption())
+	assert.Equal(t, "alias/k", testConf.GetKMSKey())
+	assert.Equal(t, "123456789012", testConf.GetExpectedBucketOwner())
+	assert.Equal(t, athena.S3AclOptionBucketOwnerFullControl, testConf.GetS3ACLOption())
+
+	// the options of a DSN are checked like by their setters
+	_, err = NewConfig("s3://bucket/path?region=us-east-1&encryptionOption=SSE-KMS&kmsKey=alias%2Fk")
+	assert.Equal(t, ErrConfigEncryptionOption, err)
+	_, err = NewConfig("s3://bucket/path?region=us-east-1&encryptionOption=CSE_KMS")
+	assert.Equal(t, ErrConfigKMSKeyRequired, err)
+	_, err = NewConfig("s3://bucket/path?region=us-east-1&s3AclOption=BUCKET_OWNER_READ")
+	assert.Equal(t, ErrConfigS3ACLOption, err)
+}
+
+func TestConfig_GetWorkgroup_ResultConfiguration(t *testing.T) {
+	// a workgroup enforces its configuration, so it has none without encryption, bucket owner or ACL options
+	testConf, err := NewConfig("s3://bucket/path?region=us-east-1&workgroupName=wg")
+	assert.Nil(t, err)
+	assert.Nil(t, testConf.GetWorkgroup().Config.ResultConfiguration)
+	testConf, err = NewConfig("s3://bucket/path?region=us-east-1&workgroupName=wg&tag=%7Ca%60b")
+	assert.Nil(t, err)
+	assert.Nil(t, testConf.GetWorkgroup().Config.ResultConfiguration)
+
+	for _, set := range []func(c *Config){
+		func(c *Config) { _ = c.SetEncryption(athena.EncryptionOptionSseS3, "") },
+		func(c *Config) { c.SetExpectedBucketOwner("123456789012") },
+		func(c *Config) { _ = c.SetS3ACLOption(athena.S3AclOptionBucketOwnerFullControl) },
+	} {
+		testConf = NewNoOpsConfig()
+		set(testConf)
+		assert.Equal(t, testConf.GetResultConfiguration(), testConf.GetWorkgroup().Config.ResultConfiguration)
+	}
+}
+
+func TestConfig_KeepQueryDirectives(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.False(t, testConf.IsKeepQueryDirectives())
+	testConf.SetKeepQueryDirectives(true)
+	assert.True(t, testConf.IsKeepQueryDirectives())
+	testConf.SetKeepQueryDirectives(false)
+	assert.False(t, testConf.IsKeepQueryDirectives())
+}
+
+func TestConfig_WGCacheTTL(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, DefaultWGCacheTTL*time.Second, testConf.GetWGCacheTTL())
+	assert.Equal(t, DefaultWGCacheNegativeTTL*time.Second, testConf.GetWGCacheNegativeTTL())
+
+	testConf.SetWGCacheTTL(time.Minute)
+	testConf.SetWGCacheNegativeTTL(0)
+	assert.Equal(t, time.Minute, testConf.GetWGCacheTTL())
+	assert.Equal(t, time.Duration(0), testConf.GetWGCacheNegativeTTL())
+}
+
+func TestConfig_ResultMode(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, ResultModeAPI, testConf.GetResultMode())
+	assert.Equal(t, DefaultS3ReadConcurrency, testConf.GetS3ReadConcurrency())
+	assert.Equal(t, int64(DefaultS3ReadPartSize), testConf.GetS3ReadPartSize())
+
+	assert.Nil(t, testConf.SetResultMode(ResultModeS3))
+	assert.Equal(t, ResultModeS3, testConf.GetResultMode())
+	assert.Equal(t, ErrConfigResultMode, testConf.SetResultMode("parquet"))
+	assert.Equal(t, ResultModeS3, testConf.GetResultMode())
+	assert.Nil(t, testConf.SetResultMode(ResultModeUnload))
+	assert.Equal(t, ResultModeUnload, testConf.GetResultMode())
+
+	testConf.SetS3ReadConcurrency(16)
+	testConf.SetS3ReadPartSize(1024)
+	assert.Equal(t, 16, testConf.GetS3ReadConcurrency())
+	assert.Equal(t, int64(1024), testConf.GetS3ReadPartSize())
+}
+
+func TestConfig_ResultPrefetch(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, 0, testConf.GetResultPageSize())
+	assert.Equal(t, 0, testConf.GetResultPrefetchDepth())
+
+	assert.Nil(t, testConf.SetResultPageSize(500))
+	assert.Equal(t, 500, testConf.GetResultPageSize())
+	assert.Equal(t, ErrConfigResultPageSize, testConf.SetResultPageSize(0))
+	assert.Equal(t, ErrConfigResultPageSize, testConf.SetResultPageSize(MaxResultPageSize+1))
+	assert.Equal(t, 500, testConf.GetResultPageSize())
+
+	testConf.SetResultPrefetchDepth(4)
+	assert.Equal(t, 4, testConf.GetResultPrefetchDepth())
+	testConf.SetResultPrefetchDepth(-1)
+	assert.Equal(t, 0, testConf.GetResultPrefetchDepth())
+}
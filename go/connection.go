@@ -24,9 +24,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
-	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
@@ -39,14 +37,15 @@ import (
 	"github.com/aws/aws-sdk-go/service/athena"
 )
 
-// timestampFormatDriverMicro is the string format we transform Go time.Time objects into. This is not meant for
-// TIMESTAMP columns, as Athena timestamp columns only have a millisecond granularity.
-const timestampFormatDriverMicro = "2006-01-02 15:04:05.000000"
+// timestampFormatDriver is the format of the TIMESTAMP literals we transform Go time.Time objects into. Athena
+// timestamps have a millisecond granularity.
+const timestampFormatDriver = "2006-01-02 15:04:05.000"
 
 // Connection is a connection to AWS Athena. It is not used concurrently by multiple goroutines.
 // Connection is assumed to be stateful.
 type Connection struct {
 	athenaAPI athenaiface.AthenaAPI
+	s3Reader  S3Reader
 	connector *SQLConnector
 	numInput  int
 }
@@ -55,171 +54,66 @@ type Connection struct {
 func (c *Connection) buildExecutionParams(args []driver.Value) ([]*string, error) {
 	executionParams := []*string{}
 	for _, arg := range args {
-		if arg == nil {
-			val := "NULL"
-			executionParams = append(executionParams, aws.String(val))
-			continue
-		}
-		// type switches of arg to handle different query parameter types
-		val := ""
-		switch v := arg.(type) {
-		case int64:
-			val = strconv.FormatInt(v, 10)
-		case uint64:
-			val = strconv.FormatUint(v, 10)
-		case float64:
-			val = strconv.FormatFloat(v, 'g', -1, 64)
-		case bool:
-			if v {
-				val = "1"
-			} else {
-				val = "0"
-			}
-		case time.Time:
-			// Note: time.Time objects are transformed into strings for a STRING/CHAR/VARCHAR type column.
-			// To maintain compatibility with the current interpolateParams() behavior, this function produces a string
-			// up to microsecond granularity, which Athena does not support in TIMESTAMP columns (up to milliseconds).
-			// For DATE/TIME/TIMESTAMP, it is better to pass in string arguments with a typecast. Refer to the string
-			// case below.
-			// Matches interpolateParams() behavior.
-			val = "'0000-00-00'" // Special-cased.
-			if !v.IsZero() {
-				v := v.In(time.UTC)
-				v = v.Add(time.Nanosecond * 500) // To round under microsecond
-				dateFormat := timestampFormatDriverMicro
-				if v.Nanosecond()/1000 == 0 {
-					// Omit microseconds if that part is zero
-					dateFormat = time.DateTime
-				}
-				val = fmt.Sprintf("'%s'", v.Format(dateFormat))
-			}
-		case []byte:
-			// Note: Different from interpolateParams() behavior.
-			// Like the string case below, enclosing in single quotes would prevent typecasting or function calls in
-			// execution parameters. Prior to passing in query arguments, Format* functions in utils.go can be used.
-			val = string(v)
-		case string:
+		if v, ok := arg.(string); ok {
 			// Note: Different from interpolateParams() behavior.
 			// For parameterized queries, typecasting or function calls go in the execution parameters. For example,
 			// `WHERE created = TIMESTAMP '2024-07-01 00:00:00'` should be formatted as: `WHERE created = ?` (query) and
 			// `TIMESTAMP '2024-07-01 00:00:00.000'` (arg). Therefore, we cannot simply enclose the full string with
 			// single quotes here. Users should use the Format* functions in utils.go to format input string arguments.
-			val = v
-		default:
-			return []*string{}, ErrQueryUnknownType
+			executionParams = append(executionParams, aws.String(v))
+			continue
 		}
-		executionParams = append(executionParams, aws.String(val))
+		// Other types are rendered as Athena literals, like interpolateParams() does.
+		val, err := appendSQLLiteral([]byte{}, arg)
+		if err != nil {
+			return []*string{}, err
+		}
+		executionParams = append(executionParams, aws.String(string(val)))
 	}
 	return executionParams, nil
 }
 
 func (c *Connection) interpolateParams(query string, args []driver.Value) (string, error) {
 	c.numInput = len(args)
-	// Number of ? should be same to len(args)
-	if strings.Count(query, "?") != c.numInput {
+	// Number of ? should be same to len(args). A ? in a string literal, quoted identifier or comment doesn't count.
+	placeholders := placeholderPositions(query)
+	if len(placeholders) != c.numInput {
 		return "", ErrInvalidQuery
 	}
 
 	queryBuffer := make([]byte, MAXQueryStringLength)
 	queryBuffer = queryBuffer[:0]
-	argPos := 0
-
-	for i := 0; i < len(query); i++ {
-		q := strings.IndexByte(query[i:], '?')
-		if q == -1 {
-			queryBuffer = append(queryBuffer, query[i:]...)
-			break
-		}
-		queryBuffer = append(queryBuffer, query[i:i+q]...)
-		i += q
+	last := 0
 
-		arg := args[argPos]
-		argPos++
+	for argPos, q := range placeholders {
+		queryBuffer = append(queryBuffer, query[last:q]...)
+		last = q + 1
 
-		if arg == nil {
-			queryBuffer = append(queryBuffer, "NULL"...)
-			continue
-		}
-		// type switches of arg to handle different query parameter types
-		switch v := arg.(type) {
-		case int64:
-			queryBuffer = strconv.AppendInt(queryBuffer, v, 10)
-		case uint64:
-			queryBuffer = strconv.AppendUint(queryBuffer, v, 10)
-		case float64:
-			queryBuffer = strconv.AppendFloat(queryBuffer, v, 'g', -1, 64)
-		case bool:
-			if v {
-				queryBuffer = append(queryBuffer, '1')
-			} else {
-				queryBuffer = append(queryBuffer, '0')
-			}
-		case time.Time:
-			if v.IsZero() {
-				queryBuffer = append(queryBuffer, "'0000-00-00'"...)
-			} else {
-				v := v.In(time.UTC)
-				v = v.Add(time.Nanosecond * 500) // To round under microsecond
-				year := v.Year()
-				year100 := year / 100
-				year1 := year % 100
-				month := v.Month()
-				day := v.Day()
-				hour := v.Hour()
-				minute := v.Minute()
-				second := v.Second()
-				micro := v.Nanosecond() / 1000
-
-				queryBuffer = append(queryBuffer, []byte{
-					'\'',
-					digits10[year100], digits01[year100],
-					digits10[year1], digits01[year1],
-					'-',
-					digits10[month], digits01[month],
-					'-',
-					digits10[day], digits01[day],
-					' ',
-					digits10[hour], digits01[hour],
-					':',
-					digits10[minute], digits01[minute],
-					':',
-					digits10[second], digits01[second],
-				}...)
-
-				if micro != 0 {
-					micro10000 := micro / 10000
-					micro100 := micro / 100 % 100
-					micro1 := micro % 100
-					queryBuffer = append(queryBuffer, []byte{
-						'.',
-						digits10[micro10000], digits01[micro10000],
-						digits10[micro100], digits01[micro100],
-						digits10[micro1], digits01[micro1],
-					}...)
-				}
-				queryBuffer = append(queryBuffer, '\'')
-			}
-		case []byte:
-			queryBuffer = append(queryBuffer, "_binary'"...)
-			queryBuffer = escapeBytesBackslash(queryBuffer, v)
-			queryBuffer = append(queryBuffer, '\'')
-		case string:
-			queryBuffer = append(queryBuffer, '\'')
-			queryBuffer = escapeStringBackslash(queryBuffer, v)
-			queryBuffer = append(queryBuffer, '\'')
-		default:
-			return "", ErrQueryUnknownType
+		var err error
+		queryBuffer, err = appendSQLLiteral(queryBuffer, args[argPos])
+		if err != nil {
+			return "", err
 		}
 
 		if len(queryBuffer)+4 > 10*MAXQueryStringLength {
 			return "", ErrQueryBufferOF
 		}
 	}
+	queryBuffer = append(queryBuffer, query[last:]...)
 	return string(queryBuffer), nil
 }
 
 // CheckNamedValue is to implement interface driver.NamedValueChecker.
+// Slices, arrays, maps and structs are accepted as they are, and passed as ARRAY, MAP and ROW literals.
 func (c *Connection) CheckNamedValue(nv *driver.NamedValue) (err error) {
+	if isCompositeValue(nv.Value) {
+		return nil
+	}
+	// Decimal is kept to be rendered as a DECIMAL literal instead of the string of its Value.
+	if d, ok := decimalValue(nv.Value); ok {
+		nv.Value = d
+		return nil
+	}
 	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(nv.Value)
 	return
 }
@@ -227,7 +121,14 @@ func (c *Connection) CheckNamedValue(nv *driver.NamedValue) (err error) {
 // ExecContext executes a query that doesn't return rows, such as an INSERT or UPDATE.
 func (c *Connection) ExecContext(ctx context.Context, query string, namedArgs []driver.NamedValue) (driver.Result, error) {
 	var obs = c.connector.tracer
-	var err error
+	query, namedArgs, err := bindNamedArgs(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
+	query, namedArgs, err = expandInLists(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
 	args := namedValueToValue(namedArgs)
 	if len(namedArgs) > 0 {
 		query, err = c.interpolateParams(query, args)
@@ -243,6 +144,11 @@ func (c *Connection) ExecContext(ctx context.Context, query string, namedArgs []
 	if err != nil {
 		return nil, err
 	}
+	return newExecResult(rows), nil
+}
+
+// newExecResult is to build the driver.Result of a statement from its result set.
+func newExecResult(rows driver.Rows) driver.Result {
 	var rowAffected int64 = 0
 	r := rows.(*Rows)
 	if r != nil && r.ResultOutput != nil && r.ResultOutput.UpdateCount != nil {
@@ -253,26 +159,18 @@ func (c *Connection) ExecContext(ctx context.Context, query string, namedArgs []
 		lastInsertedID: lastInsertedID,
 		rowAffected:    rowAffected,
 	}
-	return result, nil
+	return result
 }
 
-func (c *Connection) cachedQuery(ctx context.Context, QID string) (driver.Rows, error) {
-	if c.connector.config.IsMoneyWise() {
-		dataScanned := int64(0)
-		printCost(&athena.GetQueryExecutionOutput{
-			QueryExecution: &athena.QueryExecution{
-				QueryExecutionId: &QID,
-				Statistics: &athena.QueryExecutionStatistics{
-					DataScannedInBytes: &dataScanned,
-				},
-			},
-		})
-	}
-	wg := c.connector.config.GetWorkgroup()
-	if wg.Name == "" {
-		wg.Name = DefaultWGName
+// cachedQuery is to get the result of a query by its query execution ID. If the query is still running,
+// it waits for the query to finish the same way as QueryContext does for a new query.
+func (c *Connection) cachedQuery(ctx context.Context, QID string, wgName string) (driver.Rows, error) {
+	h := attachQueryHandle(c.athenaAPI, c.connector.config, c.connector.tracer, c.connector.poll, QID, wgName)
+	h.s3Reader = c.s3Reader
+	if err := h.wait(ctx, true); err != nil {
+		return nil, err
 	}
-	return NewRows(ctx, c.athenaAPI, QID, c.connector.config, c.connector.tracer)
+	return h.newRows(ctx)
 }
 
 func (c *Connection) getHeaderlessSingleRowResultPage(ctx context.Context, qid string) (driver.Rows, error) {
@@ -297,6 +195,22 @@ func (c *Connection) getHeaderlessSingleRowResultPage(ctx context.Context, qid s
 // With QueryContext implemented, we don't need Queryer.
 // QueryerContext must honor the context timeout and return when the context is canceled.
 func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs []driver.NamedValue) (driver.Rows, error) {
+	return c.queryContext(ctx, query, namedArgs, "")
+}
+
+// queryContext implements QueryContext. If preparedName is not empty, query is run by executing the Athena
+// prepared statement of this name with namedArgs as its parameters.
+func (c *Connection) queryContext(ctx context.Context, query string, namedArgs []driver.NamedValue,
+	preparedName string) (driver.Rows, error) {
+	ctx, query, err := applyQueryDirectives(ctx, query, c.connector.config.IsKeepQueryDirectives())
+	if err != nil {
+		return nil, err
+	}
+	// the rest of the call uses the overrides in ctx, like WithWorkgroup
+	c, err = c.withContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var obs = c.connector.tracer
 	var pseudoCommand = ""
 	if strings.HasPrefix(query, "pc:") {
@@ -313,62 +227,31 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 			return nil, fmt.Errorf("pseudo command " + query + "doesn't exist")
 		}
 	}
-	if c.connector.config.IsReadOnly() {
-		if !isReadOnlyStatement(query) {
-			obs.Scope().Counter(DriverName + ".failure.querycontext.writeviolation").Inc(1)
-			obs.Log(WarnLevel, "write db violation", zap.String("query", query))
-			return nil, fmt.Errorf("writing to Athena database is disallowed in read-only mode")
-		}
-	}
 	now := time.Now()
-	args := namedValueToValue(namedArgs)
-	queryWithPlaceholders := query // For parameterized queries
-	var err error
-	if len(namedArgs) > 0 {
-		query, err = c.interpolateParams(query, args)
+	query, namedArgs, err = bindNamedArgs(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
+	if preparedName == "" {
+		// the query of a server-side prepared statement can't change
+		query, namedArgs, err = expandInLists(query, namedArgs)
 		if err != nil {
 			return nil, err
 		}
-		obs.Scope().Counter(DriverName + ".prepared.querycontext").Inc(1)
 	}
-	if !isQueryValid(query) {
-		return nil, ErrInvalidQuery
+	queryWithPlaceholders := query // For parameterized queries
+	query, executionParams, err := c.prepareQuery(query, namedArgs)
+	if err != nil {
+		return nil, err
 	}
-	wg := c.connector.config.GetWorkgroup()
-	if wg.Name == "" {
-		wg.Name = DefaultWGName
-	} else if wg.Name != DefaultWGName {
-		athenaWG, err := getWG(ctx, c.athenaAPI, wg.Name)
-		if err != nil {
-			obs.Scope().Counter(DriverName + ".failure.querycontext.getwg").Inc(1)
-			obs.Log(WarnLevel, "Didn't find workgroup "+wg.Name+" due to: "+err.Error())
-			if reqerr, ok := err.(awserr.RequestFailure); !ok || reqerr.Message() != "WorkGroup is not found." {
-				return nil, err
-			}
-			if c.connector.config.IsWGRemoteCreationAllowed() {
-				err = wg.CreateWGRemotely(c.athenaAPI)
-				if err != nil {
-					obs.Scope().Counter(DriverName + ".failure.querycontext.createwgremotely").Inc(1)
-					return nil, err
-				}
-				obs.Log(DebugLevel, "workgroup "+wg.Name+" is created successfully.")
-			} else {
-				obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is used for "+wg.Name+".")
-				return nil,
-					fmt.Errorf("workgroup %q doesn't exist and workgroup remote creation is disabled, due to: %v", wg.Name, err.Error())
-			}
-		} else {
-			if *athenaWG.State != athena.WorkGroupStateEnabled {
-				obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is disabled.")
-				obs.Scope().Counter(DriverName + ".failure.querycontext.wgdisabled").Inc(1)
-				return nil, fmt.Errorf("workgroup %q is disabled", wg.Name)
-			}
-			obs.Log(DebugLevel, "workgroup "+DefaultWGName+" is enabled.")
-		}
+	if len(namedArgs) > 0 {
+		obs.Scope().Counter(DriverName + ".prepared.querycontext").Inc(1)
+	}
+	wgName, err := c.checkWorkgroup(ctx)
+	if err != nil {
+		return nil, err
 	}
-
 	timeWorkgroup := time.Since(now)
-	startOfStartQueryExecution := time.Now()
 	obs.Scope().Timer(DriverName + ".query.workgroup").Record(timeWorkgroup)
 
 	// case 1 - query directly using QID
@@ -379,7 +262,7 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 			})
 			if err != nil {
 				obs.Log(ErrorLevel, "GetQueryExecutionWithContext failed",
-					zap.String("workgroup", wg.Name),
+					zap.String("workgroup", wgName),
 					zap.String("queryID", query),
 					zap.String("error", err.Error()))
 				obs.Scope().Counter(DriverName + ".failure.querycontext.getqueryexecutionwithcontext").Inc(1)
@@ -393,7 +276,7 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 			})
 			if err != nil {
 				obs.Log(ErrorLevel, "StopQueryExecution failed",
-					zap.String("workgroup", wg.Name),
+					zap.String("workgroup", wgName),
 					zap.String("queryID", query),
 					zap.String("query", query))
 				obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.failed").Inc(1)
@@ -401,25 +284,45 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 			}
 			return c.getHeaderlessSingleRowResultPage(ctx, "OK")
 		}
-		return c.cachedQuery(ctx, query)
+		return c.cachedQuery(ctx, query, wgName)
 	}
 
-	//  case 2 - TODO
-	executionParams, err := c.buildExecutionParams(args)
-	if err != nil {
-		return nil, err
+	// case 2 - read the result of the same query run before
+	cacheKey := ""
+	cache := c.connector.resultCache()
+	if preparedName == "" && pseudoCommand == "" {
+		ctx = c.withUnload(ctx, query)
 	}
-	resp, err := c.athenaAPI.StartQueryExecution(&athena.StartQueryExecutionInput{
-		QueryString:         aws.String(queryWithPlaceholders),
-		ExecutionParameters: executionParams,
-		QueryExecutionContext: &athena.QueryExecutionContext{
-			Database: aws.String(c.connector.config.GetDB()),
-		},
-		ResultConfiguration: &athena.ResultConfiguration{
-			OutputLocation: aws.String(c.connector.config.GetOutputBucket()),
-		},
-		WorkGroup: aws.String(wg.Name),
-	})
+	_, unload := ctx.Value(unloadKey).(bool)
+	// the files written by UNLOAD are removed after they are read, so the result can't be read again
+	if cache != nil && !unload && pseudoCommand == "" && isResultCacheEnabled(ctx) && isCacheableQuery(query) {
+		db := c.connector.config.GetDB()
+		if catalog := queryCatalog(ctx, c.connector.config); catalog != "" {
+			db = catalog + "." + db
+		}
+		cacheKey = resultCacheKey(queryWithPlaceholders, db, wgName, executionParams)
+		if QID, ok := cache.Get(cacheKey); ok {
+			rows, err := c.cachedQuery(ctx, QID, wgName)
+			if err == nil {
+				obs.Scope().Counter(DriverName + ".resultcache.hit").Inc(1)
+				return rows, nil
+			}
+			// e.g. the result was removed from the output bucket
+			obs.Log(WarnLevel, "cached query result is not available",
+				zap.String("workgroup", wgName),
+				zap.String("queryID", QID),
+				zap.String("error", err.Error()))
+			cache.Delete(cacheKey)
+		}
+		obs.Scope().Counter(DriverName + ".resultcache.miss").Inc(1)
+	}
+
+	// case 3 - submit a new query and wait for its result
+	statement := queryWithPlaceholders
+	if preparedName != "" {
+		statement = "EXECUTE " + preparedName
+	}
+	h, err := c.startQueryExecution(ctx, statement, executionParams, wgName)
 	if err != nil {
 		if pseudoCommand == PCGetQID {
 			if reqerr, ok := err.(awserr.RequestFailure); ok {
@@ -428,100 +331,229 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 		}
 		return nil, err
 	}
+	if pseudoCommand == PCGetQID {
+		return c.getHeaderlessSingleRowResultPage(ctx, h.queryID)
+	}
+	h, err = c.waitAndResubmit(ctx, h, statement, executionParams, wgName)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := h.newRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cacheKey != "" {
+		cache.Set(cacheKey, h.queryID)
+	}
+	return rows, nil
+}
 
-	timeStartQueryExecution := time.Since(startOfStartQueryExecution)
-	now = time.Now()
-	obs.Scope().Timer(DriverName + ".query.startqueryexecution").Record(timeStartQueryExecution)
+// StartQuery submits a query to Athena and returns without waiting for the query to finish.
+// The returned QueryHandle is used to poll the status, wait for and fetch the result of the
+// query later. If query is a query execution ID, the handle is attached to that query instead.
+//
+// StartQuery can be reached from a *sql.Conn through sql.Conn.Raw.
+func (c *Connection) StartQuery(ctx context.Context, query string, namedArgs []driver.NamedValue) (QueryHandle, error) {
+	ctx, query, err := applyQueryDirectives(ctx, query, c.connector.config.IsKeepQueryDirectives())
+	if err != nil {
+		return nil, err
+	}
+	c, err = c.withContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var obs = c.connector.tracer
+	for i := range namedArgs {
+		if err := c.CheckNamedValue(&namedArgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	query, namedArgs, err = bindNamedArgs(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
+	query, namedArgs, err = expandInLists(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
+	queryWithPlaceholders := query
+	query, executionParams, err := c.prepareQuery(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
+	wgName, err := c.checkWorkgroup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	obs.Scope().Timer(DriverName + ".query.workgroup").Record(time.Since(now))
+	if IsQID(query) {
+		h := attachQueryHandle(c.athenaAPI, c.connector.config, obs, c.connector.poll, query, wgName)
+		h.s3Reader = c.s3Reader
+		return h, nil
+	}
+	h, err := c.startQueryExecution(c.withUnload(ctx, query), queryWithPlaceholders, executionParams, wgName)
+	if err != nil {
+		return nil, err
+	}
+	obs.Scope().Counter(DriverName + ".startquery").Inc(1)
+	return h, nil
+}
 
-	queryID := *resp.QueryExecutionId
-	if pseudoCommand == PCGetQID {
-		return c.getHeaderlessSingleRowResultPage(ctx, queryID)
-	}
-WAITING_FOR_RESULT:
-	for {
-		pollInterval := c.connector.config.GetResultPollIntervalSeconds()
-		statusResp, err := c.athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
-			QueryExecutionId: aws.String(queryID),
-		})
+// prepareQuery checks if a query is allowed and valid. It returns the query with its arguments
+// interpolated, and the arguments as execution parameters of a parameterized query.
+func (c *Connection) prepareQuery(query string, namedArgs []driver.NamedValue) (string, []*string, error) {
+	var obs = c.connector.tracer
+	if c.connector.config.IsReadOnly() {
+		if !isReadOnlyStatement(query) {
+			obs.Scope().Counter(DriverName + ".failure.querycontext.writeviolation").Inc(1)
+			obs.Log(WarnLevel, "write db violation", zap.String("query", query))
+			return "", nil, fmt.Errorf("writing to Athena database is disallowed in read-only mode")
+		}
+	}
+	args := namedValueToValue(namedArgs)
+	var err error
+	if len(namedArgs) > 0 {
+		query, err = c.interpolateParams(query, args)
 		if err != nil {
-			obs.Log(ErrorLevel, "GetQueryExecutionWithContext failed",
-				zap.String("workgroup", wg.Name),
-				zap.String("queryID", queryID),
-				zap.String("error", err.Error()))
-			obs.Scope().Counter(DriverName + ".failure.querycontext.getqueryexecutionwithcontext").Inc(1)
-			return nil, err
+			return "", nil, err
 		}
-		//statementType = statusResp.QueryExecution.StatementType
-		switch *statusResp.QueryExecution.Status.State {
-		case athena.QueryExecutionStateCancelled:
-			timeCanceled := time.Since(now)
-			obs.Log(ErrorLevel, "QueryExecutionStateCancelled",
-				zap.String("workgroup", wg.Name),
-				zap.String("queryID", queryID))
-			obs.Scope().Timer(DriverName + ".query.canceled").Record(timeCanceled)
-			if c.connector.config.IsMoneyWise() {
-				printCost(statusResp)
+	}
+	if !isQueryValid(query) {
+		return "", nil, ErrInvalidQuery
+	}
+	executionParams, err := c.buildExecutionParams(args)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, executionParams, nil
+}
+
+// checkWorkgroup makes sure the workgroup in Config exists and is enabled, and returns its name.
+// If the workgroup doesn't exist, it is created when remote creation is allowed.
+func (c *Connection) checkWorkgroup(ctx context.Context) (string, error) {
+	var obs = c.connector.tracer
+	wg := c.connector.config.GetWorkgroup()
+	if wg.Name == "" {
+		wg.Name = DefaultWGName
+	} else if wg.Name != DefaultWGName {
+		athenaWG, err := c.getWorkgroup(ctx, wg.Name)
+		if err != nil {
+			obs.Scope().Counter(DriverName + ".failure.querycontext.getwg").Inc(1)
+			obs.Log(WarnLevel, "Didn't find workgroup "+wg.Name+" due to: "+err.Error())
+			if !isWGNotFoundError(err) {
+				return "", err
 			}
-			return nil, context.Canceled
-		case athena.QueryExecutionStateFailed:
-			reason := *statusResp.QueryExecution.Status.StateChangeReason
-			timeQueryExecutionStateFailed := time.Since(now)
-			obs.Log(ErrorLevel, "QueryExecutionStateFailed",
-				zap.String("workgroup", wg.Name),
-				zap.String("queryID", queryID),
-				zap.String("reason", reason))
-			obs.Scope().Timer(DriverName + ".query.queryexecutionstatefailed").Record(timeQueryExecutionStateFailed)
-			return nil, errors.New(reason)
-		case athena.QueryExecutionStateSucceeded:
-			if c.connector.config.IsMoneyWise() {
-				printCost(statusResp)
+			if c.connector.config.IsWGRemoteCreationAllowed() {
+				err = wg.CreateWGRemotely(c.athenaAPI)
+				if err != nil {
+					obs.Scope().Counter(DriverName + ".failure.querycontext.createwgremotely").Inc(1)
+					return "", err
+				}
+				c.connector.workgroupCache().invalidate(wg.Name)
+				obs.Log(DebugLevel, "workgroup "+wg.Name+" is created successfully.")
+			} else {
+				obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is used for "+wg.Name+".")
+				return "",
+					fmt.Errorf("workgroup %q doesn't exist and workgroup remote creation is disabled, due to: %v", wg.Name, err.Error())
 			}
-			timeQueryExecutionStateSucceeded := time.Since(now)
-			obs.Scope().Timer(DriverName + ".query.queryexecutionstatesucceeded").Record(timeQueryExecutionStateSucceeded)
-			break WAITING_FOR_RESULT
-		// for athena.QueryExecutionStateQueued and athena.QueryExecutionStateRunning
-		default:
+		} else {
+			if *athenaWG.State != athena.WorkGroupStateEnabled {
+				obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is disabled.")
+				obs.Scope().Counter(DriverName + ".failure.querycontext.wgdisabled").Inc(1)
+				return "", fmt.Errorf("workgroup %q is disabled", wg.Name)
+			}
+			obs.Log(DebugLevel, "workgroup "+DefaultWGName+" is enabled.")
 		}
+	}
+	return wg.Name, nil
+}
 
-		select {
-		case <-ctx.Done():
-			_, err := c.athenaAPI.
-				StopQueryExecutionWithContext(context.Background(), &athena.StopQueryExecutionInput{
-					QueryExecutionId: aws.String(queryID),
-				})
+// getWorkgroup is to get a workgroup from the workgroup cache of the connector, or from AWS if it isn't cached.
+func (c *Connection) getWorkgroup(ctx context.Context, name string) (*athena.WorkGroup, error) {
+	var obs = c.connector.tracer
+	cache := c.connector.workgroupCache()
+	if entry, ok := cache.get(name); ok {
+		obs.Scope().Counter(DriverName + ".query.workgroup.cachehit").Inc(1)
+		return entry.workgroup, entry.err
+	}
+	obs.Scope().Counter(DriverName + ".query.workgroup.cachemiss").Inc(1)
+	athenaWG, err := getWG(ctx, c.athenaAPI, name)
+	cache.set(name, athenaWG, err)
+	return athenaWG, err
+}
+
+// startQueryExecution submits a query to Athena and returns a handle of the query execution.
+func (c *Connection) startQueryExecution(ctx context.Context, query string, executionParams []*string,
+	wgName string) (*queryHandle, error) {
+	var obs = c.connector.tracer
+	startOfStartQueryExecution := time.Now()
+	executionContext := &athena.QueryExecutionContext{
+		Database: aws.String(c.connector.config.GetDB()),
+	}
+	if catalog := queryCatalog(ctx, c.connector.config); catalog != "" {
+		executionContext.Catalog = aws.String(catalog)
+	}
+	submission := []string{aws.StringValue(executionContext.Catalog), *executionContext.Database, wgName, query}
+	for _, param := range executionParams {
+		submission = append(submission, aws.StringValue(param))
+	}
+	token, stableToken, err := clientRequestToken(ctx, submission...)
+	if err != nil {
+		return nil, err
+	}
+	statement, location := query, ""
+	if _, ok := ctx.Value(unloadKey).(bool); ok {
+		location = unloadLocation(c.connector.config, token)
+		query = unloadQuery(query, location)
+	}
+	resp, err := c.athenaAPI.StartQueryExecutionWithContext(ctx, &athena.StartQueryExecutionInput{
+		QueryString:              aws.String(query),
+		ExecutionParameters:      executionParams,
+		QueryExecutionContext:    executionContext,
+		ResultConfiguration:      c.connector.config.GetResultConfiguration(),
+		WorkGroup:                aws.String(wgName),
+		ResultReuseConfiguration: resultReuseConfiguration(ctx, c.connector.config),
+		ClientRequestToken:       aws.String(token),
+	})
+	if err != nil {
+		if isIdempotencyMismatchError(err) {
+			obs.Scope().Counter(DriverName + ".failure.query.duplicatesubmission").Inc(1)
+			obs.Log(ErrorLevel, "ClientRequestToken was used to submit a different query",
+				zap.String("workgroup", wgName),
+				zap.String("clientRequestToken", token),
+				zap.String("query", query))
+			return nil, fmt.Errorf("%w: %s: %s", ErrQueryDuplicateSubmission, token, err.Error())
+		}
+		return nil, err
+	}
+	timeStartQueryExecution := time.Since(startOfStartQueryExecution)
+	obs.Scope().Timer(DriverName + ".query.startqueryexecution").Record(timeStartQueryExecution)
+	h := newQueryHandle(c.athenaAPI, c.connector.config, obs, c.connector.poll, *resp.QueryExecutionId, wgName, query,
+		startOfStartQueryExecution)
+	h.s3Reader = c.s3Reader
+	h.unloadLocation = location
+	h.clientRequestToken, h.stableToken = token, stableToken
+	if stableToken && location != "" {
+		submitCtx := ctx
+		h.rerunUnload = func(ctx context.Context) (*Rows, error) {
+			rerunToken, err := newClientRequestToken()
 			if err != nil {
-				obs.Log(ErrorLevel, "StopQueryExecution failed",
-					zap.String("workgroup", wg.Name),
-					zap.String("queryID", queryID),
-					zap.String("query", query))
-				obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.failed").Inc(1)
 				return nil, err
 			}
-			if c.connector.config.IsMoneyWise() {
-				statusRespFinal, _ := c.athenaAPI.GetQueryExecutionWithContext(context.Background(), &athena.GetQueryExecutionInput{
-					QueryExecutionId: aws.String(queryID),
-				})
-				printCost(statusRespFinal)
+			rerunCtx := WithClientRequestToken(valuesContext{Context: ctx, values: submitCtx}, rerunToken)
+			rerun, err := c.startQueryExecution(rerunCtx, statement, executionParams, wgName)
+			if err != nil {
+				return nil, err
 			}
-			obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.succeeded").Inc(1)
-			timeStopQueryExecution := time.Since(now)
-			obs.Scope().Timer(DriverName + ".query.StopQueryExecution").Record(timeStopQueryExecution)
-			obs.Log(ErrorLevel, "query canceled", zap.String("queryID", queryID))
-			return nil, ctx.Err()
-		case <-time.After(pollInterval):
-			if isQueryTimeOut(startOfStartQueryExecution, *statusResp.QueryExecution.StatementType, c.connector.config.GetServiceLimitOverride()) {
-				obs.Log(ErrorLevel, "Query timeout failure",
-					zap.String("workgroup", wg.Name),
-					zap.String("queryID", queryID),
-					zap.String("query", query))
-				obs.Scope().Counter(DriverName + ".failure.querycontext.timeout").Inc(1)
-				return nil, ErrQueryTimeout
+			rerun.rerunUnload = nil
+			if err := rerun.wait(ctx, true); err != nil {
+				return nil, err
 			}
-			continue
+			return rerun.newRows(ctx)
 		}
 	}
-
-	return NewRows(ctx, c.athenaAPI, queryID, c.connector.config, obs)
+	return h, nil
 }
 
 // Ping implements driver.Pinger interface.
@@ -541,6 +573,14 @@ func (c *Connection) Ping(ctx context.Context) error {
 
 // Prepare is inherited from Conn interface.
 func (c *Connection) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext is to create a prepared statement, which can be run many times with different arguments.
+// If server side prepared statements are enabled in Config, the query is also prepared in Athena with
+// CreatePreparedStatement, and run with EXECUTE. The Athena prepared statement is deleted when the statement
+// is closed.
+func (c *Connection) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
 	if !isQueryValid(query) {
 		return nil, ErrInvalidQuery
 	}
@@ -548,7 +588,12 @@ func (c *Connection) Prepare(query string) (driver.Stmt, error) {
 		connection: c,
 		query:      query,
 		closed:     false,
-		numInput:   strings.Count(query, "?"),
+		numInput:   countPlaceholders(query),
+	}
+	if c.connector.config.IsServerSidePrepareEnabled() && !strings.HasPrefix(query, "pc:") && !IsQID(query) {
+		if err := stmt.createPreparedStatement(ctx); err != nil {
+			return nil, err
+		}
 	}
 	return stmt, nil
 }
@@ -24,6 +24,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"math/rand"
 	"testing"
 	"time"
@@ -222,6 +223,10 @@ func TestConnection_InterpolateParams_Query(t *testing.T) {
 func TestConnection_InterpolateParams_Query2(t *testing.T) {
 	c := createTestConnection(t)
 	q, err := c.interpolateParams("?", []driver.Value{aType{S: "abc"}})
+	assert.Equal(t, q, `CAST(ROW('abc') AS ROW("S" VARCHAR))`)
+	assert.Nil(t, err)
+
+	q, err = c.interpolateParams("?", []driver.Value{make(chan int)})
 	assert.Equal(t, q, "")
 	assert.NotNil(t, err)
 
@@ -233,10 +238,10 @@ func TestConnection_InterpolateParams_Query2(t *testing.T) {
 func TestConnection_InterpolateParams_Bool(t *testing.T) {
 	c := createTestConnection(t)
 	q, err := c.interpolateParams("?", []driver.Value{true})
-	assert.Equal(t, q, "1")
+	assert.Equal(t, q, "true")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{false})
-	assert.Equal(t, q, "0")
+	assert.Equal(t, q, "false")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{int64(1)})
 	assert.Equal(t, q, "1")
@@ -248,13 +253,13 @@ func TestConnection_InterpolateParams_Bool(t *testing.T) {
 	assert.Equal(t, q, "1.1")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{time.Time{}})
-	assert.Equal(t, q, "'0000-00-00'")
+	assert.Equal(t, q, "TIMESTAMP '0001-01-01 00:00:00.000'")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{time.Now()})
-	assert.NotEqual(t, q, "'0000-00-00'")
+	assert.NotEqual(t, q, "TIMESTAMP '0001-01-01 00:00:00.000'")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{[]byte{'0'}})
-	assert.Equal(t, q, "_binary'0'")
+	assert.Equal(t, q, "X'30'")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{nil})
 	assert.Equal(t, q, "NULL")
@@ -263,7 +268,10 @@ func TestConnection_InterpolateParams_Bool(t *testing.T) {
 	assert.Equal(t, q, "123NULL4")
 	assert.Nil(t, err)
 	q, err = c.interpolateParams("?", []driver.Value{time.Time{}.Add(1 * time.Nanosecond)})
-	assert.Equal(t, q, "'0001-01-01 00:00:00'")
+	assert.Equal(t, q, "TIMESTAMP '0001-01-01 00:00:00.000'")
+	assert.Nil(t, err)
+	q, err = c.interpolateParams("?", []driver.Value{"it's a \\n"})
+	assert.Equal(t, q, "'it''s a \\n'")
 	assert.Nil(t, err)
 }
 
@@ -273,10 +281,17 @@ func TestInterpolateParamsPlaceholderInString(t *testing.T) {
 	c := createTestConnection(t)
 
 	q, err := c.interpolateParams("SELECT 'abc?xyz',?", []driver.Value{int64(42)})
-	// When InterpolateParams support string literal, this should return `"SELECT 'abc?xyz', 42`
-	if err != ErrInvalidQuery {
-		t.Errorf("Expected err=ErrInvalidQuery, got err=%#v, q=%#v", err, q)
-	}
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 'abc?xyz',42", q)
+
+	q, err = c.interpolateParams(`SELECT "col?", json_extract(x, '$.a?'), 'it''s ?' -- what?
+	FROM t /* why? */ WHERE a = ?`, []driver.Value{int64(42)})
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT "col?", json_extract(x, '$.a?'), 'it''s ?' -- what?
+	FROM t /* why? */ WHERE a = 42`, q)
+
+	_, err = c.interpolateParams("SELECT '?'", []driver.Value{int64(42)})
+	assert.Equal(t, ErrInvalidQuery, err)
 }
 
 func TestInterpolateParamsUint64(t *testing.T) {
@@ -294,7 +309,7 @@ func TestInterpolateParamsDateOnly(t *testing.T) {
 	c := createTestConnection(t)
 	q, err := c.interpolateParams("SELECT ?", []driver.Value{testTime})
 	assert.Nil(t, err)
-	assert.Equal(t, "SELECT '2024-07-01 00:00:00'", q)
+	assert.Equal(t, "SELECT TIMESTAMP '2024-07-01 00:00:00.000'", q)
 }
 
 func TestInterpolateParamsTime(t *testing.T) {
@@ -304,7 +319,7 @@ func TestInterpolateParamsTime(t *testing.T) {
 	c := createTestConnection(t)
 	q, err := c.interpolateParams("SELECT ?", []driver.Value{testTime})
 	assert.Nil(t, err)
-	assert.Equal(t, "SELECT '2024-07-01 01:02:03'", q)
+	assert.Equal(t, "SELECT TIMESTAMP '2024-07-01 01:02:03.000'", q)
 }
 
 func TestInterpolateParamsTimeMicro(t *testing.T) {
@@ -315,7 +330,7 @@ func TestInterpolateParamsTimeMicro(t *testing.T) {
 	c := createTestConnection(t)
 	q, err := c.interpolateParams("SELECT ?", []driver.Value{testTimeMicro})
 	assert.Nil(t, err)
-	assert.Equal(t, "SELECT '2024-07-02 01:02:03.123456'", q)
+	assert.Equal(t, "SELECT TIMESTAMP '2024-07-02 01:02:03.123'", q)
 }
 
 func TestBuildExecutionParams(t *testing.T) {
@@ -341,44 +356,44 @@ func TestBuildExecutionParams(t *testing.T) {
 			name:        "Bool",
 			inputArgs:   []driver.Value{true, false},
 			expectedErr: nil,
-			expected:    []*string{aws.String("1"), aws.String("0")},
+			expected:    []*string{aws.String("true"), aws.String("false")},
 		},
 		{
 			name:        "Zero-value time",
 			inputArgs:   []driver.Value{time.Time{}},
 			expectedErr: nil,
-			expected:    []*string{aws.String("'0000-00-00'")}, // Special-cased. Matches interpolateParams behavior.
+			expected:    []*string{aws.String("TIMESTAMP '0001-01-01 00:00:00.000'")},
 		},
 		{
-			// Like interpolateParams(), buildExecutionParams() adds an additional 500 nanoseconds.
-			name:        "501 nanoseconds is still < 1 microsecond", // From TestConnection_InterpolateParams_Bool
+			// Like interpolateParams(), buildExecutionParams() rounds to milliseconds.
+			name:        "1 nanosecond is rounded down", // From TestConnection_InterpolateParams_Bool
 			inputArgs:   []driver.Value{time.Time{}.Add(time.Nanosecond)},
 			expectedErr: nil,
-			expected:    []*string{aws.String("'0001-01-01 00:00:00'")}, // Matches interpolateParams behavior.
+			expected:    []*string{aws.String("TIMESTAMP '0001-01-01 00:00:00.000'")}, // Matches interpolateParams behavior.
 		},
 		{
 			name:        "For non-zero-value time.Times, Date and time are present, even if time is zero-value",
 			inputArgs:   []driver.Value{testTime},
 			expectedErr: nil,
-			expected:    []*string{aws.String("'2024-07-01 00:00:00'")},
+			expected:    []*string{aws.String("TIMESTAMP '2024-07-01 00:00:00.000'")},
 		},
 		{
-			name:        "Datetime with Microseconds",
+			name:        "Datetime with Microseconds is rounded to milliseconds",
 			inputArgs:   []driver.Value{testTimeMicro},
 			expectedErr: nil,
-			expected:    []*string{aws.String("'2024-07-02 01:02:03.123456'")},
+			expected:    []*string{aws.String("TIMESTAMP '2024-07-02 01:02:03.123'")},
 		},
 		{
-			name:        "Byte Slice - Caller must use utils.go/FormatBytes before passing in query args",
+			name:        "Byte Slice - Varbinary literal",
 			inputArgs:   []driver.Value{[]byte{'0'}},
 			expectedErr: nil,
-			expected:    []*string{aws.String("0")}, // No change
+			expected:    []*string{aws.String("X'30'")},
 		},
 		{
-			name:        "Byte Slice - After FormatBytes",
-			inputArgs:   []driver.Value{FormatBytes([]byte{'0'})},
+			name:        "Byte Slice - FormatBytes in a string argument",
+			inputArgs:   []driver.Value{"from_utf8(" + string(FormatBytes([]byte{'0'})) + ")"},
 			expectedErr: nil,
-			expected:    []*string{aws.String("_binary'0'")},
+			expected:    []*string{aws.String("from_utf8(X'30')")},
 		},
 		{
 			name:        "String - Caller must use utils.go/FormatString before passing in query args",
@@ -390,7 +405,7 @@ func TestBuildExecutionParams(t *testing.T) {
 			name:        "String - After FormatString",
 			inputArgs:   []driver.Value{FormatString("This is a string with ' single quotes and \n chars")},
 			expectedErr: nil,
-			expected:    []*string{aws.String("'This is a string with '' single quotes and \\n chars'")},
+			expected:    []*string{aws.String("'This is a string with '' single quotes and \n chars'")},
 		},
 		{
 			name:        "Nil -> NULL",
@@ -400,11 +415,12 @@ func TestBuildExecutionParams(t *testing.T) {
 		},
 		{
 			name: "Every supported type",
-			inputArgs: []driver.Value{int64(-10), uint64(42), 1.23, true, testTime, []byte("This is a slice of bytes"),
+			inputArgs: []driver.Value{int64(-10), uint64(42), 1.23, true, testTime, []byte("Slice"),
 				"This is a string"},
 			expectedErr: nil,
-			expected: []*string{aws.String("-10"), aws.String("42"), aws.String("1.23"), aws.String("1"),
-				aws.String("'2024-07-01 00:00:00'"), aws.String("This is a slice of bytes"), aws.String("This is a string")},
+			expected: []*string{aws.String("-10"), aws.String("42"), aws.String("1.23"), aws.String("true"),
+				aws.String("TIMESTAMP '2024-07-01 00:00:00.000'"), aws.String("X'536C696365'"),
+				aws.String("This is a string")},
 		},
 	}
 	c := createTestConnection(t)
@@ -422,6 +438,49 @@ func TestBuildExecutionParams(t *testing.T) {
 	}
 }
 
+// TestDB_QueryArgTypes sends every Go type database/sql accepts through SELECT and checks the literal Athena gets.
+func TestDB_QueryArgTypes(t *testing.T) {
+	testTime, err := time.Parse(time.RFC3339Nano, "2024-07-02T01:02:03.123456-07:00")
+	assert.Nil(t, err)
+	testCases := []struct {
+		arg      interface{}
+		expected string
+	}{
+		{nil, "NULL"},
+		{1, "1"},
+		{int8(-8), "-8"},
+		{int16(16), "16"},
+		{int32(-32), "-32"},
+		{int64(64), "64"},
+		{uint(1), "1"},
+		{uint8(8), "8"},
+		{uint16(16), "16"},
+		{uint32(32), "32"},
+		{uint64(64), "64"},
+		{float32(0.5), "0.5"},
+		{0.25, "0.25"},
+		{true, "true"},
+		{false, "false"},
+		{testTime, "TIMESTAMP '2024-07-02 08:02:03.123'"},
+		{[]byte("a'b"), "X'612762'"},
+		{"TIMESTAMP '2024-07-01 00:00:00.000'", "TIMESTAMP '2024-07-01 00:00:00.000'"},
+		{sql.NullString{String: "x", Valid: true}, "x"},
+		{sql.NullInt64{}, "NULL"},
+		{sql.NullBool{Bool: true, Valid: true}, "true"},
+	}
+	c := createQueryHandleTestConnection()
+	db := sql.OpenDB(&testConnector{conn: c})
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, tc := range testCases {
+		rows, err := db.Query("SELECTQueryContext_OK = ?", tc.arg)
+		assert.Nil(t, err)
+		assert.Nil(t, rows.Close())
+		params := c.athenaAPI.(*mockAthenaClient).executionParameters
+		assert.Equal(t, []*string{aws.String(tc.expected)}, params, "%T", tc.arg)
+	}
+}
+
 func TestCheckNamedValue(t *testing.T) {
 	c := createTestConnection(t)
 	value := driver.NamedValue{Value: uint64(0)}
@@ -892,3 +951,59 @@ func Test_PseudoCommand(t *testing.T) {
 	assert.Nil(t, er)
 	assert.NotNil(t, dr)
 }
+
+func TestConnection_QueryContext_AttachQID(t *testing.T) {
+	t.Parallel()
+	nm := newMockAthenaClient()
+	testConf := NewNoOpsConfig()
+	testConf.SetResultPollIntervalSeconds(0)
+	testConf.SetMoneyWise(true)
+	c := &Connection{
+		athenaAPI: nm,
+		connector: &SQLConnector{
+			config: testConf,
+			tracer: NewDefaultObservability(testConf),
+		},
+	}
+
+	// still running when re-attached, so we wait for it instead of fetching partial results
+	query := "11111111-1111-1111-1111-111111111111"
+	rows, err := c.QueryContext(context.Background(), query, []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, 2, nm.getQueryExecutionCalls[query])
+
+	query = "00000000-0000-0000-0000-000000000000"
+	rows, err = c.QueryContext(context.Background(), query, []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, 1, nm.getQueryExecutionCalls[query])
+
+	query = "22222222-2222-2222-2222-222222222222"
+	rows, err = c.QueryContext(context.Background(), query, []driver.NamedValue{})
+	assert.Nil(t, rows)
+	var failedErr *QueryFailedError
+	assert.True(t, errors.As(err, &failedErr))
+	assert.Equal(t, query, failedErr.QueryID)
+	assert.Contains(t, failedErr.Reason, "SYNTAX_ERROR")
+	assert.Equal(t, "primary", failedErr.Workgroup)
+	assert.True(t, failedErr.IsUserError())
+	assert.False(t, failedErr.IsSystemError())
+	assert.Equal(t, int64(1006), failedErr.ErrorType)
+	assert.False(t, failedErr.Retryable)
+	assert.Equal(t, "https://us-east-1.console.aws.amazon.com/athena/home?region=us-east-1"+
+		"#/query-editor/history/"+query, failedErr.ConsoleURL())
+
+	query = "33333333-3333-3333-3333-333333333333"
+	rows, err = c.QueryContext(context.Background(), query, []driver.NamedValue{})
+	assert.Nil(t, rows)
+	var cancelledErr *QueryCancelledError
+	assert.True(t, errors.As(err, &cancelledErr))
+	assert.Equal(t, query, cancelledErr.QueryID)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	query = "c89088ab-595d-4ee6-a9ce-73b55aeb8111"
+	rows, err = c.QueryContext(context.Background(), query, []driver.NamedValue{})
+	assert.Nil(t, rows)
+	assert.Equal(t, ErrTestMockGeneric, err)
+}
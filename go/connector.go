@@ -26,6 +26,7 @@ import (
 
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/uber-go/tally"
@@ -35,12 +36,21 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 // SQLConnector is the connector for AWS Athena Driver.
 type SQLConnector struct {
-	config *Config
-	tracer *DriverTracer
+	config    *Config
+	tracer    *DriverTracer
+	poll      PollStrategy
+	s3Reader  S3Reader
+	cacheMu   sync.Mutex
+	cache     ResultCache
+	cacheInit bool // cache is set by SetResultCache or created from Config
+
+	workgroups *workgroupCache
+	wgOnce     sync.Once
 }
 
 // NoopsSQLConnector is to create a noops SQLConnector.
@@ -52,6 +62,75 @@ func NoopsSQLConnector() *SQLConnector {
 	}
 }
 
+// NewSQLConnector is to create a SQLConnector with a driver Config.
+// It can be used with sql.OpenDB, or to start queries asynchronously with StartQuery.
+func NewSQLConnector(config *Config) *SQLConnector {
+	return &SQLConnector{
+		config: config,
+		tracer: NewDefaultObservability(config),
+	}
+}
+
+// SetPollStrategy is to replace the PollStrategy configured in Config with a custom one.
+// Passing nil falls back to the one in Config.
+func (c *SQLConnector) SetPollStrategy(p PollStrategy) {
+	c.poll = p
+}
+
+// SetS3Reader is to replace the S3Reader reading query results in ResultModeS3.
+// Passing nil falls back to one created with the AWS session of the connection.
+func (c *SQLConnector) SetS3Reader(r S3Reader) {
+	c.s3Reader = r
+}
+
+// SetResultCache is to serve repeated queries from cache, instead of the ResultCache configured in Config.
+// Passing nil disables the result cache.
+func (c *SQLConnector) SetResultCache(cache ResultCache) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.cache = cache
+	c.cacheInit = true
+}
+
+// resultCache is to get the ResultCache of the connector. The one configured in Config is created at the first call.
+func (c *SQLConnector) resultCache() ResultCache {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	if c.cacheInit {
+		return c.cache
+	}
+	c.cacheInit = true
+	switch backend := c.config.GetResultCache(); backend {
+	case "":
+	case "memory":
+		c.cache = NewMemoryResultCache(c.config.GetResultCacheSize(), c.config.GetResultCacheTTL())
+	case "file":
+		cache, err := NewFileResultCache(c.config.GetResultCacheDir(), c.config.GetResultCacheTTL())
+		if err != nil {
+			c.tracer.Log(WarnLevel, "result cache is disabled", zap.String("error", err.Error()))
+			return nil
+		}
+		c.cache = cache
+	default:
+		c.tracer.Log(WarnLevel, "result cache is disabled", zap.String("resultCache", backend))
+	}
+	return c.cache
+}
+
+// workgroupCache is to get the workgroup cache of the connector, which is created at the first call.
+func (c *SQLConnector) workgroupCache() *workgroupCache {
+	c.wgOnce.Do(func() {
+		c.workgroups = newWorkgroupCache(c.config.GetWGCacheTTL(), c.config.GetWGCacheNegativeTTL())
+	})
+	return c.workgroups
+}
+
+// InvalidateWorkgroup is to remove a workgroup from the workgroup cache, so the next query in it checks it again.
+// Call it after creating, enabling or disabling the workgroup out of the driver, e.g. with Workgroup.CreateWGRemotely.
+func (c *SQLConnector) InvalidateWorkgroup(name string) {
+	c.workgroupCache().invalidate(name)
+}
+
 // Driver is to construct a new SQLConnector.
 func (c *SQLConnector) Driver() driver.Driver {
 	return &SQLDriver{}
@@ -103,12 +182,28 @@ func (c *SQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
 		return nil, err
 	}
 
-	athenaAPI := athena.New(awsAthenaSession)
+	athenaAPI := newRetryAthenaClient(athena.New(awsAthenaSession), c.config, c.tracer)
+	s3Reader := c.s3Reader
+	if s3Reader == nil && c.config.GetResultMode() != ResultModeAPI {
+		s3Reader = NewS3Reader(s3.New(awsAthenaSession))
+	}
 	timeConnect := time.Since(now)
 	conn := &Connection{
 		athenaAPI: athenaAPI,
+		s3Reader:  s3Reader,
 		connector: c,
 	}
 	c.tracer.Scope().Timer(DriverName + ".connector.connect").Record(timeConnect)
 	return conn, nil
 }
+
+// StartQuery submits a query to Athena without waiting for it to finish. Different from
+// Connection.StartQuery, the returned QueryHandle doesn't hold any connection from a sql.DB pool,
+// so it is fine to keep it around until the query finishes.
+func (c *SQLConnector) StartQuery(ctx context.Context, query string, namedArgs []driver.NamedValue) (QueryHandle, error) {
+	conn, err := c.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*Connection).StartQuery(ctx, query, namedArgs)
+}
@@ -56,6 +56,43 @@ const (
 	// LoggerKey is the key for Logger in context
 	LoggerKey = TContextKey("LoggerKey")
 
+	// ResultReuseKey is the key for the result reuse configuration of a query in context
+	ResultReuseKey = TContextKey("ResultReuseKey")
+
+	// CatalogKey is the key for the data catalog of a query in context
+	CatalogKey = TContextKey("CatalogKey")
+
+	// WorkgroupKey is the key for the workgroup of a query in context
+	WorkgroupKey = TContextKey("WorkgroupKey")
+
+	// DatabaseKey is the key for the database of a query in context
+	DatabaseKey = TContextKey("DatabaseKey")
+
+	// OutputLocationKey is the key for the output location of a query in context
+	OutputLocationKey = TContextKey("OutputLocationKey")
+
+	// QueryTimeoutKey is the key for the timeout of a query in context
+	QueryTimeoutKey = TContextKey("QueryTimeoutKey")
+
+	// PollStrategyKey is the key for the PollStrategy of a query in context
+	PollStrategyKey = TContextKey("PollStrategyKey")
+
+	// MoneyWiseKey is the key for the moneywise mode of a query in context
+	MoneyWiseKey = TContextKey("MoneyWiseKey")
+
+	// ResultCacheKey is the key for turning off the client-side result cache for a query in context
+	ResultCacheKey = TContextKey("ResultCacheKey")
+
+	// ClientRequestTokenKey is the key for the ClientRequestToken of a query submission in context
+	ClientRequestTokenKey = TContextKey("ClientRequestTokenKey")
+
+	// JobStepKey is the key for the job step which the ClientRequestToken of a query submission is derived from in
+	// context
+	JobStepKey = TContextKey("JobStepKey")
+
+	// ColumnTypeSignaturesKey is the key for the full types of the ARRAY, MAP and ROW columns of a query in context
+	ColumnTypeSignaturesKey = TContextKey("ColumnTypeSignaturesKey")
+
 	// DummyRegion is used when AWS CLI Config is used, ie AWS_SDK_LOAD_CONFIG is set
 	DummyRegion = "dummy"
 
@@ -64,6 +101,58 @@ const (
 
 	// DummySecretAccessKey is used when AWS CLI Config is used, ie AWS_SDK_LOAD_CONFIG is set
 	DummySecretAccessKey = "dummy"
+
+	// DefaultAPIRetryBaseDelay is the default delay before the first retry of a throttled Athena API call(unit millisecond).
+	DefaultAPIRetryBaseDelay = 100
+
+	// DefaultAPIRetryMaxDelay is the default maximum delay between two retries of a throttled Athena API call(unit millisecond).
+	DefaultAPIRetryMaxDelay = 10 * 1000
+
+	// DefaultResultReuseMaxAge is the default maximum age of a reused query result, same as in Athena(unit minute).
+	DefaultResultReuseMaxAge = 60
+
+	// MaxResultReuseMaxAge is the maximum age of a reused query result allowed by Athena(unit minute).
+	MaxResultReuseMaxAge = 7 * 24 * 60
+
+	// DefaultResultCacheSize is the default number of queries in the in-memory ResultCache.
+	DefaultResultCacheSize = 1000
+
+	// DefaultResultCacheTTL is the default time to live of a query in ResultCache(unit second).
+	DefaultResultCacheTTL = 60 * 60
+
+	// DefaultResubmitDelay is the default delay before the first resubmission of a failed query(unit millisecond).
+	DefaultResubmitDelay = 1000
+
+	// DefaultWGCacheTTL is the default time to live of a workgroup in the workgroup cache(unit second).
+	DefaultWGCacheTTL = 5 * 60
+
+	// DefaultWGCacheNegativeTTL is the default time to live of a missing or disabled workgroup in the
+	// workgroup cache(unit second).
+	DefaultWGCacheNegativeTTL = 30
+
+	// DefaultS3ReadConcurrency is the default number of parallel ranged GETs reading a query result from S3.
+	DefaultS3ReadConcurrency = 8
+
+	// DefaultS3ReadPartSize is the default size of a ranged GET reading a query result from S3(unit byte).
+	DefaultS3ReadPartSize = 8 * 1024 * 1024
+
+	// MaxResultPageSize is the maximum number of rows in a page of GetQueryResults.
+	MaxResultPageSize = 1000
+)
+
+// Result modes, which are how the result of a query is read.
+const (
+	// ResultModeAPI pages through the result with GetQueryResults, 1000 rows at a time.
+	ResultModeAPI = "api"
+
+	// ResultModeS3 reads the result CSV from the output bucket. It is much faster for big results, but needs
+	// s3:GetObject permission on the output bucket. The result of DDL statements is read with GetQueryResults.
+	ResultModeS3 = "s3"
+
+	// ResultModeUnload runs a SELECT with UNLOAD, which writes the result to the output bucket as Parquet files,
+	// and reads them with their native types. The files are removed when the rows are closed. It needs
+	// s3:GetObject, s3:ListBucket and s3:DeleteObject permissions on the output bucket.
+	ResultModeUnload = "unload"
 )
 
 // https://docs.aws.amazon.com/athena/latest/ug/service-limits.html
@@ -77,15 +166,15 @@ const (
 	// PoolInterval is the interval between two status checks(unit second).
 	PoolInterval = 3
 
+	// DefaultPollBackoffFactor is the default growth factor of the backoff PollStrategy.
+	DefaultPollBackoffFactor = 2.0
+
 	// The maximum allowed query string length is 262144 bytes,
 	// where the strings are encoded in UTF-8.
 	// This is not an adjustable quota. (unit bytes)
 	MAXQueryStringLength = 262144
 )
 
-const digits01 = "0123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789"
-const digits10 = "0000000000111111111122222222223333333333444444444455555555556666666666777777777788888888889999999999"
-
 // AthenaColumnTypes is a fixed array of Athena Column Types. An array isn't immutable by nature; you can't make it constant.
 var AthenaColumnTypes = [...]string{"tinyint", "smallint", "integer", "bigint", "float", "real", "double",
 	"json", "char", "varchar", "varbinary", "row", "string", "binary",
@@ -0,0 +1,271 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// WithResultReuse returns a copy of ctx which lets Athena reuse the result of a previous run of the query,
+// if it is not older than maxAge. It overrides the result reuse setting in Config for the queries run with ctx.
+func WithResultReuse(ctx context.Context, maxAge time.Duration) context.Context {
+	return context.WithValue(ctx, ResultReuseKey, newResultReuseConfiguration(true, maxAge))
+}
+
+// WithoutResultReuse returns a copy of ctx which makes Athena run the query even if result reuse is enabled
+// in Config.
+func WithoutResultReuse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ResultReuseKey, newResultReuseConfiguration(false, 0))
+}
+
+// resultReuseConfiguration is to get the result reuse configuration of a query, from ctx if it is set there,
+// or from config otherwise.
+func resultReuseConfiguration(ctx context.Context, config *Config) *athena.ResultReuseConfiguration {
+	if r, ok := ctx.Value(ResultReuseKey).(*athena.ResultReuseConfiguration); ok {
+		return r
+	}
+	return config.GetResultReuseConfiguration()
+}
+
+func newResultReuseConfiguration(enabled bool, maxAge time.Duration) *athena.ResultReuseConfiguration {
+	byAge := &athena.ResultReuseByAgeConfiguration{
+		Enabled: aws.Bool(enabled),
+	}
+	if enabled {
+		minutes := int64(maxAge / time.Minute)
+		if minutes > MaxResultReuseMaxAge {
+			minutes = MaxResultReuseMaxAge
+		}
+		byAge.MaxAgeInMinutes = aws.Int64(minutes)
+	}
+	return &athena.ResultReuseConfiguration{
+		ResultReuseByAgeConfiguration: byAge,
+	}
+}
+
+// WithCatalog returns a copy of ctx which runs queries in the data catalog, overriding the catalog in Config.
+func WithCatalog(ctx context.Context, catalog string) context.Context {
+	return context.WithValue(ctx, CatalogKey, catalog)
+}
+
+// queryCatalog is to get the data catalog of a query, from ctx if it is set there, or from config otherwise.
+func queryCatalog(ctx context.Context, config *Config) string {
+	if catalog, ok := ctx.Value(CatalogKey).(string); ok {
+		return catalog
+	}
+	return config.GetCatalog()
+}
+
+// WithWorkgroup returns a copy of ctx which runs queries in the workgroup, overriding the workgroup in Config.
+func WithWorkgroup(ctx context.Context, workgroup string) context.Context {
+	return context.WithValue(ctx, WorkgroupKey, workgroup)
+}
+
+// WithDatabase returns a copy of ctx which runs queries in the database, overriding the database in Config.
+func WithDatabase(ctx context.Context, db string) context.Context {
+	return context.WithValue(ctx, DatabaseKey, db)
+}
+
+// WithOutputLocation returns a copy of ctx which writes query results to the S3 location, overriding the output
+// bucket in Config. The location must start with s3://.
+func WithOutputLocation(ctx context.Context, location string) context.Context {
+	return context.WithValue(ctx, OutputLocationKey, location)
+}
+
+// WithQueryTimeout returns a copy of ctx which overrides the DDL and DML query timeouts in Config. Athena queries
+// running longer than timeout are stopped. timeout is rounded to seconds, and can't be shorter than PoolInterval.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, QueryTimeoutKey, timeout)
+}
+
+// WithPollStrategy returns a copy of ctx which polls the status of queries with p, overriding the PollStrategy of
+// SQLConnector and Config.
+func WithPollStrategy(ctx context.Context, p PollStrategy) context.Context {
+	return context.WithValue(ctx, PollStrategyKey, p)
+}
+
+// WithMoneyWise returns a copy of ctx which turns the moneywise mode on or off, overriding Config.
+func WithMoneyWise(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, MoneyWiseKey, enabled)
+}
+
+// WithoutResultCache returns a copy of ctx which runs queries in Athena, even if their result is in the
+// client-side result cache.
+func WithoutResultCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ResultCacheKey, false)
+}
+
+// isResultCacheEnabled is to check if the client-side result cache is not turned off in ctx.
+func isResultCacheEnabled(ctx context.Context) bool {
+	enabled, ok := ctx.Value(ResultCacheKey).(bool)
+	return !ok || enabled
+}
+
+// WithClientRequestToken returns a copy of ctx which submits queries with the idempotency token, instead of a
+// random one. Athena doesn't start a query again for a token it has seen, but returns the query ID of the first
+// submission, so a retried job step doesn't run an expensive query twice. The token must be 32 to 128 characters
+// long, like the ones from ClientRequestTokenOf. See also WithJobStep.
+func WithClientRequestToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, ClientRequestTokenKey, token)
+}
+
+// ClientRequestTokenOf returns a deterministic ClientRequestToken for parts, like a job ID and a step name.
+func ClientRequestTokenOf(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WithJobStep returns a copy of ctx which submits queries with a ClientRequestToken derived from step and the
+// submission, i.e. the query, its parameters, catalog, database and workgroup, instead of a random one. step is
+// a key of the job step which is the same when the step is retried, e.g. a job ID and a step name. So a retried
+// step gets the query ID of the first submission of each of its queries, like with WithClientRequestToken, while
+// the different queries of a step are started once each. A token set by WithClientRequestToken comes first.
+func WithJobStep(ctx context.Context, step string) context.Context {
+	return context.WithValue(ctx, JobStepKey, step)
+}
+
+// clientRequestToken is to get the ClientRequestToken of a query submission. It is the token set in ctx, or one
+// derived from the job step set in ctx and submission, or else a random one. stable is set for the first two,
+// which are the same when the submission is retried.
+func clientRequestToken(ctx context.Context, submission ...string) (token string, stable bool, err error) {
+	if token, ok := ctx.Value(ClientRequestTokenKey).(string); ok {
+		if len(token) < 32 || len(token) > 128 {
+			return "", false, ErrQueryClientRequestToken
+		}
+		return token, true, nil
+	}
+	if step, ok := ctx.Value(JobStepKey).(string); ok {
+		return ClientRequestTokenOf(append([]string{"step", step}, submission...)...), true, nil
+	}
+	token, err = newClientRequestToken()
+	return token, false, err
+}
+
+// WithColumnTypeSignature returns a copy of ctx which decodes the values of an ARRAY, MAP or ROW column of the query
+// result with the full type of the column, e.g. map(varchar, array(integer)), if complex types are decoded.
+// GetQueryResults only reports the name of the type, i.e. array, map or row, and the elements of a column without
+// a full type are strings. It can be called for several columns.
+func WithColumnTypeSignature(ctx context.Context, column string, signature string) context.Context {
+	signatures := map[string]string{column: signature}
+	if parent, ok := ctx.Value(ColumnTypeSignaturesKey).(map[string]string); ok {
+		for c, s := range parent {
+			if c != column {
+				signatures[c] = s
+			}
+		}
+	}
+	return context.WithValue(ctx, ColumnTypeSignaturesKey, signatures)
+}
+
+// columnTypeSignature is to get the full type of a column from ctx.
+func columnTypeSignature(ctx context.Context, column string) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	signatures, _ := ctx.Value(ColumnTypeSignaturesKey).(map[string]string)
+	signature, ok := signatures[column]
+	return signature, ok
+}
+
+// withContext is to return c, or a copy of c for a single call if ctx overrides its Config, PollStrategy,
+// logger or metrics scope. The copy shares the Athena client and result cache of c.
+func (c *Connection) withContext(ctx context.Context) (*Connection, error) {
+	config := c.connector.config
+	changeConfig := func() *Config {
+		if config == c.connector.config {
+			config = config.clone()
+		}
+		return config
+	}
+	if workgroup, ok := ctx.Value(WorkgroupKey).(string); ok {
+		changeConfig().values.Set("workgroupName", workgroup)
+	}
+	if db, ok := ctx.Value(DatabaseKey).(string); ok {
+		changeConfig().SetDB(db)
+	}
+	if location, ok := ctx.Value(OutputLocationKey).(string); ok {
+		if err := changeConfig().SetOutputBucket(location); err != nil {
+			return nil, err
+		}
+	}
+	if timeout, ok := ctx.Value(QueryTimeoutKey).(time.Duration); ok {
+		limits := NewServiceLimitOverride()
+		if err := limits.SetDDLQueryTimeout(int(timeout / time.Second)); err != nil {
+			return nil, err
+		}
+		_ = limits.SetDMLQueryTimeout(limits.GetDDLQueryTimeout())
+		changeConfig().SetServiceLimitOverride(*limits)
+	}
+	if enabled, ok := ctx.Value(MoneyWiseKey).(bool); ok {
+		changeConfig().SetMoneyWise(enabled)
+	}
+	signatures, _ := ctx.Value(ColumnTypeSignaturesKey).(map[string]string)
+	for _, signature := range signatures {
+		if _, err := parseTypeSignature(signature); err != nil {
+			return nil, err
+		}
+	}
+	poll, pollOK := ctx.Value(PollStrategyKey).(PollStrategy)
+	scope, scopeOK := ctx.Value(MetricsKey).(tally.Scope)
+	logger, loggerOK := ctx.Value(LoggerKey).(*zap.Logger)
+	if config == c.connector.config && !pollOK && !scopeOK && !loggerOK {
+		return c, nil
+	}
+
+	tracer := c.connector.tracer
+	if !scopeOK {
+		scope = tracer.scope
+	}
+	if !loggerOK {
+		logger = tracer.logger
+	}
+	if !pollOK {
+		poll = c.connector.poll
+	}
+	connector := &SQLConnector{
+		config:    config,
+		tracer:    NewObservability(config, logger, scope),
+		poll:      poll,
+		cache:     c.connector.resultCache(),
+		cacheInit: true,
+
+		workgroups: c.connector.workgroupCache(),
+	}
+	connector.wgOnce.Do(func() {})
+	return &Connection{
+		athenaAPI: c.athenaAPI,
+		s3Reader:  c.s3Reader,
+		connector: connector,
+		numInput:  c.numInput,
+	}, nil
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestResultReuseConfiguration(t *testing.T) {
+	config := NewNoOpsConfig()
+	ctx := context.Background()
+	assert.Nil(t, resultReuseConfiguration(ctx, config))
+
+	config.SetResultReuse(true)
+	r := resultReuseConfiguration(ctx, config)
+	assert.True(t, aws.BoolValue(r.ResultReuseByAgeConfiguration.Enabled))
+	assert.Equal(t, int64(DefaultResultReuseMaxAge), aws.Int64Value(r.ResultReuseByAgeConfiguration.MaxAgeInMinutes))
+
+	r = resultReuseConfiguration(WithoutResultReuse(ctx), config)
+	assert.False(t, aws.BoolValue(r.ResultReuseByAgeConfiguration.Enabled))
+	assert.Nil(t, r.ResultReuseByAgeConfiguration.MaxAgeInMinutes)
+
+	config.SetResultReuse(false)
+	r = resultReuseConfiguration(WithResultReuse(ctx, 2*time.Hour), config)
+	assert.True(t, aws.BoolValue(r.ResultReuseByAgeConfiguration.Enabled))
+	assert.Equal(t, int64(120), aws.Int64Value(r.ResultReuseByAgeConfiguration.MaxAgeInMinutes))
+
+	r = resultReuseConfiguration(WithResultReuse(ctx, 30*24*time.Hour), config)
+	assert.Equal(t, int64(MaxResultReuseMaxAge), aws.Int64Value(r.ResultReuseByAgeConfiguration.MaxAgeInMinutes))
+}
+
+func TestConnection_QueryContext_ResultReuse(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	c.connector.config.SetMoneyWise(true)
+	rows, err := c.QueryContext(context.Background(), "RESULT_REUSE", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", rows.(*Rows).QueryID())
+	assert.False(t, rows.(*Rows).ReusedPreviousResult())
+
+	rows, err = c.QueryContext(WithResultReuse(context.Background(), time.Hour), "RESULT_REUSE",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, "66666666-6666-6666-6666-666666666666", rows.(*Rows).QueryID())
+	assert.True(t, rows.(*Rows).ReusedPreviousResult())
+	assert.Equal(t, int64(123), *rows.(*Rows).QueryExecutionStatistics().DataScannedInBytes)
+
+	c.connector.config.SetResultReuse(true)
+	h, err := c.StartQuery(context.Background(), "RESULT_REUSE", nil)
+	assert.Nil(t, err)
+	rows, err = h.Rows(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, rows.(*Rows).ReusedPreviousResult())
+
+	h, err = c.StartQuery(WithoutResultReuse(context.Background()), "RESULT_REUSE", nil)
+	assert.Nil(t, err)
+	rows, err = h.Rows(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, rows.(*Rows).ReusedPreviousResult())
+	assert.Nil(t, (&Rows{}).QueryExecutionStatistics())
+}
+
+func TestConnection_QueryContext_Catalog(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	ctx := context.Background()
+	assert.Equal(t, "", queryCatalog(ctx, c.connector.config))
+
+	_, err := c.QueryContext(ctx, "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Nil(t, m.queryExecutionContext.Catalog)
+	assert.Equal(t, DefaultDBName, aws.StringValue(m.queryExecutionContext.Database))
+
+	c.connector.config.SetCatalog("lambda_catalog")
+	_, err = c.QueryContext(ctx, "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, "lambda_catalog", aws.StringValue(m.queryExecutionContext.Catalog))
+
+	_, err = c.StartQuery(WithCatalog(ctx, "glue_catalog"), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "glue_catalog", aws.StringValue(m.queryExecutionContext.Catalog))
+
+	assert.Equal(t, c.connector.config.GetResultConfiguration(), m.resultConfiguration)
+
+	// an empty catalog in ctx falls back to Athena's default catalog
+	_, err = c.QueryContext(WithCatalog(ctx, ""), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Nil(t, m.queryExecutionContext.Catalog)
+}
+
+func TestConnection_WithContext(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	ctx := context.Background()
+	conn, err := c.withContext(WithCatalog(ctx, "catalog"))
+	assert.Nil(t, err)
+	assert.True(t, conn == c)
+
+	poll := NewConstantPollStrategy(time.Millisecond)
+	ctx = WithWorkgroup(ctx, "etl")
+	ctx = WithDatabase(ctx, "sampledb")
+	ctx = WithOutputLocation(ctx, "s3://other-bucket/etl/")
+	ctx = WithQueryTimeout(ctx, 10*time.Minute)
+	ctx = WithPollStrategy(ctx, poll)
+	ctx = WithMoneyWise(ctx, true)
+	conn, err = c.withContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "etl", conn.connector.config.GetWorkgroup().Name)
+	assert.Equal(t, "sampledb", conn.connector.config.GetDB())
+	assert.Equal(t, "s3://other-bucket/etl/", conn.connector.config.GetOutputBucket())
+	assert.Equal(t, 600, conn.connector.config.GetServiceLimitOverride().GetDDLQueryTimeout())
+	assert.Equal(t, 600, conn.connector.config.GetServiceLimitOverride().GetDMLQueryTimeout())
+	assert.True(t, conn.connector.config.IsMoneyWise())
+	assert.Equal(t, poll, conn.connector.poll)
+	assert.True(t, conn.athenaAPI == c.athenaAPI)
+
+	// the Config of the connection doesn't change
+	assert.Equal(t, "", c.connector.config.GetWorkgroup().Name)
+	assert.Equal(t, DefaultDBName, c.connector.config.GetDB())
+	assert.Equal(t, "s3://fake-query-results-arbitrary-bucket/", c.connector.config.GetOutputBucket())
+	assert.Equal(t, 0, c.connector.config.GetServiceLimitOverride().GetDMLQueryTimeout())
+	assert.False(t, c.connector.config.IsMoneyWise())
+	assert.Nil(t, c.connector.poll)
+
+	_, err = c.withContext(WithOutputLocation(context.Background(), "bucket"))
+	assert.Equal(t, ErrConfigOutputLocation, err)
+	_, err = c.withContext(WithQueryTimeout(context.Background(), time.Second))
+	assert.Equal(t, ErrServiceLimitOverride, err)
+	_, err = c.withContext(WithColumnTypeSignature(context.Background(), "c", "array("))
+	assert.True(t, errors.Is(err, ErrComplexType))
+}
+
+func TestConnection_QueryContext_ContextOverrides(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	m.GetWGStatus = true
+	c.connector.config.SetLogging(true)
+	core, logs := observer.New(zap.DebugLevel)
+	scope := tally.NewTestScope("", nil)
+	c.connector.config.SetMetrics(true)
+
+	ctx := WithWorkgroup(context.Background(), "etl")
+	ctx = WithDatabase(ctx, "sampledb")
+	ctx = WithOutputLocation(ctx, "s3://other-bucket/etl/")
+	ctx = context.WithValue(ctx, LoggerKey, zap.New(core))
+	ctx = context.WithValue(ctx, MetricsKey, scope)
+	_, err := c.QueryContext(ctx, "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, "etl", m.workGroup)
+	assert.Equal(t, "sampledb", aws.StringValue(m.queryExecutionContext.Database))
+	assert.Equal(t, "s3://other-bucket/etl/", aws.StringValue(m.resultConfiguration.OutputLocation))
+	assert.NotZero(t, logs.Len())
+	assert.NotNil(t, scope.Snapshot().Timers()[DriverName+".query.workgroup+"])
+
+	_, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultWGName, m.workGroup)
+	assert.Equal(t, DefaultDBName, aws.StringValue(m.queryExecutionContext.Database))
+	assert.Equal(t, "s3://fake-query-results-arbitrary-bucket/", aws.StringValue(m.resultConfiguration.OutputLocation))
+
+	h, err := c.StartQuery(WithMoneyWise(WithWorkgroup(context.Background(), "etl"), true), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "etl", m.workGroup)
+	assert.True(t, h.(*queryHandle).config.IsMoneyWise())
+	assert.False(t, c.connector.config.IsMoneyWise())
+}
+
+func TestClientRequestToken(t *testing.T) {
+	token := ClientRequestTokenOf("job-1", "step-2")
+	assert.Len(t, token, 64)
+	assert.Equal(t, token, ClientRequestTokenOf("job-1", "step-2"))
+	assert.NotEqual(t, token, ClientRequestTokenOf("job-1step-2"))
+	assert.NotEqual(t, token, ClientRequestTokenOf("job-1", "step-3"))
+
+	random, stable, err := clientRequestToken(context.Background(), "SELECT 1")
+	assert.Nil(t, err)
+	assert.False(t, stable)
+	assert.Len(t, random, 32)
+	t2, stable, err := clientRequestToken(WithClientRequestToken(context.Background(), token), "SELECT 1")
+	assert.Nil(t, err)
+	assert.True(t, stable)
+	assert.Equal(t, token, t2)
+	_, _, err = clientRequestToken(WithClientRequestToken(context.Background(), "short"))
+	assert.Equal(t, ErrQueryClientRequestToken, err)
+
+	// a token derived from the job step and the submission
+	ctx := WithJobStep(context.Background(), "job-1/step-2")
+	t3, stable, err := clientRequestToken(ctx, "SELECT 1")
+	assert.Nil(t, err)
+	assert.True(t, stable)
+	assert.Len(t, t3, 64)
+	t4, _, _ := clientRequestToken(ctx, "SELECT 1")
+	assert.Equal(t, t3, t4)
+	t4, _, _ = clientRequestToken(ctx, "SELECT 2")
+	assert.NotEqual(t, t3, t4)
+	t4, _, _ = clientRequestToken(WithJobStep(context.Background(), "job-2/step-2"), "SELECT 1")
+	assert.NotEqual(t, t3, t4)
+	// the token from the context comes first
+	t4, _, _ = clientRequestToken(WithClientRequestToken(ctx, token), "SELECT 1")
+	assert.Equal(t, token, t4)
+}
+
+func TestConnection_StartQuery_ClientRequestToken(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+
+	// a random token for every submission
+	for i := 0; i < 2; i++ {
+		_, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+		assert.Nil(t, err)
+	}
+	assert.Len(t, m.clientRequestTokens, 2)
+	assert.Len(t, m.clientRequestTokens[0], 32)
+	assert.NotEqual(t, m.clientRequestTokens[0], m.clientRequestTokens[1])
+	assert.Equal(t, 2, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+
+	// a retried job step gets the query of the first submission
+	ctx := WithClientRequestToken(context.Background(), ClientRequestTokenOf("job-1", "step-1"))
+	h1, err := c.StartQuery(ctx, "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	h2, err := c.StartQuery(ctx, "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, h1.QueryID(), h2.QueryID())
+	assert.Equal(t, 3, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+
+	_, err = c.ExecContext(ctx, "SELECTQueryContext_OK = ?", []driver.NamedValue{{Ordinal: 1, Value: "OK"}})
+	assert.True(t, errors.Is(err, ErrQueryDuplicateSubmission))
+	assert.Contains(t, err.Error(), ClientRequestTokenOf("job-1", "step-1"))
+
+	_, err = c.StartQuery(WithClientRequestToken(context.Background(), "short"), "SELECTQueryContext_OK", nil)
+	assert.Equal(t, ErrQueryClientRequestToken, err)
+
+	// a retried job step gets the queries of the first run, and runs each of its queries once
+	ctx = WithJobStep(context.Background(), "job-2/step-1")
+	h1, err = c.StartQuery(ctx, "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	h2, err = c.StartQuery(ctx, "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, h1.QueryID(), h2.QueryID())
+	assert.Equal(t, 4, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+	_, err = c.StartQuery(ctx, "SELECTQueryContext_?", []driver.NamedValue{{Ordinal: 1, Value: "OK"}})
+	assert.Nil(t, err)
+	tokens := m.clientRequestTokens[len(m.clientRequestTokens)-3:]
+	assert.Equal(t, tokens[0], tokens[1])
+	assert.NotEqual(t, tokens[0], tokens[2])
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+var bigTen = big.NewInt(10)
+
+// Decimal is an exact decimal number of Athena, i.e. an unscaled integer times 10^-scale. decimal columns are
+// returned as strings, which can be scanned into a Decimal, and the decimals in ARRAY, MAP and ROW values are
+// Decimal if Config.SetExactDecimal is on.
+// A Decimal query argument is rendered as a DECIMAL literal.
+type Decimal struct {
+	unscaled  *big.Int
+	scale     int64
+	precision int64
+}
+
+// NewDecimal is to create a Decimal of unscaled * 10^-scale.
+func NewDecimal(unscaled *big.Int, scale int64) Decimal {
+	if scale < 0 {
+		unscaled = new(big.Int).Mul(unscaled, new(big.Int).Exp(bigTen, big.NewInt(-scale), nil))
+		scale = 0
+	}
+	return Decimal{unscaled: new(big.Int).Set(unscaled), scale: scale}
+}
+
+// ParseDecimal is to parse a decimal number like -12.30. The scale is the number of digits after the decimal point.
+func ParseDecimal(s string) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	digits := strings.TrimLeft(text, "+-")
+	if len(text)-len(digits) > 1 {
+		return Decimal{}, fmt.Errorf("%w: %s", ErrDecimalFormat, s)
+	}
+	var scale int64
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = int64(len(digits) - i - 1)
+		digits = digits[:i] + digits[i+1:]
+	}
+	if digits == "" || strings.TrimLeft(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("%w: %s", ErrDecimalFormat, s)
+	}
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(text, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return Decimal{unscaled: unscaled, scale: scale}, nil
+}
+
+// Unscaled returns the unscaled integer of d.
+func (d Decimal) Unscaled() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(d.unscaled)
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int64 {
+	return d.scale
+}
+
+// Precision returns the precision of the decimal column d comes from, or the number of digits in d if it doesn't
+// come from a column.
+func (d Decimal) Precision() int64 {
+	if d.precision > 0 {
+		return d.precision
+	}
+	digits := int64(len(d.Unscaled().Text(10)))
+	if d.Unscaled().Sign() < 0 {
+		digits--
+	}
+	if digits < d.scale {
+		return d.scale
+	}
+	return digits
+}
+
+// Rat returns d as a big.Rat.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Unscaled(), new(big.Int).Exp(bigTen, big.NewInt(d.scale), nil))
+}
+
+// Float64 returns the float64 value nearest to d, and whether it is exact.
+func (d Decimal) Float64() (float64, bool) {
+	return d.Rat().Float64()
+}
+
+// Cmp compares d and o, and returns -1, 0 or +1 like big.Int.Cmp. Decimals of different scales can be equal.
+func (d Decimal) Cmp(o Decimal) int {
+	return d.Rat().Cmp(o.Rat())
+}
+
+// String returns d the way Athena renders decimals, e.g. 12.30 for 1230 of scale 2.
+func (d Decimal) String() string {
+	return formatDecimal(d.Unscaled(), d.scale)
+}
+
+// withColumn is to give d the precision and the scale of a decimal column. d keeps its scale if it is bigger.
+func (d Decimal) withColumn(precision int64, scale int64) Decimal {
+	if scale > d.scale {
+		d.unscaled = new(big.Int).Mul(d.Unscaled(), new(big.Int).Exp(bigTen, big.NewInt(scale-d.scale), nil))
+		d.scale = scale
+	}
+	d.precision = precision
+	return d
+}
+
+// Scan is to implement interface sql.Scanner.
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case Decimal:
+		*d = v
+	case string:
+		*d, err = ParseDecimal(v)
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case int64:
+		*d = NewDecimal(big.NewInt(v), 0)
+	case float64:
+		*d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("%w: cannot scan %T into Decimal", ErrDecimalFormat, src)
+	}
+	return err
+}
+
+// Value is to implement interface driver.Valuer.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// NullDecimal is a Decimal that may be null.
+type NullDecimal struct {
+	Decimal Decimal
+	Valid   bool // Valid is true if Decimal is not NULL
+}
+
+// Scan is to implement interface sql.Scanner.
+func (n *NullDecimal) Scan(src interface{}) error {
+	if src == nil {
+		n.Decimal, n.Valid = Decimal{}, false
+		return nil
+	}
+	n.Valid = true
+	return n.Decimal.Scan(src)
+}
+
+// Value is to implement interface driver.Valuer.
+func (n NullDecimal) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Decimal.Value()
+}
+
+// decimalOfColumn is to convert a decimal value of a column to Decimal.
+func decimalOfColumn(columnInfo *athena.ColumnInfo, val string) (Decimal, error) {
+	d, err := ParseDecimal(val)
+	if err != nil {
+		return d, err
+	}
+	return d.withColumn(aws.Int64Value(columnInfo.Precision), aws.Int64Value(columnInfo.Scale)), nil
+}
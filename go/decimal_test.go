@@ -0,0 +1,241 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimal(t *testing.T) {
+	for s, expected := range map[string]struct {
+		unscaled int64
+		scale    int64
+		text     string
+	}{
+		"12.30":  {1230, 2, "12.30"},
+		"-0.05":  {-5, 2, "-0.05"},
+		"+7":     {7, 0, "7"},
+		"0.000":  {0, 3, "0.000"},
+		" 100 ":  {100, 0, "100"},
+		".5":     {5, 1, "0.5"},
+		"-12345": {-12345, 0, "-12345"},
+	} {
+		d, err := ParseDecimal(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, big.NewInt(expected.unscaled), d.Unscaled(), s)
+		assert.Equal(t, expected.scale, d.Scale(), s)
+		assert.Equal(t, expected.text, d.String(), s)
+	}
+	for _, s := range []string{"", "-", "1.2.3", "--1", "1e3", "abc", "1,5", "NaN"} {
+		_, err := ParseDecimal(s)
+		assert.True(t, errors.Is(err, ErrDecimalFormat), s)
+	}
+
+	// more digits than float64 can hold
+	d, err := ParseDecimal("12345678901234567890.123456789012345678")
+	assert.Nil(t, err)
+	assert.Equal(t, "12345678901234567890.123456789012345678", d.String())
+	assert.Equal(t, int64(38), d.Precision())
+	assert.Equal(t, int64(18), d.Scale())
+}
+
+func TestDecimal(t *testing.T) {
+	assert.Equal(t, "0", Decimal{}.String())
+	assert.Equal(t, int64(1), Decimal{}.Precision())
+
+	d := NewDecimal(big.NewInt(-1230), 2)
+	assert.Equal(t, "-12.30", d.String())
+	assert.Equal(t, int64(4), d.Precision())
+	assert.Equal(t, big.NewRat(-123, 10), d.Rat())
+	f, exact := d.Float64()
+	assert.Equal(t, -12.3, f)
+	assert.False(t, exact)
+	assert.Equal(t, 0, d.Cmp(NewDecimal(big.NewInt(-123), 1)))
+	assert.Equal(t, -1, d.Cmp(Decimal{}))
+	assert.Equal(t, "1200", NewDecimal(big.NewInt(12), -2).String())
+	assert.Equal(t, "0.005", NewDecimal(big.NewInt(5), 3).String())
+	assert.Equal(t, int64(3), NewDecimal(big.NewInt(5), 3).Precision())
+
+	// the unscaled value is copied
+	unscaled := big.NewInt(1)
+	d = NewDecimal(unscaled, 0)
+	unscaled.SetInt64(2)
+	d.Unscaled().SetInt64(3)
+	assert.Equal(t, "1", d.String())
+
+	d = NewDecimal(big.NewInt(15), 1).withColumn(10, 3)
+	assert.Equal(t, "1.500", d.String())
+	assert.Equal(t, int64(10), d.Precision())
+	assert.Equal(t, int64(3), d.Scale())
+	assert.Equal(t, "1.5", NewDecimal(big.NewInt(15), 1).withColumn(10, 0).String())
+}
+
+func TestDecimal_ScanValue(t *testing.T) {
+	var d Decimal
+	for src, expected := range map[interface{}]string{
+		"12.30":                      "12.30",
+		int64(-42):                   "-42",
+		0.1:                          "0.1",
+		NewDecimal(big.NewInt(5), 1): "0.5",
+	} {
+		assert.Nil(t, d.Scan(src))
+		assert.Equal(t, expected, d.String())
+	}
+	assert.Nil(t, d.Scan([]byte("1.05")))
+	assert.Equal(t, "1.05", d.String())
+	assert.True(t, errors.Is(d.Scan(nil), ErrDecimalFormat))
+	assert.True(t, errors.Is(d.Scan(true), ErrDecimalFormat))
+	assert.True(t, errors.Is(d.Scan("x"), ErrDecimalFormat))
+
+	v, err := NewDecimal(big.NewInt(1230), 2).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "12.30", v)
+
+	var n NullDecimal
+	assert.Nil(t, n.Scan("1.5"))
+	assert.True(t, n.Valid)
+	assert.Equal(t, "1.5", n.Decimal.String())
+	v, err = n.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.5", v)
+	assert.Nil(t, n.Scan(nil))
+	assert.False(t, n.Valid)
+	v, err = n.Value()
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestRows_AthenaTypeToGoType_ExactDecimal(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r, _ := NewRows(context.Background(), newMockAthenaClient(), "SELECT_OK", testConf,
+		NewDefaultObservability(testConf))
+	column := newColumnInfo("price", "decimal")
+	column.Precision, column.Scale = aws.Int64(10), aws.Int64(2)
+	v, err := r.athenaTypeToGoType(column, aws.String("12.3"), testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "12.3", v)
+	assert.Equal(t, "", r.getDefaultValueForColumnType("decimal"))
+
+	testConf.SetExactDecimal(true)
+	assert.True(t, testConf.IsExactDecimal())
+	v, err = r.athenaTypeToGoType(column, aws.String("12.3"), testConf)
+	assert.Nil(t, err)
+	d := v.(Decimal)
+	assert.Equal(t, "12.30", d.String())
+	assert.Equal(t, int64(10), d.Precision())
+	assert.Equal(t, int64(2), d.Scale())
+	// the driver.Value of a column is the string of the Decimal
+	v, err = r.columnValue(column, aws.String("12.3"), testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "12.30", v)
+	_, err = r.athenaTypeToGoType(column, aws.String("twelve"), testConf)
+	assert.True(t, errors.Is(err, ErrDecimalFormat))
+	assert.Equal(t, "0", r.getDefaultValueForColumnType("decimal"))
+
+	testConf.SetMissingAsEmptyString(false)
+	testConf.SetMissingAsDefault(true)
+	v, err = r.columnValue(column, nil, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "0", v)
+
+	r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[0] = column
+	assert.Equal(t, reflect.TypeOf(""), r.ColumnTypeScanType(0))
+	testConf.SetExactDecimal(false)
+	assert.Equal(t, reflect.TypeOf(""), r.ColumnTypeScanType(0))
+}
+
+func TestRows_ExactDecimal_Scan(t *testing.T) {
+	c, reader := createS3ResultTestConnection(t, "\"price\"\n\"12.30\"\n", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	metadataPath := filepath.Join(reader.root, "fake-query-results-arbitrary-bucket",
+		"SELECTQueryContext_OK_QID.csv.metadata")
+	assert.Nil(t, ioutil.WriteFile(metadataPath, []byte(newResultMetadata("price", "decimal")), 0600))
+	c.connector.config.SetExactDecimal(true)
+	db := sql.OpenDB(&testConnector{conn: c})
+	defer db.Close()
+
+	var s string
+	assert.Nil(t, db.QueryRow("SELECTQueryContext_OK").Scan(&s))
+	assert.Equal(t, "12.30", s)
+	var d Decimal
+	assert.Nil(t, db.QueryRow("SELECTQueryContext_OK").Scan(&d))
+	assert.Equal(t, "12.30", d.String())
+	var n NullDecimal
+	assert.Nil(t, db.QueryRow("SELECTQueryContext_OK").Scan(&n))
+	assert.True(t, n.Valid)
+	assert.Equal(t, 0, n.Decimal.Cmp(d))
+	var i interface{}
+	assert.Nil(t, db.QueryRow("SELECTQueryContext_OK").Scan(&i))
+	assert.Equal(t, "12.30", i)
+}
+
+func TestAppendSQLLiteral_Decimal(t *testing.T) {
+	d := NewDecimal(big.NewInt(-1230), 2)
+	buf, err := appendSQLLiteral([]byte{}, d)
+	assert.Nil(t, err)
+	assert.Equal(t, "DECIMAL '-12.30'", string(buf))
+
+	buf, err = appendCompositeLiteral([]byte{}, reflect.ValueOf([]interface{}{d, &d, (*Decimal)(nil),
+		NullDecimal{Decimal: d, Valid: true}, NullDecimal{}}))
+	assert.Nil(t, err)
+	assert.Equal(t, "ARRAY[DECIMAL '-12.30', DECIMAL '-12.30', NULL, DECIMAL '-12.30', NULL]", string(buf))
+
+	c := &Connection{}
+	for arg, expected := range map[interface{}]driver.Value{
+		d:                                    d,
+		&d:                                   d,
+		(*Decimal)(nil):                      nil,
+		NullDecimal{Decimal: d, Valid: true}: d,
+		NullDecimal{}:                        nil,
+	} {
+		nv := driver.NamedValue{Ordinal: 1, Value: arg}
+		assert.Nil(t, c.CheckNamedValue(&nv))
+		assert.Equal(t, expected, nv.Value)
+	}
+
+	query, err := c.interpolateParams("SELECT * FROM t WHERE price > ? AND day = ?",
+		[]driver.Value{d, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE price > DECIMAL '-12.30' AND day = TIMESTAMP '2020-01-02 00:00:00.000'",
+		query)
+}
+
+func TestRowsToCSV_Decimal(t *testing.T) {
+	sqlRows := sqlmock.NewRows([]string{"id", "price", "note"})
+	sqlRows.AddRow(int64(1), NewDecimal(big.NewInt(1230), 2), nil)
+	rows := mockRowsToSQLRows(sqlRows)
+	assert.Equal(t, "1,12.30,\n", RowsToCSV(rows))
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryDirectivePrefix starts a directive comment, which sets driver options for a single query, like
+// `-- athenadriver: workgroup=etl, db=raw, timeout=600, moneywise=true, cache=off`.
+const queryDirectivePrefix = "athenadriver:"
+
+// applyQueryDirectives is to apply the directive comments at the beginning of query to ctx, as if the query was
+// run with the context helpers like WithWorkgroup. The directives are stripped from the returned query, unless
+// keep is true. An unknown option or a bad value is an ErrQueryDirective.
+//
+// The options are:
+//
+//	workgroup=<name>      WithWorkgroup
+//	db=<name>             WithDatabase
+//	catalog=<name>        WithCatalog
+//	output=<s3 location>  WithOutputLocation
+//	timeout=<seconds>     WithQueryTimeout
+//	moneywise=<bool>      WithMoneyWise
+//	cache=on|off          WithoutResultCache if off
+//	reuse=<minutes>|off   WithResultReuse, or WithoutResultReuse if off
+func applyQueryDirectives(ctx context.Context, query string, keep bool) (context.Context, string, error) {
+	var b strings.Builder
+	last := 0
+	for _, t := range lexSQL(query) {
+		if t.kind == sqlCode && strings.TrimSpace(query[t.start:t.end]) == "" || t.kind == sqlBlockComment {
+			continue
+		}
+		if t.kind != sqlLineComment {
+			break
+		}
+		directive := strings.TrimSpace(query[t.start+2 : t.end])
+		if !strings.HasPrefix(strings.ToLower(directive), queryDirectivePrefix) {
+			continue
+		}
+		var err error
+		ctx, err = applyQueryDirective(ctx, directive[len(queryDirectivePrefix):])
+		if err != nil {
+			return ctx, query, err
+		}
+		// strip the comment with the end of its line
+		end := t.end
+		if end < len(query) && query[end] == '\n' {
+			end++
+		}
+		b.WriteString(query[last:t.start])
+		last = end
+	}
+	if keep || last == 0 {
+		return ctx, query, nil
+	}
+	b.WriteString(query[last:])
+	return ctx, b.String(), nil
+}
+
+// applyQueryDirective is to apply the comma-separated options of one directive comment to ctx.
+func applyQueryDirective(ctx context.Context, options string) (context.Context, error) {
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return ctx, fmt.Errorf("%w: %s", ErrQueryDirective, option)
+		}
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		switch key {
+		case "workgroup":
+			ctx = WithWorkgroup(ctx, value)
+		case "db":
+			ctx = WithDatabase(ctx, value)
+		case "catalog":
+			ctx = WithCatalog(ctx, value)
+		case "output":
+			ctx = WithOutputLocation(ctx, value)
+		case "timeout":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return ctx, fmt.Errorf("%w: %s", ErrQueryDirective, option)
+			}
+			ctx = WithQueryTimeout(ctx, time.Duration(seconds)*time.Second)
+		case "moneywise":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return ctx, fmt.Errorf("%w: %s", ErrQueryDirective, option)
+			}
+			ctx = WithMoneyWise(ctx, b)
+		case "cache":
+			switch strings.ToLower(value) {
+			case "on":
+				ctx = context.WithValue(ctx, ResultCacheKey, true)
+			case "off":
+				ctx = WithoutResultCache(ctx)
+			default:
+				return ctx, fmt.Errorf("%w: %s", ErrQueryDirective, option)
+			}
+		case "reuse":
+			if strings.ToLower(value) == "off" {
+				ctx = WithoutResultReuse(ctx)
+				break
+			}
+			minutes, err := strconv.Atoi(value)
+			if err != nil || minutes <= 0 {
+				return ctx, fmt.Errorf("%w: %s", ErrQueryDirective, option)
+			}
+			ctx = WithResultReuse(ctx, time.Duration(minutes)*time.Minute)
+		default:
+			return ctx, fmt.Errorf("%w: %s", ErrQueryDirective, option)
+		}
+	}
+	return ctx, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyQueryDirectives(t *testing.T) {
+	query := "-- athenadriver: workgroup=etl, db=raw, timeout=600, moneywise=true, cache=off\n" +
+		"/* daily report */\n" +
+		"-- ATHENADRIVER: catalog=lambda, output=s3://bucket/etl/, reuse=30\n" +
+		"-- a plain comment\n" +
+		"SELECT 1 -- athenadriver: db=ignored"
+	ctx, q, err := applyQueryDirectives(context.Background(), query, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "/* daily report */\n-- a plain comment\nSELECT 1 -- athenadriver: db=ignored", q)
+	assert.Equal(t, "etl", ctx.Value(WorkgroupKey))
+	assert.Equal(t, "raw", ctx.Value(DatabaseKey))
+	assert.Equal(t, 10*time.Minute, ctx.Value(QueryTimeoutKey))
+	assert.Equal(t, true, ctx.Value(MoneyWiseKey))
+	assert.False(t, isResultCacheEnabled(ctx))
+	assert.Equal(t, "lambda", ctx.Value(CatalogKey))
+	assert.Equal(t, "s3://bucket/etl/", ctx.Value(OutputLocationKey))
+	r := resultReuseConfiguration(ctx, NewNoOpsConfig())
+	assert.Equal(t, int64(30), aws.Int64Value(r.ResultReuseByAgeConfiguration.MaxAgeInMinutes))
+
+	_, q, err = applyQueryDirectives(context.Background(), query, true)
+	assert.Nil(t, err)
+	assert.Equal(t, query, q)
+
+	ctx, q, err = applyQueryDirectives(context.Background(), "SELECT '-- athenadriver: db=raw'", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT '-- athenadriver: db=raw'", q)
+	assert.Nil(t, ctx.Value(DatabaseKey))
+	assert.True(t, isResultCacheEnabled(ctx))
+
+	ctx, _, err = applyQueryDirectives(context.Background(), "-- athenadriver: cache=on, reuse=off\nSELECT 1", false)
+	assert.Nil(t, err)
+	assert.True(t, isResultCacheEnabled(ctx))
+	r = resultReuseConfiguration(ctx, NewNoOpsConfig())
+	assert.False(t, aws.BoolValue(r.ResultReuseByAgeConfiguration.Enabled))
+
+	for _, directive := range []string{"colour=red", "db", "db=", "timeout=ten", "moneywise=maybe", "cache=maybe",
+		"reuse=0"} {
+		_, _, err = applyQueryDirectives(context.Background(), "-- athenadriver: "+directive+"\nSELECT 1", false)
+		assert.True(t, errors.Is(err, ErrQueryDirective), directive)
+	}
+}
+
+func TestConnection_QueryContext_Directives(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	m.GetWGStatus = true
+	_, err := c.QueryContext(context.Background(), "-- athenadriver: workgroup=etl, db=raw\nSELECTQueryContext_OK",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+	assert.Equal(t, "etl", m.workGroup)
+	assert.Equal(t, "raw", aws.StringValue(m.queryExecutionContext.Database))
+
+	h, err := c.StartQuery(context.Background(), "-- athenadriver: moneywise=true\nSELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.True(t, h.(*queryHandle).config.IsMoneyWise())
+	assert.Equal(t, DefaultWGName, m.workGroup)
+
+	_, err = c.QueryContext(context.Background(), "-- athenadriver: db\nSELECTQueryContext_OK", []driver.NamedValue{})
+	assert.True(t, errors.Is(err, ErrQueryDirective))
+}
+
+func TestConnection_QueryContext_DirectiveCacheOff(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	c.connector.SetResultCache(NewMemoryResultCache(10, time.Hour))
+	for i := 0; i < 2; i++ {
+		_, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+
+	_, err := c.QueryContext(context.Background(), "-- athenadriver: cache=off\nSELECTQueryContext_OK",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.startQueryExecutionCalls["SELECTQueryContext_OK"])
+}
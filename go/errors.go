@@ -21,8 +21,10 @@
 package athenadriver
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Various errors the driver might return. Can change between driver versions.
@@ -34,13 +36,137 @@ var (
 	ErrConfigWGPointer              = errors.New("workgroup pointer is nil")
 	ErrConfigAccessIDRequired       = errors.New("AWS access ID is required")
 	ErrConfigAccessKeyRequired      = errors.New("AWS access Key is required")
+	ErrConfigEncryptionOption       = errors.New("encryption option must be SSE_S3, SSE_KMS or CSE_KMS")
+	ErrConfigKMSKeyRequired         = errors.New("KMS key is required for SSE_KMS and CSE_KMS encryption")
+	ErrConfigS3ACLOption            = errors.New("S3 ACL option must be BUCKET_OWNER_FULL_CONTROL")
+	ErrConfigResultMode             = errors.New("result mode must be api, s3 or unload")
+	ErrConfigResultPageSize         = errors.New("result page size must be between 1 and 1000")
+	ErrDecimalFormat                = errors.New("invalid decimal")
+	ErrComplexType                  = errors.New("invalid ARRAY, MAP or ROW type")
+	ErrComplexValue                 = errors.New("invalid ARRAY, MAP or ROW value")
 	ErrQueryUnknownType             = errors.New("query parameter type is unknown")
 	ErrQueryBufferOF                = errors.New("query buffer overflow")
 	ErrQueryTimeout                 = errors.New("query timeout")
+	ErrQueryMixedArgs               = errors.New("named and positional query arguments can't be mixed")
+	ErrQueryMissingNamedArg         = errors.New("named query argument is missing")
+	ErrQueryUnusedNamedArg          = errors.New("named query argument is not used in the query")
+	ErrQueryDuplicateNamedArg       = errors.New("named query argument is passed more than once")
+	ErrQueryDirective               = errors.New("query directive is invalid")
+	ErrQueryClientRequestToken      = errors.New("ClientRequestToken must be 32 to 128 characters")
+	ErrQueryDuplicateSubmission     = errors.New("ClientRequestToken was used to submit a different query")
 	ErrAthenaTransactionUnsupported = errors.New("Athena doesn't support transaction statements")
 	ErrAthenaNilDatum               = errors.New("*athena.Datum must not be nil")
 	ErrAthenaNilAPI                 = errors.New("athenaAPI must not be nil")
+	ErrS3ResultLocation             = errors.New("query result location is not an S3 URI")
+	ErrResultCSV                    = errors.New("query result CSV is malformed")
+	ErrResultMetadata               = errors.New("query result metadata file is malformed")
+	ErrParquet                      = errors.New("query result Parquet file is malformed")
+	ErrParquetUnsupported           = errors.New("query result Parquet file is not supported")
 	ErrTestMockGeneric              = errors.New("some_mock_error_for_test")
 	ErrTestMockFailedByAthena       = errors.New("the reason why Athena failed the query")
 	ErrServiceLimitOverride         = fmt.Errorf("service limit override must be greater than %d", PoolInterval)
 )
+
+// Error categories of a failed query, as in athena.AthenaError.ErrorCategory.
+// https://docs.aws.amazon.com/athena/latest/ug/error-reference.html
+const (
+	AthenaErrorCategorySystem = 1
+	AthenaErrorCategoryUser   = 2
+	AthenaErrorCategoryOther  = 3
+)
+
+// QueryFailedError is returned when a query execution ends up in the FAILED state.
+// ErrorCategory, ErrorType and Retryable come from the AthenaError of the query execution,
+// and are zero values if Athena doesn't report one.
+type QueryFailedError struct {
+	QueryID       string
+	Workgroup     string
+	Region        string
+	Reason        string
+	ErrorCategory int64
+	ErrorType     int64
+	ErrorMessage  string
+	Retryable     bool
+}
+
+// Error implements the error interface.
+func (e *QueryFailedError) Error() string {
+	return fmt.Sprintf("query %s failed: %s", e.QueryID, e.Reason)
+}
+
+// IsUserError reports whether the query failed because of the query itself, e.g. a syntax error
+// or a missing table.
+func (e *QueryFailedError) IsUserError() bool {
+	return e.ErrorCategory == AthenaErrorCategoryUser
+}
+
+// IsSystemError reports whether the query failed because of Athena.
+func (e *QueryFailedError) IsSystemError() bool {
+	return e.ErrorCategory == AthenaErrorCategorySystem
+}
+
+// ConsoleURL returns the link to the query execution in the AWS console.
+func (e *QueryFailedError) ConsoleURL() string {
+	return consoleURL(e.Region, e.QueryID)
+}
+
+// QueryCancelledError is returned when a query execution ends up in the CANCELLED state.
+// It matches context.Canceled with errors.Is, which was returned in this case before.
+type QueryCancelledError struct {
+	QueryID   string
+	Workgroup string
+	Region    string
+	Reason    string
+}
+
+// Error implements the error interface.
+func (e *QueryCancelledError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("query %s was cancelled", e.QueryID)
+	}
+	return fmt.Sprintf("query %s was cancelled: %s", e.QueryID, e.Reason)
+}
+
+// Is reports whether target is context.Canceled.
+func (e *QueryCancelledError) Is(target error) bool {
+	return target == context.Canceled
+}
+
+// ConsoleURL returns the link to the query execution in the AWS console.
+func (e *QueryCancelledError) ConsoleURL() string {
+	return consoleURL(e.Region, e.QueryID)
+}
+
+// QueryTimeoutError is returned when a query runs longer than the Athena service limit of its statement type.
+// It matches ErrQueryTimeout with errors.Is, which was returned in this case before.
+type QueryTimeoutError struct {
+	QueryID       string
+	Workgroup     string
+	Region        string
+	StatementType string
+	Elapsed       time.Duration
+}
+
+// Error implements the error interface.
+func (e *QueryTimeoutError) Error() string {
+	return fmt.Sprintf("query %s timeout after %s", e.QueryID, e.Elapsed.Round(time.Second))
+}
+
+// Is reports whether target is ErrQueryTimeout.
+func (e *QueryTimeoutError) Is(target error) bool {
+	return target == ErrQueryTimeout
+}
+
+// ConsoleURL returns the link to the query execution in the AWS console.
+func (e *QueryTimeoutError) ConsoleURL() string {
+	return consoleURL(e.Region, e.QueryID)
+}
+
+// consoleURL is to build the link to a query execution in the Athena console.
+func consoleURL(region string, queryID string) string {
+	if region == "" || region == DummyRegion || queryID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/athena/home?region=%s#/query-editor/history/%s",
+		region, region, queryID)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import "strings"
+
+// sqlTokenKind is the kind of a sqlToken.
+type sqlTokenKind int
+
+const (
+	// sqlCode is SQL code outside of quotes and comments.
+	sqlCode sqlTokenKind = iota
+	// sqlString is a single-quoted string literal, where '' is an escaped quote.
+	sqlString
+	// sqlQuotedIdentifier is a double-quoted identifier, where "" is an escaped quote.
+	sqlQuotedIdentifier
+	// sqlLineComment is a comment from -- to the end of the line.
+	sqlLineComment
+	// sqlBlockComment is a comment between /* and */.
+	sqlBlockComment
+	// sqlPlaceholder is a ? placeholder of a positional query parameter.
+	sqlPlaceholder
+)
+
+// sqlToken is a piece of a query in Athena/Trino SQL. The tokens of a query cover all of its text.
+type sqlToken struct {
+	kind  sqlTokenKind
+	start int
+	end   int
+}
+
+// lexSQL is to split query into tokens, so that a ? or : in a string literal, quoted identifier or comment
+// is not mistaken for a placeholder. An unterminated string, identifier or comment runs to the end of query.
+func lexSQL(query string) []sqlToken {
+	var tokens []sqlToken
+	codeStart := 0
+	emit := func(kind sqlTokenKind, start int, end int) {
+		if codeStart < start {
+			tokens = append(tokens, sqlToken{kind: sqlCode, start: codeStart, end: start})
+		}
+		tokens = append(tokens, sqlToken{kind: kind, start: start, end: end})
+		codeStart = end
+	}
+	for i := 0; i < len(query); {
+		switch ch := query[i]; {
+		case ch == '\'' || ch == '"':
+			kind := sqlString
+			if ch == '"' {
+				kind = sqlQuotedIdentifier
+			}
+			end := len(query)
+			for j := i + 1; j < len(query); j++ {
+				if query[j] == ch {
+					if j+1 < len(query) && query[j+1] == ch {
+						j++
+						continue
+					}
+					end = j + 1
+					break
+				}
+			}
+			emit(kind, i, end)
+			i = end
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i
+			}
+			emit(sqlLineComment, i, end)
+			i = end
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 4
+			}
+			emit(sqlBlockComment, i, end)
+			i = end
+		case ch == '?':
+			emit(sqlPlaceholder, i, i+1)
+			i++
+		default:
+			i++
+		}
+	}
+	if codeStart < len(query) {
+		tokens = append(tokens, sqlToken{kind: sqlCode, start: codeStart, end: len(query)})
+	}
+	return tokens
+}
+
+// placeholderPositions is to get the positions of the ? placeholders in query.
+func placeholderPositions(query string) []int {
+	var positions []int
+	for _, t := range lexSQL(query) {
+		if t.kind == sqlPlaceholder {
+			positions = append(positions, t.start)
+		}
+	}
+	return positions
+}
+
+// countPlaceholders is to count the ? placeholders in query.
+func countPlaceholders(query string) int {
+	return len(placeholderPositions(query))
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLexSQL(t *testing.T) {
+	query := `SELECT 'a?''b', "c?""d" -- e?
+FROM t /* f? */ WHERE g = ?`
+	tokens := lexSQL(query)
+	var kinds []sqlTokenKind
+	var texts []string
+	for _, tok := range tokens {
+		kinds = append(kinds, tok.kind)
+		texts = append(texts, query[tok.start:tok.end])
+	}
+	assert.Equal(t, []sqlTokenKind{sqlCode, sqlString, sqlCode, sqlQuotedIdentifier, sqlCode, sqlLineComment,
+		sqlCode, sqlBlockComment, sqlCode, sqlPlaceholder}, kinds)
+	assert.Equal(t, []string{"SELECT ", "'a?''b'", ", ", `"c?""d"`, " ", "-- e?", "\nFROM t ", "/* f? */",
+		" WHERE g = ", "?"}, texts)
+
+	// unterminated tokens run to the end of the query
+	for _, query := range []string{"SELECT 'a?", `SELECT "a?`, "SELECT 1 -- a?", "SELECT /* a?"} {
+		tokens = lexSQL(query)
+		assert.Len(t, tokens, 2)
+		assert.Equal(t, len(query), tokens[1].end)
+	}
+	assert.Len(t, lexSQL(""), 0)
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	assert.Equal(t, 0, countPlaceholders("SELECT json_extract(x, '$.a?')"))
+	assert.Equal(t, 2, countPlaceholders(`SELECT "col?", ? FROM t -- what?
+WHERE a = ?`))
+	assert.Equal(t, []int{7, 10}, placeholderPositions("SELECT ?, ?"))
+}
+
+func TestStatement_NumInput_Literal(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	stmt, err := c.PrepareContext(context.Background(), "SELECT '?', \"?\", ? -- ?")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stmt.NumInput())
+}
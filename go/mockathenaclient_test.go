@@ -24,6 +24,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -46,6 +47,55 @@ type mockAthenaClient struct {
 	CreateWGStatus bool
 	GetWGStatus    bool
 	WGDisabled     bool
+	WGNotFound     bool
+
+	// getWorkGroupCalls counts GetWorkGroupWithContext calls.
+	getWorkGroupCalls int
+
+	// getQueryResultsCalls counts GetQueryResultsWithContext calls by query ID.
+	getQueryResultsCalls map[string]int
+
+	// getQueryExecutionCalls counts GetQueryExecutionWithContext calls by query ID.
+	getQueryExecutionCalls map[string]int
+
+	// startQueryExecutionCalls counts StartQueryExecution calls by query string.
+	startQueryExecutionCalls map[string]int
+
+	// stopQueryExecutionCalls counts StopQueryExecutionWithContext calls by query ID.
+	stopQueryExecutionCalls map[string]int
+
+	// preparedStatements maps the names of the prepared statements to their queries.
+	preparedStatements map[string]string
+
+	// executionParameters are the ExecutionParameters of the last StartQueryExecution call.
+	executionParameters []*string
+
+	// queryExecutionContext is the QueryExecutionContext of the last StartQueryExecution call.
+	queryExecutionContext *athena.QueryExecutionContext
+
+	// resultConfiguration is the ResultConfiguration of the last StartQueryExecution call.
+	resultConfiguration *athena.ResultConfiguration
+
+	// workGroup is the WorkGroup of the last StartQueryExecution call.
+	workGroup string
+
+	// createWorkGroupInput is the input of the last CreateWorkGroup call.
+	createWorkGroupInput *athena.CreateWorkGroupInput
+
+	// clientRequestTokens are the ClientRequestTokens of the StartQueryExecution calls.
+	clientRequestTokens []string
+
+	// submissions maps the ClientRequestTokens to the queries started with them.
+	submissions map[string]mockSubmission
+
+	// queryExecutions overrides the query executions returned by GetQueryExecutionWithContext by query ID.
+	queryExecutions map[string]*athena.QueryExecution
+}
+
+// mockSubmission is a query started by StartQueryExecution with a ClientRequestToken.
+type mockSubmission struct {
+	query  string
+	output *athena.StartQueryExecutionOutput
 }
 
 func newMockAthenaClient() *mockAthenaClient {
@@ -68,7 +118,15 @@ func newMockAthenaClient() *mockAthenaClient {
 			"00000000-0000-0000-0000-000000000000": PingResponse,
 			"pc:get_query_id":                      PingResponse,
 			"FAILED_AFTER_GETQID":                  MissingDataResponse,
+			"11111111-1111-1111-1111-111111111111": PingResponse,
+			"66666666-6666-6666-6666-666666666666": PingResponse,
 		},
+		getQueryResultsCalls:     map[string]int{},
+		getQueryExecutionCalls:   map[string]int{},
+		startQueryExecutionCalls: map[string]int{},
+		stopQueryExecutionCalls:  map[string]int{},
+		preparedStatements:       map[string]string{},
+		submissions:              map[string]mockSubmission{},
 	}
 	return &m
 }
@@ -91,6 +149,7 @@ func (m *mockAthenaClient) GetQueryResultsWithContext(ctx aws.Context,
 	if query.NextToken != nil {
 		nextToken = *query.NextToken
 	}
+	m.getQueryResultsCalls[*query.QueryExecutionId]++
 	if *query.QueryExecutionId == "GetQueryResultsWithContext_return_error" {
 		return nil, ErrTestMockGeneric
 	}
@@ -102,6 +161,11 @@ func (m *mockAthenaClient) GetQueryResultsWithContext(ctx aws.Context,
 
 func (m *mockAthenaClient) GetWorkGroupWithContext(ctx aws.Context, gwi *athena.GetWorkGroupInput,
 	opt ...request.Option) (*athena.GetWorkGroupOutput, error) {
+	m.getWorkGroupCalls++
+	if m.WGNotFound {
+		return nil, awserr.NewRequestFailure(awserr.New(athena.ErrCodeInvalidRequestException,
+			"WorkGroup is not found.", nil), 400, "")
+	}
 	if m.GetWGStatus {
 		enabled := "ENABLED"
 		if m.WGDisabled {
@@ -118,8 +182,9 @@ func (m *mockAthenaClient) GetWorkGroupWithContext(ctx aws.Context, gwi *athena.
 	return nil, ErrTestMockGeneric
 }
 
-func (m *mockAthenaClient) CreateWorkGroup(*athena.CreateWorkGroupInput) (
+func (m *mockAthenaClient) CreateWorkGroup(input *athena.CreateWorkGroupInput) (
 	*athena.CreateWorkGroupOutput, error) {
+	m.createWorkGroupInput = input
 	if !m.CreateWGStatus {
 		return nil, ErrTestMockGeneric
 	}
@@ -127,8 +192,56 @@ func (m *mockAthenaClient) CreateWorkGroup(*athena.CreateWorkGroupInput) (
 	return &a, nil
 }
 
-func (m *mockAthenaClient) StartQueryExecution(s *athena.
+// StartQueryExecutionWithContext returns the output of the first call with the same ClientRequestToken like Athena,
+// or fails if the token was used for another query.
+func (m *mockAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	token := aws.StringValue(s.ClientRequestToken)
+	m.clientRequestTokens = append(m.clientRequestTokens, token)
+	if submission, ok := m.submissions[token]; ok && token != "" {
+		if submission.query != *s.QueryString {
+			return nil, awserr.New(athena.ErrCodeInvalidRequestException,
+				"Idempotent parameters do not match", nil)
+		}
+		return submission.output, nil
+	}
+	output, err := m.startQueryExecution(s)
+	if err == nil && output != nil && token != "" {
+		m.submissions[token] = mockSubmission{query: *s.QueryString, output: output}
+	}
+	return output, err
+}
+
+func (m *mockAthenaClient) startQueryExecution(s *athena.
 	StartQueryExecutionInput) (*athena.StartQueryExecutionOutput, error) {
+	m.startQueryExecutionCalls[*s.QueryString]++
+	m.executionParameters = s.ExecutionParameters
+	m.queryExecutionContext = s.QueryExecutionContext
+	m.resultConfiguration = s.ResultConfiguration
+	m.workGroup = aws.StringValue(s.WorkGroup)
+	if strings.HasPrefix(*s.QueryString, "EXECUTE ") {
+		if _, ok := m.preparedStatements[strings.TrimPrefix(*s.QueryString, "EXECUTE ")]; !ok {
+			return nil, ErrTestMockGeneric
+		}
+		qid := "00000000-0000-0000-0000-000000000000"
+		return &athena.StartQueryExecutionOutput{
+			QueryExecutionId: &qid,
+		}, nil
+	}
+	if *s.QueryString == "RESULT_REUSE" {
+		qid := "00000000-0000-0000-0000-000000000000"
+		if r := s.ResultReuseConfiguration; r != nil && aws.BoolValue(r.ResultReuseByAgeConfiguration.Enabled) {
+			qid = "66666666-6666-6666-6666-666666666666"
+		}
+		return &athena.StartQueryExecutionOutput{
+			QueryExecutionId: &qid,
+		}, nil
+	}
+	if qid := resubmittedQueryID(*s.QueryString, m.startQueryExecutionCalls[*s.QueryString]); qid != "" {
+		return &athena.StartQueryExecutionOutput{
+			QueryExecutionId: &qid,
+		}, nil
+	}
 	if strings.ToLower(*s.QueryString) == "select 1" { // Ping
 		qid := "PING_OK_QID"
 		return &athena.StartQueryExecutionOutput{
@@ -143,7 +256,16 @@ func (m *mockAthenaClient) StartQueryExecution(s *athena.
 	}
 	if *s.QueryString == "SELECTQueryContext_OK" ||
 		*s.QueryString == "SELECTQueryContext_'OK'" ||
-		*s.QueryString == "SELECTQueryContext_?" { // Ping
+		*s.QueryString == "SELECTQueryContext_?" ||
+		*s.QueryString == "SELECTQueryContext_OK = ?" ||
+		*s.QueryString == "SELECTQueryContext_OK = 'OK'" ||
+		*s.QueryString == "SELECTQueryContext_OK IN ('a', 'b''c') AND x = ?" { // Ping
+		qid := "SELECTQueryContext_OK_QID"
+		return &athena.StartQueryExecutionOutput{
+			QueryExecutionId: &qid,
+		}, nil
+	}
+	if strings.HasPrefix(*s.QueryString, "UNLOAD (\nSELECTQueryContext_OK\n) TO ") {
 		qid := "SELECTQueryContext_OK_QID"
 		return &athena.StartQueryExecutionOutput{
 			QueryExecutionId: &qid,
@@ -218,6 +340,14 @@ func (m *mockAthenaClient) StartQueryExecution(s *athena.
 
 func (m *mockAthenaClient) GetQueryExecutionWithContext(c aws.Context,
 	input *athena.GetQueryExecutionInput, o ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	m.getQueryExecutionCalls[*input.QueryExecutionId]++
+	if execution, ok := m.queryExecutions[*input.QueryExecutionId]; ok {
+		return &athena.GetQueryExecutionOutput{QueryExecution: execution}, nil
+	}
+	if output := attachedQueryExecution(*input.QueryExecutionId,
+		m.getQueryExecutionCalls[*input.QueryExecutionId]); output != nil {
+		return output, nil
+	}
 	if *input.QueryExecutionId == "When_StartQueryExecution_Succeed_but_GetQueryExecutionWithContext_return_nil_and_error_QID" {
 		return nil, ErrTestMockGeneric
 	}
@@ -373,9 +503,114 @@ func (m *mockAthenaClient) GetQueryExecutionWithContext(c aws.Context,
 	return nil, ErrTestMockGeneric
 }
 
+// attachedQueryExecution mocks the status of queries which were submitted before, and are re-attached by QID.
+func attachedQueryExecution(qid string, calls int) *athena.GetQueryExecutionOutput {
+	var stat, reason string
+	switch qid {
+	case "00000000-0000-0000-0000-000000000000":
+		stat = athena.QueryExecutionStateSucceeded
+	case "11111111-1111-1111-1111-111111111111":
+		// still running when it is re-attached
+		stat = athena.QueryExecutionStateRunning
+		if calls > 1 {
+			stat = athena.QueryExecutionStateSucceeded
+		}
+	case "22222222-2222-2222-2222-222222222222":
+		stat = athena.QueryExecutionStateFailed
+		reason = "SYNTAX_ERROR: line 1:8: Column 'x' cannot be resolved"
+	case "33333333-3333-3333-3333-333333333333":
+		stat = athena.QueryExecutionStateCancelled
+	case "44444444-4444-4444-4444-444444444444":
+		stat = athena.QueryExecutionStateFailed
+		reason = "GENERIC_INTERNAL_ERROR: transient failure"
+	case "66666666-6666-6666-6666-666666666666":
+		// the result of a previous run is reused
+		stat = athena.QueryExecutionStateSucceeded
+	case "55555555-5555-5555-5555-555555555555":
+		stat = athena.QueryExecutionStateFailed
+		reason = "HIVE_CANNOT_OPEN_SPLIT: Please reduce your request rate. (Service: Amazon S3; Error Code: SlowDown)"
+	default:
+		return nil
+	}
+	var dataScanned = int64(123)
+	submitted := time.Now().Add(-time.Minute)
+	stt := "DML"
+	var athenaError *athena.AthenaError
+	if stat == athena.QueryExecutionStateFailed {
+		athenaError = &athena.AthenaError{
+			ErrorCategory: aws.Int64(AthenaErrorCategoryUser),
+			ErrorType:     aws.Int64(1006),
+			ErrorMessage:  aws.String(reason),
+			Retryable:     aws.Bool(false),
+		}
+		if qid == "44444444-4444-4444-4444-444444444444" {
+			athenaError.ErrorCategory = aws.Int64(AthenaErrorCategorySystem)
+			athenaError.ErrorType = aws.Int64(1000)
+			athenaError.Retryable = aws.Bool(true)
+		}
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: &qid,
+			Status: &athena.QueryExecutionStatus{
+				State:              &stat,
+				StateChangeReason:  &reason,
+				SubmissionDateTime: &submitted,
+				AthenaError:        athenaError,
+			},
+			StatementType: &stt,
+			Statistics: &athena.QueryExecutionStatistics{
+				DataScannedInBytes: &dataScanned,
+				ResultReuseInformation: &athena.ResultReuseInformation{
+					ReusedPreviousResult: aws.Bool(qid == "66666666-6666-6666-6666-666666666666"),
+				},
+			},
+		},
+	}
+}
+
+func (m *mockAthenaClient) CreatePreparedStatementWithContext(ctx aws.Context,
+	input *athena.CreatePreparedStatementInput, opt ...request.Option) (*athena.CreatePreparedStatementOutput, error) {
+	if *input.QueryStatement == "CreatePreparedStatement_error" {
+		return nil, ErrTestMockGeneric
+	}
+	m.preparedStatements[*input.StatementName] = *input.QueryStatement
+	return &athena.CreatePreparedStatementOutput{}, nil
+}
+
+func (m *mockAthenaClient) DeletePreparedStatementWithContext(ctx aws.Context,
+	input *athena.DeletePreparedStatementInput, opt ...request.Option) (*athena.DeletePreparedStatementOutput, error) {
+	if _, ok := m.preparedStatements[*input.StatementName]; !ok {
+		return nil, ErrTestMockGeneric
+	}
+	delete(m.preparedStatements, *input.StatementName)
+	return &athena.DeletePreparedStatementOutput{}, nil
+}
+
+// resubmittedQueryID is to fail the first submissions of a query with a transient failure.
+func resubmittedQueryID(query string, calls int) string {
+	switch query {
+	case "RESUBMIT_RETRYABLE":
+		if calls == 1 {
+			return "44444444-4444-4444-4444-444444444444"
+		}
+		return "00000000-0000-0000-0000-000000000000"
+	case "RESUBMIT_PATTERN":
+		if calls <= 2 {
+			return "55555555-5555-5555-5555-555555555555"
+		}
+		return "00000000-0000-0000-0000-000000000000"
+	case "RESUBMIT_NEVER":
+		return "22222222-2222-2222-2222-222222222222"
+	}
+	return ""
+}
+
 func (m *mockAthenaClient) StopQueryExecutionWithContext(ctx aws.Context, input *athena.StopQueryExecutionInput,
 	opt ...request.Option) (*athena.StopQueryExecutionOutput, error) {
-	if *input.QueryExecutionId == "SELECTQueryContext_CANCEL_OK_QID" {
+	m.stopQueryExecutionCalls[*input.QueryExecutionId]++
+	if *input.QueryExecutionId == "SELECTQueryContext_CANCEL_OK_QID" ||
+		*input.QueryExecutionId == "SELECTQueryContext_TIMEOUT_QID" {
 		return &athena.StopQueryExecutionOutput{}, nil
 	}
 	if *input.QueryExecutionId == "SELECTQueryContext_CANCEL_FAIL_QID" {
@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// namedPlaceholder is a :name or @name placeholder in a query.
+type namedPlaceholder struct {
+	name  string
+	start int
+	end   int
+}
+
+// findNamedPlaceholders is to find the :name and @name placeholders in query.
+// String literals, quoted identifiers and comments are skipped.
+func findNamedPlaceholders(query string) []namedPlaceholder {
+	var placeholders []namedPlaceholder
+	for _, t := range lexSQL(query) {
+		if t.kind != sqlCode {
+			continue
+		}
+		for i := t.start; i < t.end; i++ {
+			ch := query[i]
+			if (ch == ':' || ch == '@') && i+1 < t.end && isIdentifierStart(query[i+1]) &&
+				(i == t.start || !isIdentifierPart(query[i-1]) && query[i-1] != ':') {
+				j := i + 2
+				for j < t.end && isIdentifierPart(query[j]) {
+					j++
+				}
+				placeholders = append(placeholders, namedPlaceholder{
+					name:  query[i+1 : j],
+					start: i,
+					end:   j,
+				})
+				i = j - 1
+			}
+		}
+	}
+	return placeholders
+}
+
+func isIdentifierStart(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isIdentifierPart(ch byte) bool {
+	return isIdentifierStart(ch) || ch >= '0' && ch <= '9'
+}
+
+// hasNamedArgs is to check if any of namedArgs is passed with sql.Named.
+func hasNamedArgs(namedArgs []driver.NamedValue) bool {
+	for _, arg := range namedArgs {
+		if arg.Name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// bindNamedArgs is to turn the :name and @name placeholders of query into ? placeholders, and namedArgs
+// into positional arguments in the same order. A name can be used several times in query.
+// query and namedArgs are returned as is if no argument is passed with sql.Named.
+func bindNamedArgs(query string, namedArgs []driver.NamedValue) (string, []driver.NamedValue, error) {
+	if !hasNamedArgs(namedArgs) {
+		return query, namedArgs, nil
+	}
+	values := make(map[string]driver.NamedValue, len(namedArgs))
+	for _, arg := range namedArgs {
+		if arg.Name == "" {
+			return "", nil, ErrQueryMixedArgs
+		}
+		if _, ok := values[arg.Name]; ok {
+			return "", nil, fmt.Errorf("%w: %s", ErrQueryDuplicateNamedArg, arg.Name)
+		}
+		values[arg.Name] = arg
+	}
+	var b strings.Builder
+	used := make(map[string]bool, len(values))
+	args := make([]driver.NamedValue, 0, len(namedArgs))
+	last := 0
+	for _, p := range findNamedPlaceholders(query) {
+		arg, ok := values[p.name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s", ErrQueryMissingNamedArg, p.name)
+		}
+		used[p.name] = true
+		b.WriteString(query[last:p.start])
+		b.WriteByte('?')
+		last = p.end
+		args = append(args, driver.NamedValue{
+			Ordinal: len(args) + 1,
+			Value:   arg.Value,
+		})
+	}
+	for _, arg := range namedArgs {
+		if !used[arg.Name] {
+			return "", nil, fmt.Errorf("%w: %s", ErrQueryUnusedNamedArg, arg.Name)
+		}
+	}
+	b.WriteString(query[last:])
+	return b.String(), args, nil
+}
+
+// toPositionalPlaceholders is to turn the :name and @name placeholders of query into ? placeholders.
+func toPositionalPlaceholders(query string) string {
+	placeholders := findNamedPlaceholders(query)
+	if len(placeholders) == 0 {
+		return query
+	}
+	var b strings.Builder
+	last := 0
+	for _, p := range placeholders {
+		b.WriteString(query[last:p.start])
+		b.WriteByte('?')
+		last = p.end
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindNamedPlaceholders(t *testing.T) {
+	query := "SELECT * FROM t WHERE a = :a AND b = @b_2 AND c = ':c' AND d = \"@d\" -- :e\n" +
+		"AND f = /* @f */ :a AND g = x:y AND h = 'it''s :i'"
+	placeholders := findNamedPlaceholders(query)
+	assert.Len(t, placeholders, 3)
+	assert.Equal(t, "a", placeholders[0].name)
+	assert.Equal(t, ":a", query[placeholders[0].start:placeholders[0].end])
+	assert.Equal(t, "b_2", placeholders[1].name)
+	assert.Equal(t, "a", placeholders[2].name)
+
+	assert.Len(t, findNamedPlaceholders("SELECT ?, 1:2, a::b, :1"), 0)
+	assert.Len(t, findNamedPlaceholders("SELECT :a /* unterminated :b"), 1)
+}
+
+func TestBindNamedArgs(t *testing.T) {
+	query, args, err := bindNamedArgs("SELECT * FROM t WHERE a = :user_id OR b = @user_id AND c = :name", []driver.NamedValue{
+		{Name: "name", Ordinal: 1, Value: "x"},
+		{Name: "user_id", Ordinal: 2, Value: int64(42)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? OR b = ? AND c = ?", query)
+	assert.Equal(t, []driver.NamedValue{
+		{Ordinal: 1, Value: int64(42)},
+		{Ordinal: 2, Value: int64(42)},
+		{Ordinal: 3, Value: "x"},
+	}, args)
+
+	// positional arguments are not touched
+	positional := []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}
+	query, args, err = bindNamedArgs("SELECT ?", positional)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT ?", query)
+	assert.Equal(t, positional, args)
+
+	_, _, err = bindNamedArgs("SELECT :a, :b", []driver.NamedValue{{Name: "a", Ordinal: 1, Value: int64(1)}})
+	assert.True(t, errors.Is(err, ErrQueryMissingNamedArg))
+	assert.Contains(t, err.Error(), ": b")
+
+	_, _, err = bindNamedArgs("SELECT :a", []driver.NamedValue{
+		{Name: "a", Ordinal: 1, Value: int64(1)},
+		{Name: "b", Ordinal: 2, Value: int64(2)},
+	})
+	assert.True(t, errors.Is(err, ErrQueryUnusedNamedArg))
+	assert.Contains(t, err.Error(), ": b")
+
+	_, _, err = bindNamedArgs("SELECT :a, ?", []driver.NamedValue{
+		{Name: "a", Ordinal: 1, Value: int64(1)},
+		{Ordinal: 2, Value: int64(2)},
+	})
+	assert.Equal(t, ErrQueryMixedArgs, err)
+
+	_, _, err = bindNamedArgs("SELECT :a", []driver.NamedValue{
+		{Name: "a", Ordinal: 1, Value: int64(1)},
+		{Name: "a", Ordinal: 2, Value: int64(2)},
+	})
+	assert.True(t, errors.Is(err, ErrQueryDuplicateNamedArg))
+}
+
+func TestToPositionalPlaceholders(t *testing.T) {
+	assert.Equal(t, "SELECT ? WHERE a = ? AND b = ':c'", toPositionalPlaceholders("SELECT :a WHERE a = @b AND b = ':c'"))
+	assert.Equal(t, "SELECT ?", toPositionalPlaceholders("SELECT ?"))
+}
+
+func TestConnection_NamedArgs(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK = :status", []driver.NamedValue{
+		{Name: "status", Ordinal: 1, Value: "OK"},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, 1, m.startQueryExecutionCalls["SELECTQueryContext_OK = ?"])
+	assert.Equal(t, "OK", *m.executionParameters[0])
+
+	_, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK = :status", []driver.NamedValue{
+		{Name: "state", Ordinal: 1, Value: "OK"},
+	})
+	assert.True(t, errors.Is(err, ErrQueryMissingNamedArg))
+
+	_, err = c.ExecContext(context.Background(), "SELECTQueryContext_OK = :status", []driver.NamedValue{
+		{Name: "status", Ordinal: 1, Value: "OK"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, m.startQueryExecutionCalls["SELECTQueryContext_OK = 'OK'"])
+
+	_, err = c.ExecContext(context.Background(), "SELECTQueryContext_OK = :status", []driver.NamedValue{
+		{Name: "status", Ordinal: 1, Value: "OK"},
+		{Name: "state", Ordinal: 2, Value: "OK"},
+	})
+	assert.True(t, errors.Is(err, ErrQueryUnusedNamedArg))
+
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK = @status", []driver.NamedValue{
+		{Name: "status", Ordinal: 1, Value: "OK"},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, h)
+	assert.Equal(t, 2, m.startQueryExecutionCalls["SELECTQueryContext_OK = ?"])
+}
+
+func TestStatement_NamedArgs(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	stmt, err := c.PrepareContext(context.Background(), "SELECTQueryContext_OK = :status")
+	assert.Nil(t, err)
+	assert.Equal(t, -1, stmt.NumInput())
+	rows, err := stmt.(*Statement).QueryContext(context.Background(), []driver.NamedValue{
+		{Name: "status", Ordinal: 1, Value: "OK"},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+
+	c.connector.config.SetServerSidePrepare(true)
+	m := c.athenaAPI.(*mockAthenaClient)
+	stmt, err = c.PrepareContext(context.Background(), "SELECT * FROM t WHERE a = :a AND b = :b OR c = :a")
+	assert.Nil(t, err)
+	st := stmt.(*Statement)
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? AND b = ? OR c = ?", m.preparedStatements[st.name])
+	_, err = st.QueryContext(context.Background(), []driver.NamedValue{
+		{Name: "b", Ordinal: 1, Value: "y"},
+		{Name: "a", Ordinal: 2, Value: int64(1)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "y", "1"}, []string{*m.executionParameters[0], *m.executionParameters[1],
+		*m.executionParameters[2]})
+}
+
+func TestDB_NamedArgs(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	db := sql.OpenDB(&testConnector{conn: c})
+	defer db.Close()
+	rows, err := db.Query("SELECTQueryContext_OK = :status", sql.Named("status", "OK"))
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, 1, c.athenaAPI.(*mockAthenaClient).startQueryExecutionCalls["SELECTQueryContext_OK = ?"])
+}
+
+// testConnector is a driver.Connector returning the same connection.
+type testConnector struct {
+	conn *Connection
+}
+
+func (t *testConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return t.conn, nil
+}
+
+func (t *testConnector) Driver() driver.Driver {
+	return &SQLDriver{}
+}
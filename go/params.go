@@ -0,0 +1,367 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// nullTypes are the Athena types of the sql.Null* types, which can't be derived from their fields.
+var nullTypes = map[reflect.Type]string{
+	reflect.TypeOf(sql.NullBool{}):    "BOOLEAN",
+	reflect.TypeOf(sql.NullFloat64{}): "DOUBLE",
+	reflect.TypeOf(sql.NullInt32{}):   "INTEGER",
+	reflect.TypeOf(sql.NullInt64{}):   "BIGINT",
+	reflect.TypeOf(sql.NullString{}):  "VARCHAR",
+	reflect.TypeOf(sql.NullTime{}):    "TIMESTAMP",
+}
+
+// isCompositeValue is to check if v is a slice, array, map or struct, which is passed as an ARRAY, MAP or ROW.
+// Byte slices, time.Time and driver.Valuer are left to driver.DefaultParameterConverter.
+func isCompositeValue(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return false
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Slice:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array, reflect.Map:
+		return true
+	case reflect.Struct:
+		return rv.Type() != timeType
+	}
+	return false
+}
+
+// decimalValue is to get the Decimal of a Decimal, *Decimal or NullDecimal argument, or nil if it is NULL.
+func decimalValue(v interface{}) (driver.Value, bool) {
+	switch d := v.(type) {
+	case Decimal:
+		return d, true
+	case *Decimal:
+		if d == nil {
+			return nil, true
+		}
+		return *d, true
+	case NullDecimal:
+		if !d.Valid {
+			return nil, true
+		}
+		return d.Decimal, true
+	}
+	return nil, false
+}
+
+// isListValue is to check if v is a slice or array to be expanded in an IN list.
+func isListValue(v interface{}) bool {
+	if !isCompositeValue(v) {
+		return false
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return false
+	}
+	return rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+}
+
+// appendCompositeLiteral appends the Athena literal of a slice, array, map or struct:
+//
+//	[]int64{1, 2}                        ARRAY[1, 2]
+//	map[string]int64{"a": 1}             MAP(ARRAY['a'], ARRAY[1])
+//	struct{ID int64; Name string}{1,"a"} CAST(ROW(1, 'a') AS ROW("ID" BIGINT, "Name" VARCHAR))
+//
+// The elements are rendered like query arguments, so they can be of any supported type, including driver.Valuer.
+func appendCompositeLiteral(buf []byte, rv reflect.Value) ([]byte, error) {
+	if !rv.IsValid() {
+		return append(buf, "NULL"...), nil
+	}
+	if rv.Type().Implements(valuerType) {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return append(buf, "NULL"...), nil
+		}
+		if d, ok := decimalValue(rv.Interface()); ok {
+			return appendSQLLiteral(buf, d)
+		}
+		v, err := rv.Interface().(driver.Valuer).Value()
+		if err != nil {
+			return buf, err
+		}
+		return appendSQLLiteral(buf, v)
+	}
+	if rv.Type() == timeType {
+		return appendTimestamp(buf, rv.Interface().(time.Time)), nil
+	}
+	var err error
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return append(buf, "NULL"...), nil
+		}
+		return appendCompositeLiteral(buf, rv.Elem())
+	case reflect.Bool:
+		return appendSQLLiteral(buf, rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendSQLLiteral(buf, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return appendSQLLiteral(buf, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return appendSQLLiteral(buf, rv.Float())
+	case reflect.String:
+		return appendSQLLiteral(buf, rv.String())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return appendHexBytes(buf, b), nil
+		}
+		buf = append(buf, "ARRAY["...)
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			if buf, err = appendCompositeLiteral(buf, rv.Index(i)); err != nil {
+				return buf, err
+			}
+		}
+		return append(buf, ']'), nil
+	case reflect.Map:
+		// keys are sorted, so that the same map always gives the same query
+		keys := make([]string, 0, rv.Len())
+		values := make(map[string][]byte, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k, err := appendCompositeLiteral([]byte{}, iter.Key())
+			if err != nil {
+				return buf, err
+			}
+			v, err := appendCompositeLiteral([]byte{}, iter.Value())
+			if err != nil {
+				return buf, err
+			}
+			keys = append(keys, string(k))
+			values[string(k)] = v
+		}
+		sort.Strings(keys)
+		buf = append(buf, "MAP(ARRAY["...)
+		buf = append(buf, strings.Join(keys, ", ")...)
+		buf = append(buf, "], ARRAY["...)
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = append(buf, values[k]...)
+		}
+		return append(buf, "])"...), nil
+	case reflect.Struct:
+		rowType, err := athenaType(rv.Type())
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, "CAST(ROW("...)
+		n := 0
+		for i := 0; i < rv.NumField(); i++ {
+			if _, ok := rowFieldName(rv.Type().Field(i)); !ok {
+				continue
+			}
+			if n > 0 {
+				buf = append(buf, ", "...)
+			}
+			n++
+			if buf, err = appendCompositeLiteral(buf, rv.Field(i)); err != nil {
+				return buf, err
+			}
+		}
+		buf = append(buf, ") AS "...)
+		buf = append(buf, rowType...)
+		return append(buf, ')'), nil
+	}
+	return buf, ErrQueryUnknownType
+}
+
+// athenaType is to map a Go type to the Athena type of its literal, like ARRAY(BIGINT) for []int64.
+func athenaType(t reflect.Type) (string, error) {
+	return athenaTypeWith(t, nil)
+}
+
+// athenaTypeWith is athenaType with the types of driver.Valuer given by valuer.
+func athenaTypeWith(t reflect.Type, valuer func(reflect.Type) (string, bool)) (string, error) {
+	if athenaType, ok := nullTypes[t]; ok {
+		return athenaType, nil
+	}
+	if t == timeType {
+		return "TIMESTAMP", nil
+	}
+	if t.Implements(valuerType) {
+		if valuer != nil {
+			if athenaType, ok := valuer(t); ok {
+				return athenaType, nil
+			}
+		}
+		// the type of the value isn't known until Value is called
+		return "", ErrQueryUnknownType
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return athenaTypeWith(t.Elem(), valuer)
+	case reflect.Bool:
+		return "BOOLEAN", nil
+	case reflect.Int8:
+		return "TINYINT", nil
+	case reflect.Int16, reflect.Uint8:
+		return "SMALLINT", nil
+	case reflect.Int32, reflect.Uint16:
+		return "INTEGER", nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "BIGINT", nil
+	case reflect.Float32:
+		return "REAL", nil
+	case reflect.Float64:
+		return "DOUBLE", nil
+	case reflect.String:
+		return "VARCHAR", nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "VARBINARY", nil
+		}
+		elem, err := athenaTypeWith(t.Elem(), valuer)
+		if err != nil {
+			return "", err
+		}
+		return "ARRAY(" + elem + ")", nil
+	case reflect.Map:
+		key, err := athenaTypeWith(t.Key(), valuer)
+		if err != nil {
+			return "", err
+		}
+		elem, err := athenaTypeWith(t.Elem(), valuer)
+		if err != nil {
+			return "", err
+		}
+		return "MAP(" + key + ", " + elem + ")", nil
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := rowFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			fieldType, err := athenaTypeWith(t.Field(i).Type, valuer)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, `"`+strings.ReplaceAll(name, `"`, `""`)+`" `+fieldType)
+		}
+		if len(fields) == 0 {
+			return "", ErrQueryUnknownType
+		}
+		return "ROW(" + strings.Join(fields, ", ") + ")", nil
+	}
+	return "", ErrQueryUnknownType
+}
+
+// rowFieldName is to get the ROW field name of a struct field, which is the field name or the name in its
+// `athena:"name"` tag. Unexported fields and fields tagged with `athena:"-"` are skipped.
+func rowFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("athena")
+	if tag == "-" {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return f.Name, true
+}
+
+// expandInLists is to turn a slice or array bound to an `IN (?)` placeholder into a list of literals,
+// `IN (1, 2, 3)`, and drop it from args. An empty list becomes `IN (NULL)`, which matches no rows.
+// Other slices and arrays are left as they are and passed as an ARRAY.
+func expandInLists(query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	placeholders := placeholderPositions(query)
+	if len(placeholders) != len(args) {
+		// the argument count is checked later
+		return query, args, nil
+	}
+	var b strings.Builder
+	var newArgs []driver.NamedValue
+	last := 0
+	for i, p := range placeholders {
+		if !isListValue(args[i].Value) || !isInListPlaceholder(query, p) {
+			// renumber a copy, args belongs to the caller and may be passed again
+			arg := args[i]
+			arg.Ordinal = len(newArgs) + 1
+			newArgs = append(newArgs, arg)
+			continue
+		}
+		rv := reflect.Indirect(reflect.ValueOf(args[i].Value))
+		b.WriteString(query[last:p])
+		last = p + 1
+		if rv.Len() == 0 {
+			b.WriteString("NULL")
+			continue
+		}
+		for j := 0; j < rv.Len(); j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			v, err := appendCompositeLiteral([]byte{}, rv.Index(j))
+			if err != nil {
+				return "", nil, err
+			}
+			b.Write(v)
+		}
+	}
+	if last == 0 {
+		return query, args, nil
+	}
+	b.WriteString(query[last:])
+	return b.String(), newArgs, nil
+}
+
+// isInListPlaceholder is to check if the placeholder at p is the only item of an IN list, `IN (?)`.
+func isInListPlaceholder(query string, p int) bool {
+	before := strings.TrimRight(query[:p], " \t\r\n")
+	after := strings.TrimLeft(query[p+1:], " \t\r\n")
+	if !strings.HasSuffix(before, "(") || !strings.HasPrefix(after, ")") {
+		return false
+	}
+	before = strings.TrimRight(before[:len(before)-1], " \t\r\n")
+	if len(before) < 2 || !strings.EqualFold(before[len(before)-2:], "in") {
+		return false
+	}
+	return len(before) == 2 || !isIdentifierPart(before[len(before)-3])
+}
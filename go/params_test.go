@@ -0,0 +1,204 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+type testID int64
+
+type testItem struct {
+	ID     testID
+	Name   string `athena:"name"`
+	Tags   []string
+	Hidden string `athena:"-"`
+	note   string
+}
+
+type testValuer struct {
+	v string
+}
+
+func (v testValuer) Value() (driver.Value, error) {
+	if v.v == "" {
+		return nil, errors.New("no value")
+	}
+	return v.v, nil
+}
+
+func TestIsCompositeValue(t *testing.T) {
+	for _, v := range []interface{}{[]string{}, []testID{1}, [2]int{}, &[]int{1}, map[string]int{}, testItem{}} {
+		assert.True(t, isCompositeValue(v), "%T", v)
+	}
+	for _, v := range []interface{}{nil, 1, "a", []byte("a"), time.Now(), testValuer{"a"}, sql.NullString{}} {
+		assert.False(t, isCompositeValue(v), "%T", v)
+	}
+	assert.True(t, isListValue([]string{}))
+	assert.False(t, isListValue([16]byte{}))
+	assert.False(t, isListValue(map[string]int{}))
+}
+
+func TestAppendSQLLiteral_Composite(t *testing.T) {
+	testTime, err := time.Parse(time.RFC3339, "2024-07-01T01:02:03Z")
+	assert.Nil(t, err)
+	s := "x"
+	testCases := []struct {
+		arg      driver.Value
+		expected string
+	}{
+		{[]int64{1, -2}, "ARRAY[1, -2]"},
+		{[]testID{}, "ARRAY[]"},
+		{[]string{"a", "it's"}, "ARRAY['a', 'it''s']"},
+		{[]*string{&s, nil}, "ARRAY['x', NULL]"},
+		{[]interface{}{1, "a", true, nil}, "ARRAY[1, 'a', true, NULL]"},
+		{[][]byte{{0x01}}, "ARRAY[X'01']"},
+		{[2]byte{0x0a, 0x0b}, "X'0A0B'"},
+		{[]time.Time{testTime}, "ARRAY[TIMESTAMP '2024-07-01 01:02:03.000']"},
+		{[][]float64{{0.5}, {}}, "ARRAY[ARRAY[0.5], ARRAY[]]"},
+		{[]driver.Valuer{testValuer{"v"}, sql.NullInt64{}}, "ARRAY['v', NULL]"},
+		{map[string]int{"b": 2, "a": 1}, "MAP(ARRAY['a', 'b'], ARRAY[1, 2])"},
+		{map[int][]string{1: {"a"}}, "MAP(ARRAY[1], ARRAY[ARRAY['a']])"},
+		{map[string]int{}, "MAP(ARRAY[], ARRAY[])"},
+		{testItem{ID: 1, Name: "a", Tags: []string{"t"}, Hidden: "h", note: "n"},
+			`CAST(ROW(1, 'a', ARRAY['t']) AS ROW("ID" BIGINT, "name" VARCHAR, "Tags" ARRAY(VARCHAR)))`},
+		{&struct {
+			At    time.Time
+			Count sql.NullInt32
+			Ratio float32
+			Attrs map[string]int8
+		}{At: testTime, Attrs: map[string]int8{}},
+			`CAST(ROW(TIMESTAMP '2024-07-01 01:02:03.000', NULL, 0, MAP(ARRAY[], ARRAY[])) AS ROW("At" TIMESTAMP, ` +
+				`"Count" INTEGER, "Ratio" REAL, "Attrs" MAP(VARCHAR, TINYINT)))`},
+	}
+	for _, tc := range testCases {
+		r, err := appendSQLLiteral([]byte{}, tc.arg)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, string(r))
+	}
+
+	for _, arg := range []driver.Value{
+		[]chan int{make(chan int)},
+		[]testValuer{{}},
+		struct{ V interface{} }{},
+		struct{ V testValuer }{},
+		struct{ v int }{},
+	} {
+		_, err = appendSQLLiteral([]byte{}, arg)
+		assert.NotNil(t, err, "%T", arg)
+	}
+}
+
+func TestExpandInLists(t *testing.T) {
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: []int64{1, 2}},
+		{Ordinal: 2, Value: "x"},
+		{Ordinal: 3, Value: []string{}},
+		{Ordinal: 4, Value: []string{"a"}},
+		{Ordinal: 5, Value: []string{"b"}},
+	}
+	q, newArgs, err := expandInLists("SELECT * FROM t WHERE a IN ( ? ) AND b = ? AND c NOT in(?) AND "+
+		"contains(?, d) AND e IN (?, 'f')", args)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a IN ( 1, 2 ) AND b = ? AND c NOT in(NULL) AND contains(?, d) AND "+
+		"e IN (?, 'f')", q)
+	assert.Equal(t, []driver.NamedValue{
+		{Ordinal: 1, Value: "x"},
+		{Ordinal: 2, Value: []string{"a"}},
+		{Ordinal: 3, Value: []string{"b"}},
+	}, newArgs)
+
+	// args is left as is, so the same slice can be passed again with another query
+	assert.Equal(t, 2, args[1].Ordinal)
+	q, newArgs, err = expandInLists("SELECT * FROM t WHERE a = ? AND b = ? AND c = ? AND d = ? AND e IN (?)", args)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? AND b = ? AND c = ? AND d = ? AND e IN ('b')", q)
+	assert.Equal(t, args[:4], newArgs)
+
+	// join(?) isn't an IN list, and a ? in a string literal isn't a placeholder
+	q, newArgs, err = expandInLists("SELECT join(?), 'IN (?)'", []driver.NamedValue{{Ordinal: 1, Value: []int{1}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT join(?), 'IN (?)'", q)
+	assert.Len(t, newArgs, 1)
+
+	_, _, err = expandInLists("a IN (?)", []driver.NamedValue{{Ordinal: 1, Value: []testValuer{{}}}})
+	assert.NotNil(t, err)
+}
+
+func TestConnection_QueryContext_ReuseInListArgs(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: []string{"a", "b'c"}},
+		{Ordinal: 2, Value: "x"},
+	}
+	for i := 0; i < 2; i++ {
+		rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK IN (?) AND x = ?", args)
+		assert.Nil(t, err)
+		assert.Nil(t, rows.Close())
+		assert.Equal(t, []*string{aws.String("x")}, m.executionParameters)
+	}
+	assert.Equal(t, []driver.NamedValue{
+		{Ordinal: 1, Value: []string{"a", "b'c"}},
+		{Ordinal: 2, Value: "x"},
+	}, args)
+}
+
+func TestConnection_CheckNamedValue_Composite(t *testing.T) {
+	c := createTestConnection(t)
+	ids := []int64{1, 2}
+	nv := driver.NamedValue{Value: ids}
+	assert.Nil(t, c.CheckNamedValue(&nv))
+	assert.Equal(t, ids, nv.Value)
+
+	nv = driver.NamedValue{Value: testValuer{"v"}}
+	assert.Nil(t, c.CheckNamedValue(&nv))
+	assert.Equal(t, "v", nv.Value)
+
+	nv = driver.NamedValue{Value: make(chan int)}
+	assert.NotNil(t, c.CheckNamedValue(&nv))
+}
+
+func TestDB_CompositeArgs(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	db := sql.OpenDB(&testConnector{conn: c})
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	rows, err := db.Query("SELECTQueryContext_OK IN (?) AND x = ?", []string{"a", "b'c"}, map[string]int64{"k": 1})
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, []*string{aws.String("MAP(ARRAY['k'], ARRAY[1])")}, m.executionParameters)
+
+	rows, err = db.QueryContext(context.Background(), "SELECTQueryContext_OK = ?", []testID{3})
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, []*string{aws.String("ARRAY[3]")}, m.executionParameters)
+}
@@ -0,0 +1,1095 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// This file is a minimal reader of the Parquet files written by UNLOAD. It reads the encodings and compression
+// Athena uses, which is far from all of Parquet. ARRAY, MAP and ROW columns are nested groups, whose values are
+// assembled from the repetition and definition levels of their columns.
+// https://github.com/apache/parquet-format
+// https://github.com/apache/parquet-format/blob/master/LogicalTypes.md#nested-types
+
+// Parquet physical types.
+const (
+	parquetBoolean           = 0
+	parquetInt32             = 1
+	parquetInt64             = 2
+	parquetInt96             = 3
+	parquetFloat             = 4
+	parquetDouble            = 5
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+)
+
+// Parquet converted types, which are the logical types of the older writers.
+const (
+	parquetNone            = -1
+	parquetUTF8            = 0
+	parquetMap             = 1
+	parquetMapKeyValue     = 2
+	parquetList            = 3
+	parquetEnum            = 4
+	parquetDecimal         = 5
+	parquetDate            = 6
+	parquetTimestampMillis = 9
+	parquetTimestampMicros = 10
+	parquetInt8            = 15
+	parquetInt16           = 16
+	parquetJSON            = 19
+	// parquetTimestampNanos has no converted type, only a logical type.
+	parquetTimestampNanos = 100
+)
+
+// Parquet repetition types, page types, encodings and compression codecs.
+const (
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	parquetDataPage       = 0
+	parquetDictionaryPage = 2
+	parquetDataPageV2     = 3
+
+	parquetPlain           = 0
+	parquetPlainDictionary = 2
+	parquetRLE             = 3
+	parquetRLEDictionary   = 8
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+)
+
+// julianDayOfUnixEpoch is the Julian day of 1970-01-01, which INT96 timestamps count days from.
+const julianDayOfUnixEpoch = 2440588
+
+// thriftStruct is a struct decoded by thriftReader, from the field IDs to the values.
+type thriftStruct map[int16]interface{}
+
+func (s thriftStruct) int(id int16, def int64) int64 {
+	if v, ok := s[id].(int64); ok {
+		return v
+	}
+	return def
+}
+
+func (s thriftStruct) boolean(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (s thriftStruct) str(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s thriftStruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+func (s thriftStruct) strct(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+// thriftReader decodes the Thrift compact protocol, which Parquet uses for its metadata.
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (t *thriftReader) byte() (byte, error) {
+	if t.pos >= len(t.buf) {
+		return 0, fmt.Errorf("%w: metadata is truncated", ErrParquet)
+	}
+	b := t.buf[t.pos]
+	t.pos++
+	return b, nil
+}
+
+func (t *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(t.buf[t.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: metadata is truncated", ErrParquet)
+	}
+	t.pos += n
+	return v, nil
+}
+
+func (t *thriftReader) varint() (int64, error) {
+	v, err := t.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// readStruct decodes a struct, skipping the values of unknown types.
+func (t *thriftReader) readStruct() (thriftStruct, error) {
+	s := thriftStruct{}
+	var id int16
+	for {
+		b, err := t.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return s, nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := t.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		switch typ := b & 0x0f; typ {
+		case 1, 2:
+			s[id] = typ == 1
+		default:
+			if s[id], err = t.readValue(typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (t *thriftReader) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case 1, 2:
+		// a bool out of a struct field, i.e. an element of a list
+		b, err := t.byte()
+		return b == 1, err
+	case 3:
+		b, err := t.byte()
+		return int64(int8(b)), err
+	case 4, 5, 6:
+		return t.varint()
+	case 7:
+		if t.pos+8 > len(t.buf) {
+			return nil, fmt.Errorf("%w: metadata is truncated", ErrParquet)
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(t.buf[t.pos:]))
+		t.pos += 8
+		return v, nil
+	case 8:
+		n, err := t.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(t.buf)-t.pos) < n {
+			return nil, fmt.Errorf("%w: metadata is truncated", ErrParquet)
+		}
+		v := t.buf[t.pos : t.pos+int(n)]
+		t.pos += int(n)
+		return v, nil
+	case 9, 10:
+		b, err := t.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(b >> 4)
+		if size == 15 {
+			if size, err = t.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if size > uint64(len(t.buf)-t.pos) {
+			return nil, fmt.Errorf("%w: metadata is truncated", ErrParquet)
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			if list[i], err = t.readValue(b & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case 11:
+		size, err := t.uvarint()
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		kv, err := t.byte()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < size; i++ {
+			if _, err = t.readValue(kv >> 4); err != nil {
+				return nil, err
+			}
+			if _, err = t.readValue(kv & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case 12:
+		return t.readStruct()
+	default:
+		return nil, fmt.Errorf("%w: unknown Thrift type %d", ErrParquet, typ)
+	}
+}
+
+// parquetColumn is a column of a Parquet schema, which is a field that isn't a group.
+type parquetColumn struct {
+	name          string
+	physicalType  int64
+	typeLength    int64
+	convertedType int64
+	scale         int64
+	precision     int64
+	optional      bool
+	// maxDef and maxRep are the definition and repetition levels of a value of the column. A column which isn't
+	// nested has a maxRep of 0, and a maxDef of 1 if it is optional.
+	maxDef int
+	maxRep int
+}
+
+// parquetField is a field of a Parquet schema, which is a group of fields or a column.
+type parquetField struct {
+	name          string
+	repetition    int64
+	convertedType int64
+	fields        []*parquetField
+	// index is the index of the field in its group, and column the index of its column, or -1 for a group.
+	index  int
+	column int
+	// defLevel and repLevel are the definition and repetition levels of the field.
+	defLevel int
+	repLevel int
+}
+
+// parquetColumnChunk is where the values of a column in a row group are, and how they are compressed.
+type parquetColumnChunk struct {
+	codec     int64
+	numValues int64
+	offset    int64
+	size      int64
+}
+
+// parquetRowGroup is a row group of a Parquet file.
+type parquetRowGroup struct {
+	numRows int64
+	chunks  []parquetColumnChunk
+}
+
+// parquetFile is the metadata of a Parquet file. The fields are the top level fields of its schema, which are the
+// columns of the result, and the columns are where the values of the fields are, in the order of the column chunks.
+type parquetFile struct {
+	fields    []*parquetField
+	columns   []parquetColumn
+	rowGroups []parquetRowGroup
+}
+
+// readParquetFile is to read the metadata from the footer of a Parquet file.
+func readParquetFile(ctx context.Context, reader S3Reader, bucket string, key string) (*parquetFile, error) {
+	size, err := reader.Size(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if size < 12 {
+		return nil, fmt.Errorf("%w: s3://%s/%s is too small", ErrParquet, bucket, key)
+	}
+	tail, err := reader.ReadRange(ctx, bucket, key, size-8, 8)
+	if err != nil {
+		return nil, err
+	}
+	if len(tail) != 8 || string(tail[4:]) != "PAR1" {
+		return nil, fmt.Errorf("%w: s3://%s/%s is not a Parquet file", ErrParquet, bucket, key)
+	}
+	footerSize := int64(binary.LittleEndian.Uint32(tail))
+	if footerSize > size-12 {
+		return nil, fmt.Errorf("%w: s3://%s/%s has a bad footer", ErrParquet, bucket, key)
+	}
+	footer, err := reader.ReadRange(ctx, bucket, key, size-8-footerSize, footerSize)
+	if err != nil {
+		return nil, err
+	}
+	return parseParquetFooter(footer)
+}
+
+// parseParquetFooter is to decode the FileMetaData in the footer of a Parquet file.
+func parseParquetFooter(footer []byte) (*parquetFile, error) {
+	t := &thriftReader{buf: footer}
+	metadata, err := t.readStruct()
+	if err != nil {
+		return nil, err
+	}
+	schema := metadata.list(2)
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("%w: schema is missing", ErrParquet)
+	}
+	f := &parquetFile{}
+	root, _ := schema[0].(thriftStruct)
+	next := 0
+	if f.fields, next, err = f.parseFields(schema, 1, root.int(5, 0), &parquetField{}); err != nil {
+		return nil, err
+	}
+	if next != len(schema) {
+		return nil, fmt.Errorf("%w: %d schema elements out of the schema", ErrParquet, len(schema)-next)
+	}
+	for _, g := range metadata.list(4) {
+		group, _ := g.(thriftStruct)
+		rowGroup := parquetRowGroup{numRows: group.int(3, 0)}
+		for _, c := range group.list(1) {
+			chunk, _ := c.(thriftStruct)
+			meta := chunk.strct(3)
+			if meta == nil || chunk.str(1) != "" {
+				return nil, fmt.Errorf("%w: column chunks in other files", ErrParquetUnsupported)
+			}
+			offset := meta.int(9, 0)
+			if dictionaryOffset := meta.int(11, 0); dictionaryOffset > 0 && dictionaryOffset < offset {
+				offset = dictionaryOffset
+			}
+			rowGroup.chunks = append(rowGroup.chunks, parquetColumnChunk{
+				codec:     meta.int(4, parquetUncompressed),
+				numValues: meta.int(5, 0),
+				offset:    offset,
+				size:      meta.int(7, 0),
+			})
+		}
+		if len(rowGroup.chunks) != len(f.columns) {
+			return nil, fmt.Errorf("%w: %d column chunks in a row group of %d columns", ErrParquet,
+				len(rowGroup.chunks), len(f.columns))
+		}
+		f.rowGroups = append(f.rowGroups, rowGroup)
+	}
+	return f, nil
+}
+
+// parseFields is to parse the n fields of group, which start at the i-th element of the schema. Every field is
+// followed by its own fields if it is a group. It returns the index of the element after the fields.
+func (f *parquetFile) parseFields(schema []interface{}, i int, n int64, group *parquetField) ([]*parquetField, int,
+	error) {
+	var fields []*parquetField
+	for ; n > 0; n-- {
+		if i >= len(schema) {
+			return nil, 0, fmt.Errorf("%w: fields of %s are missing", ErrParquet, group.name)
+		}
+		element, _ := schema[i].(thriftStruct)
+		i++
+		field := &parquetField{
+			name:          element.str(4),
+			repetition:    element.int(3, parquetRequired),
+			convertedType: element.int(6, parquetNone),
+			index:         len(fields),
+			column:        -1,
+			defLevel:      group.defLevel,
+			repLevel:      group.repLevel,
+		}
+		if field.repetition != parquetRequired {
+			field.defLevel++
+		}
+		if field.repetition == parquetRepeated {
+			field.repLevel++
+		}
+		if children := element.int(5, 0); children > 0 {
+			if field.convertedType == parquetNone {
+				if logical := element.strct(10); logical.strct(2) != nil {
+					field.convertedType = parquetMap
+				} else if logical.strct(3) != nil {
+					field.convertedType = parquetList
+				}
+			}
+			var err error
+			if field.fields, i, err = f.parseFields(schema, i, children, field); err != nil {
+				return nil, 0, err
+			}
+		} else {
+			column := parquetColumn{
+				name:          field.name,
+				physicalType:  element.int(1, -1),
+				typeLength:    element.int(2, 0),
+				convertedType: field.convertedType,
+				scale:         element.int(7, 0),
+				precision:     element.int(8, 0),
+				optional:      field.repetition == parquetOptional,
+				maxDef:        field.defLevel,
+				maxRep:        field.repLevel,
+			}
+			if column.physicalType < 0 {
+				return nil, 0, fmt.Errorf("%w: column %s has no type", ErrParquet, column.name)
+			}
+			if column.convertedType == parquetNone {
+				column.fromLogicalType(element.strct(10))
+			}
+			field.column = len(f.columns)
+			f.columns = append(f.columns, column)
+		}
+		fields = append(fields, field)
+	}
+	return fields, i, nil
+}
+
+// fromLogicalType is to set the converted type of a column written with a logical type only.
+func (p *parquetColumn) fromLogicalType(logical thriftStruct) {
+	switch {
+	case logical.strct(1) != nil:
+		p.convertedType = parquetUTF8
+	case logical.strct(4) != nil:
+		p.convertedType = parquetEnum
+	case logical.strct(5) != nil:
+		p.convertedType = parquetDecimal
+		p.scale = logical.strct(5).int(1, 0)
+		p.precision = logical.strct(5).int(2, 0)
+	case logical.strct(6) != nil:
+		p.convertedType = parquetDate
+	case logical.strct(8) != nil:
+		switch unit := logical.strct(8).strct(2); {
+		case unit.strct(1) != nil:
+			p.convertedType = parquetTimestampMillis
+		case unit.strct(2) != nil:
+			p.convertedType = parquetTimestampMicros
+		case unit.strct(3) != nil:
+			p.convertedType = parquetTimestampNanos
+		}
+	case logical.strct(10) != nil:
+		switch logical.strct(10).int(1, 0) {
+		case 8:
+			p.convertedType = parquetInt8
+		case 16:
+			p.convertedType = parquetInt16
+		}
+	case logical.strct(12) != nil:
+		p.convertedType = parquetJSON
+	}
+}
+
+// athenaType returns the Athena type of the values of the column.
+func (p *parquetColumn) athenaType() string {
+	if p.convertedType == parquetDecimal {
+		return "decimal"
+	}
+	switch p.physicalType {
+	case parquetBoolean:
+		return "boolean"
+	case parquetInt32:
+		switch p.convertedType {
+		case parquetInt8:
+			return "tinyint"
+		case parquetInt16:
+			return "smallint"
+		case parquetDate:
+			return "date"
+		}
+		return "integer"
+	case parquetInt64:
+		switch p.convertedType {
+		case parquetTimestampMillis, parquetTimestampMicros, parquetTimestampNanos:
+			return "timestamp"
+		}
+		return "bigint"
+	case parquetInt96:
+		return "timestamp"
+	case parquetFloat:
+		return "real"
+	case parquetDouble:
+		return "double"
+	}
+	switch p.convertedType {
+	case parquetUTF8, parquetEnum:
+		return "varchar"
+	case parquetJSON:
+		return "json"
+	}
+	return "varbinary"
+}
+
+// columnInfo returns the ColumnInfo of the column, like the one returned by GetQueryResults.
+func (p *parquetColumn) columnInfo() *athena.ColumnInfo {
+	info := newColumnInfo(p.name, p.athenaType())
+	switch *info.Type {
+	case "decimal":
+		info.Precision = &p.precision
+		info.Scale = &p.scale
+	case "varchar", "varbinary", "json":
+		// the length isn't kept in the files, so it is unbounded like varchar without a length.
+		info.Precision = aws.Int64(math.MaxInt32)
+	}
+	if p.optional {
+		info.Nullable = aws.String(athena.ColumnNullableNullable)
+	} else {
+		info.Nullable = aws.String(athena.ColumnNullableNotNull)
+	}
+	return info
+}
+
+// value converts a plain encoded value of the column to the Go type of its Athena type, the same as
+// Rows.athenaTypeToGoType does. Decimal values are always Decimal, and turned into strings by Rows if needed.
+func (p *parquetColumn) value(data []byte) interface{} {
+	switch p.physicalType {
+	case parquetInt32:
+		v := int32(binary.LittleEndian.Uint32(data))
+		switch p.convertedType {
+		case parquetInt8:
+			return int8(v)
+		case parquetInt16:
+			return int16(v)
+		case parquetDate:
+			return time.Unix(int64(v)*24*60*60, 0).UTC()
+		case parquetDecimal:
+			return NewDecimal(big.NewInt(int64(v)), p.scale).withColumn(p.precision, p.scale)
+		}
+		return v
+	case parquetInt64:
+		v := int64(binary.LittleEndian.Uint64(data))
+		switch p.convertedType {
+		case parquetTimestampMillis:
+			return time.Unix(0, v*int64(time.Millisecond)).UTC()
+		case parquetTimestampMicros:
+			return time.Unix(0, v*int64(time.Microsecond)).UTC()
+		case parquetTimestampNanos:
+			return time.Unix(0, v).UTC()
+		case parquetDecimal:
+			return NewDecimal(big.NewInt(v), p.scale).withColumn(p.precision, p.scale)
+		}
+		return v
+	case parquetInt96:
+		nanos := int64(binary.LittleEndian.Uint64(data))
+		days := int64(binary.LittleEndian.Uint32(data[8:])) - julianDayOfUnixEpoch
+		return time.Unix(days*24*60*60, nanos).UTC()
+	case parquetFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(data))
+	case parquetDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data))
+	}
+	switch p.convertedType {
+	case parquetUTF8, parquetEnum, parquetJSON:
+		return string(data)
+	case parquetDecimal:
+		unscaled := new(big.Int).SetBytes(data)
+		if len(data) > 0 && data[0]&0x80 != 0 {
+			// two's complement
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
+		}
+		return NewDecimal(unscaled, p.scale).withColumn(p.precision, p.scale)
+	}
+	return append([]byte{}, data...)
+}
+
+// formatDecimal renders an unscaled decimal value the way Athena does, e.g. 12.30 for 1230 of scale 2.
+func formatDecimal(unscaled *big.Int, scale int64) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if int64(len(digits)) <= scale {
+			digits = strings.Repeat("0", int(scale)-len(digits)+1) + digits
+		}
+		digits = digits[:int64(len(digits))-scale] + "." + digits[int64(len(digits))-scale:]
+	}
+	if unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// decodePlain decodes n plain encoded values of the column.
+func (p *parquetColumn) decodePlain(data []byte, n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	if p.physicalType == parquetBoolean {
+		if len(data) < (n+7)/8 {
+			return nil, fmt.Errorf("%w: column %s has too few values", ErrParquet, p.name)
+		}
+		for i := range values {
+			values[i] = data[i/8]>>(i%8)&1 == 1
+		}
+		return values, nil
+	}
+	size := map[int64]int{
+		parquetInt32:             4,
+		parquetInt64:             8,
+		parquetInt96:             12,
+		parquetFloat:             4,
+		parquetDouble:            8,
+		parquetFixedLenByteArray: int(p.typeLength),
+	}[p.physicalType]
+	pos := 0
+	for i := range values {
+		length := size
+		if p.physicalType == parquetByteArray {
+			if pos+4 > len(data) {
+				return nil, fmt.Errorf("%w: column %s has too few values", ErrParquet, p.name)
+			}
+			length = int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+		if length < 0 || pos+length > len(data) {
+			return nil, fmt.Errorf("%w: column %s has too few values", ErrParquet, p.name)
+		}
+		values[i] = p.value(data[pos : pos+length])
+		pos += length
+	}
+	return values, nil
+}
+
+// decodeRLEHybrid decodes n values of bitWidth bits encoded with the RLE/bit-packing hybrid encoding, which
+// is used by the definition levels and the dictionary indices.
+func decodeRLEHybrid(data []byte, bitWidth int, n int) ([]uint32, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("%w: bit width %d", ErrParquet, bitWidth)
+	}
+	values := make([]uint32, 0, n)
+	byteWidth := (bitWidth + 7) / 8
+	pos := 0
+	for len(values) < n {
+		header, k := binary.Uvarint(data[pos:])
+		if k <= 0 || header>>1 == 0 {
+			return nil, fmt.Errorf("%w: RLE data is truncated", ErrParquet)
+		}
+		pos += k
+		if header&1 == 0 {
+			if pos+byteWidth > len(data) {
+				return nil, fmt.Errorf("%w: RLE data is truncated", ErrParquet)
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(data[pos+i]) << (8 * i)
+			}
+			pos += byteWidth
+			for i := uint64(0); i < header>>1 && len(values) < n; i++ {
+				values = append(values, v)
+			}
+			continue
+		}
+		count := int(header>>1) * 8
+		for i := 0; i < count && len(values) < n; i++ {
+			var v uint32
+			for b := 0; b < bitWidth; b++ {
+				bit := i*bitWidth + b
+				if pos+bit/8 >= len(data) {
+					return nil, fmt.Errorf("%w: bit-packed data is truncated", ErrParquet)
+				}
+				v |= uint32(data[pos+bit/8]>>(bit%8)&1) << b
+			}
+			values = append(values, v)
+		}
+		pos += int(header>>1) * bitWidth
+	}
+	return values, nil
+}
+
+// decompress is to decompress a page.
+func decompress(codec int64, data []byte, size int64) ([]byte, error) {
+	switch codec {
+	case parquetUncompressed:
+		return data, nil
+	case parquetGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		buf := bytes.NewBuffer(make([]byte, 0, size))
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%w: compression codec %d", ErrParquetUnsupported, codec)
+	}
+}
+
+// parquetColumnValues are the values of a column chunk, where a value which isn't defined is nil. The repetition
+// and definition levels of the values are kept if the column has them.
+type parquetColumnValues struct {
+	values      []interface{}
+	repetitions []uint32
+	definitions []uint32
+}
+
+// levels returns the repetition and definition levels of the i-th value.
+func (c *parquetColumnValues) levels(i int, column *parquetColumn) (int, int) {
+	r, d := 0, column.maxDef
+	if c.repetitions != nil {
+		r = int(c.repetitions[i])
+	}
+	if c.definitions != nil {
+		d = int(c.definitions[i])
+	}
+	return r, d
+}
+
+// splitLevels is to split the levels of a data page, which are prefixed with their length, from the rest of it.
+func (p *parquetColumn) splitLevels(page []byte) ([]byte, []byte, error) {
+	if len(page) < 4 {
+		return nil, nil, fmt.Errorf("%w: page of column %s is truncated", ErrParquet, p.name)
+	}
+	length := int(binary.LittleEndian.Uint32(page))
+	if length < 0 || 4+length > len(page) {
+		return nil, nil, fmt.Errorf("%w: page of column %s is truncated", ErrParquet, p.name)
+	}
+	return page[4 : 4+length], page[4+length:], nil
+}
+
+// decodeColumnChunk decodes the values of a column chunk.
+func (p *parquetColumn) decodeColumnChunk(data []byte, chunk parquetColumnChunk) (*parquetColumnValues, error) {
+	c := &parquetColumnValues{values: make([]interface{}, 0, chunk.numValues)}
+	if p.maxRep > 0 {
+		c.repetitions = make([]uint32, 0, chunk.numValues)
+	}
+	if p.maxDef > 0 {
+		c.definitions = make([]uint32, 0, chunk.numValues)
+	}
+	var dictionary []interface{}
+	t := &thriftReader{buf: data}
+	for int64(len(c.values)) < chunk.numValues {
+		header, err := t.readStruct()
+		if err != nil {
+			return nil, err
+		}
+		size := header.int(3, 0)
+		if size < 0 || int64(len(data)-t.pos) < size {
+			return nil, fmt.Errorf("%w: page of column %s is truncated", ErrParquet, p.name)
+		}
+		page := data[t.pos : int64(t.pos)+size]
+		t.pos += int(size)
+		uncompressedSize := header.int(2, 0)
+
+		var n int64
+		var encoding int64
+		var repetitionLevels, definitionLevels []byte
+		switch header.int(1, -1) {
+		case parquetDictionaryPage:
+			if page, err = decompress(chunk.codec, page, uncompressedSize); err != nil {
+				return nil, err
+			}
+			if dictionary, err = p.decodePlain(page, int(header.strct(7).int(1, 0))); err != nil {
+				return nil, err
+			}
+			continue
+		case parquetDataPage:
+			if page, err = decompress(chunk.codec, page, uncompressedSize); err != nil {
+				return nil, err
+			}
+			h := header.strct(5)
+			n, encoding = h.int(1, 0), h.int(2, 0)
+			if p.maxRep > 0 {
+				if h.int(4, parquetRLE) != parquetRLE {
+					return nil, fmt.Errorf("%w: repetition levels of column %s", ErrParquetUnsupported, p.name)
+				}
+				if repetitionLevels, page, err = p.splitLevels(page); err != nil {
+					return nil, err
+				}
+			}
+			if p.maxDef > 0 {
+				if h.int(3, parquetRLE) != parquetRLE {
+					return nil, fmt.Errorf("%w: definition levels of column %s", ErrParquetUnsupported, p.name)
+				}
+				if definitionLevels, page, err = p.splitLevels(page); err != nil {
+					return nil, err
+				}
+			}
+		case parquetDataPageV2:
+			h := header.strct(8)
+			n, encoding = h.int(1, 0), h.int(4, 0)
+			repetitionLength, definitionLength := h.int(6, 0), h.int(5, 0)
+			if repetitionLength < 0 || definitionLength < 0 ||
+				repetitionLength+definitionLength > int64(len(page)) {
+				return nil, fmt.Errorf("%w: page of column %s is truncated", ErrParquet, p.name)
+			}
+			repetitionLevels = page[:repetitionLength]
+			definitionLevels = page[repetitionLength : repetitionLength+definitionLength]
+			page = page[repetitionLength+definitionLength:]
+			if h.boolean(7, true) {
+				page, err = decompress(chunk.codec, page, uncompressedSize-repetitionLength-definitionLength)
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			continue
+		}
+
+		var repetitions, definitions []uint32
+		if p.maxRep > 0 {
+			if repetitions, err = decodeRLEHybrid(repetitionLevels, bits.Len(uint(p.maxRep)), int(n)); err != nil {
+				return nil, err
+			}
+		}
+		nonNull := int(n)
+		if p.maxDef > 0 {
+			if definitions, err = decodeRLEHybrid(definitionLevels, bits.Len(uint(p.maxDef)), int(n)); err != nil {
+				return nil, err
+			}
+			nonNull = 0
+			for _, d := range definitions {
+				if int(d) == p.maxDef {
+					nonNull++
+				}
+			}
+		}
+		var pageValues []interface{}
+		switch encoding {
+		case parquetPlain:
+			pageValues, err = p.decodePlain(page, nonNull)
+		case parquetPlainDictionary, parquetRLEDictionary:
+			if len(page) == 0 {
+				return nil, fmt.Errorf("%w: page of column %s is truncated", ErrParquet, p.name)
+			}
+			var indices []uint32
+			if indices, err = decodeRLEHybrid(page[1:], int(page[0]), nonNull); err != nil {
+				return nil, err
+			}
+			pageValues = make([]interface{}, nonNull)
+			for i, index := range indices {
+				if int(index) >= len(dictionary) {
+					return nil, fmt.Errorf("%w: dictionary index %d of column %s is out of range", ErrParquet,
+						index, p.name)
+				}
+				pageValues[i] = dictionary[index]
+			}
+		default:
+			err = fmt.Errorf("%w: encoding %d of column %s", ErrParquetUnsupported, encoding, p.name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.repetitions = append(c.repetitions, repetitions...)
+		c.definitions = append(c.definitions, definitions...)
+		if p.maxDef == 0 {
+			c.values = append(c.values, pageValues...)
+			continue
+		}
+		for _, d := range definitions {
+			if int(d) != p.maxDef {
+				c.values = append(c.values, nil)
+				continue
+			}
+			c.values = append(c.values, pageValues[0])
+			pageValues = pageValues[1:]
+		}
+	}
+	return c, nil
+}
+
+// parquetGroupValue and parquetListValue are the values of a group and of a repeated field being assembled.
+type parquetGroupValue struct {
+	fields []interface{}
+}
+
+type parquetListValue struct {
+	elements []interface{}
+}
+
+// assemble is to assemble the values of the fields in a row group from the values of their columns.
+func (f *parquetFile) assemble(columns []*parquetColumnValues, numRows int64) ([][]interface{}, error) {
+	values := make([][]interface{}, len(f.fields))
+	for i, field := range f.fields {
+		if field.column >= 0 && field.repetition != parquetRepeated {
+			// the values of a column which isn't nested are the values of the field
+			if int64(len(columns[field.column].values)) < numRows {
+				return nil, ErrParquet
+			}
+			values[i] = columns[field.column].values
+			continue
+		}
+		assembled := make([]interface{}, numRows)
+		for _, path := range field.columnPaths(nil) {
+			column := &f.columns[path[len(path)-1].column]
+			c := columns[path[len(path)-1].column]
+			cursors := make([]int, len(path))
+			row := int64(-1)
+			for j, value := range c.values {
+				r, d := c.levels(j, column)
+				if r == 0 {
+					row++
+				}
+				if row < 0 || row >= numRows {
+					return nil, fmt.Errorf("%w: column %s has %d rows or more in a row group of %d", ErrParquet,
+						column.name, row+1, numRows)
+				}
+				assembleValue(&assembled[row], path, cursors, r, d, value)
+			}
+			if row != numRows-1 {
+				return nil, fmt.Errorf("%w: column %s has %d rows in a row group of %d", ErrParquet, column.name,
+					row+1, numRows)
+			}
+		}
+		values[i] = make([]interface{}, numRows)
+		for row, v := range assembled {
+			values[i][row] = field.value(v)
+		}
+	}
+	return values, nil
+}
+
+// columnPaths returns the paths from the field to its columns.
+func (p *parquetField) columnPaths(parent []*parquetField) [][]*parquetField {
+	path := append(append([]*parquetField{}, parent...), p)
+	if p.column >= 0 {
+		return [][]*parquetField{path}
+	}
+	var paths [][]*parquetField
+	for _, field := range p.fields {
+		paths = append(paths, field.columnPaths(path)...)
+	}
+	return paths
+}
+
+// assembleValue is to put a value of the column at the end of path into the value of the first field of path,
+// which is in slot. r and d are the repetition and definition levels of the value, which tell the element of the
+// repeated fields on the path it is in, and the fields it is defined in. cursors are the current element of the
+// repeated fields, which are kept from a value to the next one.
+func assembleValue(slot *interface{}, path []*parquetField, cursors []int, r int, d int, value interface{}) {
+	for i, field := range path {
+		if d < field.defLevel {
+			// the field is NULL, or has no element if it is repeated
+			if field.repetition == parquetRepeated && *slot == nil {
+				*slot = &parquetListValue{}
+			}
+			return
+		}
+		if field.repetition == parquetRepeated {
+			list, _ := (*slot).(*parquetListValue)
+			if list == nil {
+				list = &parquetListValue{}
+				*slot = list
+			}
+			switch {
+			case r < field.repLevel:
+				cursors[i] = 0
+			case r == field.repLevel:
+				cursors[i]++
+			}
+			for len(list.elements) <= cursors[i] {
+				list.elements = append(list.elements, nil)
+			}
+			slot = &list.elements[cursors[i]]
+		}
+		if field.column >= 0 {
+			*slot = value
+			return
+		}
+		group, _ := (*slot).(*parquetGroupValue)
+		if group == nil {
+			group = &parquetGroupValue{fields: make([]interface{}, len(field.fields))}
+			*slot = group
+		}
+		slot = &group.fields[path[i+1].index]
+	}
+}
+
+// value converts an assembled value of the field to the value of its Athena type, the same as complexDecoder
+// decodes from the text rendering of an ARRAY, MAP or ROW. A repeated field out of a LIST is an ARRAY.
+func (p *parquetField) value(v interface{}) interface{} {
+	if p.repetition == parquetRepeated {
+		values := []interface{}{}
+		if list, ok := v.(*parquetListValue); ok {
+			for _, element := range list.elements {
+				values = append(values, p.elementValue(element))
+			}
+		}
+		return values
+	}
+	return p.elementValue(v)
+}
+
+// elementValue converts a value of the field, or an element of it if the field is repeated.
+func (p *parquetField) elementValue(v interface{}) interface{} {
+	group, ok := v.(*parquetGroupValue)
+	if !ok {
+		// a column, or NULL
+		return v
+	}
+	switch {
+	case p.convertedType == parquetList && len(p.fields) == 1 && p.fields[0].repetition == parquetRepeated:
+		return p.fields[0].listValue(group.fields[0])
+	case (p.convertedType == parquetMap || p.convertedType == parquetMapKeyValue) && len(p.fields) == 1 &&
+		len(p.fields[0].fields) == 2:
+		entries := p.fields[0]
+		values := map[string]interface{}{}
+		if list, ok := group.fields[0].(*parquetListValue); ok {
+			for _, element := range list.elements {
+				if entry, ok := element.(*parquetGroupValue); ok {
+					key := entries.fields[0].value(entry.fields[0])
+					values[formatComplexValue(key)] = entries.fields[1].value(entry.fields[1])
+				}
+			}
+		}
+		return values
+	}
+	row := make(RowValue, len(p.fields))
+	for i, field := range p.fields {
+		row[i] = RowField{Name: field.name, Value: field.value(group.fields[i])}
+	}
+	return row
+}
+
+// listValue converts the value of the repeated field of a LIST to its elements. The repeated field is a group of
+// the element, or the element itself in the layouts of the older writers.
+// https://github.com/apache/parquet-format/blob/master/LogicalTypes.md#backward-compatibility-rules
+func (p *parquetField) listValue(v interface{}) []interface{} {
+	values := []interface{}{}
+	list, ok := v.(*parquetListValue)
+	if !ok {
+		return values
+	}
+	for _, element := range list.elements {
+		group, ok := element.(*parquetGroupValue)
+		if ok && len(p.fields) == 1 && p.name != "array" && !strings.HasSuffix(p.name, "_tuple") {
+			values = append(values, p.fields[0].value(group.fields[0]))
+			continue
+		}
+		values = append(values, p.elementValue(element))
+	}
+	return values
+}
+
+// athenaType returns the Athena type of the values of a field which is a group or repeated.
+func (p *parquetField) athenaType() string {
+	switch {
+	case p.repetition == parquetRepeated || p.convertedType == parquetList:
+		return "array"
+	case p.convertedType == parquetMap || p.convertedType == parquetMapKeyValue:
+		return "map"
+	}
+	return "row"
+}
+
+// columnInfo returns the ColumnInfo of a top level field, like the one returned by GetQueryResults, where an ARRAY,
+// MAP or ROW column has the name of its type only.
+func (p *parquetFile) columnInfo(field *parquetField) *athena.ColumnInfo {
+	if field.column >= 0 && field.repetition != parquetRepeated {
+		return p.columns[field.column].columnInfo()
+	}
+	info := newColumnInfo(field.name, field.athenaType())
+	if field.repetition == parquetRequired {
+		info.Nullable = aws.String(athena.ColumnNullableNotNull)
+	} else {
+		info.Nullable = aws.String(athena.ColumnNullableNullable)
+	}
+	return info
+}
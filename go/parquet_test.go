@@ -0,0 +1,953 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"math/bits"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// thriftWriter encodes the Thrift compact protocol, to write the Parquet files read by the tests.
+type thriftWriter struct {
+	bytes.Buffer
+	last []int16
+}
+
+func (w *thriftWriter) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	top := len(w.last) - 1
+	if delta := id - w.last[top]; delta > 0 && delta <= 15 {
+		w.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.WriteByte(typ)
+		w.uvarint(uint64((int64(id) << 1) ^ (int64(id) >> 63)))
+	}
+	w.last[top] = id
+}
+
+func (w *thriftWriter) int(id int16, typ byte, v int64) {
+	w.field(id, typ)
+	w.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) i32(id int16, v int64) { w.int(id, 5, v) }
+
+func (w *thriftWriter) i64(id int16, v int64) { w.int(id, 6, v) }
+
+func (w *thriftWriter) binary(id int16, b []byte) {
+	w.field(id, 8)
+	w.uvarint(uint64(len(b)))
+	w.Write(b)
+}
+
+func (w *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		w.field(id, 1)
+	} else {
+		w.field(id, 2)
+	}
+}
+
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, 9)
+	if n < 15 {
+		w.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	w.WriteByte(0xf0 | typ)
+	w.uvarint(uint64(n))
+}
+
+// begin starts a struct, which is a field if id isn't 0, or an element of a list otherwise.
+func (w *thriftWriter) begin(id int16) {
+	if id != 0 {
+		w.field(id, 12)
+	}
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) end() {
+	w.WriteByte(0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// testParquetColumn is a column of a Parquet file written by writeTestParquet. A value is plain encoded, except
+// the length of a BYTE_ARRAY, and nil for NULL. The column of a nested field has the levels of its values, and a
+// value is nil if it isn't defined.
+type testParquetColumn struct {
+	parquetColumn
+	dictionary  bool
+	v2          bool
+	values      [][]byte
+	repetitions []uint32
+	definitions []uint32
+}
+
+// testParquetGroup is a group of the schema written by writeTestParquetSchema, whose fields are the schema
+// elements following it.
+type testParquetGroup struct {
+	name          string
+	repetition    int64
+	convertedType int64
+	fields        int
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func encodeTestPlain(column testParquetColumn, values [][]byte) []byte {
+	var buf bytes.Buffer
+	if column.physicalType == parquetBoolean {
+		packed := make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			packed[i/8] |= v[0] << (i % 8)
+		}
+		return packed
+	}
+	for _, v := range values {
+		if column.physicalType == parquetByteArray {
+			_ = binary.Write(&buf, binary.LittleEndian, uint32(len(v)))
+		}
+		buf.Write(v)
+	}
+	return buf.Bytes()
+}
+
+// encodeTestBitPacked encodes values with the bit-packed runs of the RLE/bit-packing hybrid encoding.
+func encodeTestBitPacked(values []uint32, bitWidth int) []byte {
+	groups := (len(values) + 7) / 8
+	w := &thriftWriter{}
+	w.uvarint(uint64(groups<<1 | 1))
+	packed := make([]byte, groups*bitWidth)
+	for i, v := range values {
+		for b := 0; b < bitWidth; b++ {
+			bit := i*bitWidth + b
+			packed[bit/8] |= byte(v>>b&1) << (bit % 8)
+		}
+	}
+	w.Write(packed)
+	return w.Bytes()
+}
+
+// encodeTestLevels encodes definition levels with the RLE runs of the RLE/bit-packing hybrid encoding.
+func encodeTestLevels(values [][]byte) []byte {
+	w := &thriftWriter{}
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && (values[j] == nil) == (values[i] == nil) {
+			j++
+		}
+		w.uvarint(uint64((j - i) << 1))
+		if values[i] == nil {
+			w.WriteByte(0)
+		} else {
+			w.WriteByte(1)
+		}
+		i = j
+	}
+	return w.Bytes()
+}
+
+func writeTestPageHeader(w *bytes.Buffer, pageType int64, uncompressed int, compressed int,
+	writeHeader func(h *thriftWriter)) {
+	h := &thriftWriter{}
+	h.begin(0)
+	h.i32(1, pageType)
+	h.i32(2, int64(uncompressed))
+	h.i32(3, int64(compressed))
+	writeHeader(h)
+	h.end()
+	w.Write(h.Bytes())
+}
+
+// writeTestColumnChunk writes the values of a column chunk in pages of up to 4 values, and returns the offset
+// of its dictionary page, which is 0 if there is none.
+func writeTestColumnChunk(t *testing.T, file *bytes.Buffer, column testParquetColumn,
+	values [][]byte) (int64, int64) {
+	var dictionary [][]byte
+	indexOf := map[string]uint32{}
+	dictionaryOffset := int64(0)
+	if column.dictionary {
+		for _, v := range values {
+			if _, ok := indexOf[string(v)]; v != nil && !ok {
+				indexOf[string(v)] = uint32(len(dictionary))
+				dictionary = append(dictionary, v)
+			}
+		}
+		dictionaryOffset = int64(file.Len())
+		page := encodeTestPlain(column, dictionary)
+		compressed := gzipBytes(t, page)
+		writeTestPageHeader(file, parquetDictionaryPage, len(page), len(compressed), func(h *thriftWriter) {
+			h.begin(7)
+			h.i32(1, int64(len(dictionary)))
+			h.i32(2, parquetPlainDictionary)
+			h.end()
+		})
+		file.Write(compressed)
+	}
+	dataOffset := int64(file.Len())
+	for start := 0; start < len(values); start += 4 {
+		n := len(values) - start
+		if n > 4 {
+			n = 4
+		}
+		pageValues := values[start : start+n]
+		var nonNull [][]byte
+		var indices []uint32
+		for _, v := range pageValues {
+			if v != nil {
+				nonNull = append(nonNull, v)
+				indices = append(indices, indexOf[string(v)])
+			}
+		}
+		encoding := int64(parquetPlain)
+		data := encodeTestPlain(column, nonNull)
+		if column.dictionary {
+			encoding = parquetRLEDictionary
+			bitWidth := 0
+			for 1<<bitWidth < len(dictionary) {
+				bitWidth++
+			}
+			data = append([]byte{byte(bitWidth)}, encodeTestBitPacked(indices, bitWidth)...)
+		}
+		var repetitionLevels, levels []byte
+		if column.definitions != nil {
+			levels = encodeTestBitPacked(column.definitions[start:start+n], bits.Len(uint(column.maxDef)))
+			if column.maxRep > 0 {
+				repetitionLevels = encodeTestBitPacked(column.repetitions[start:start+n],
+					bits.Len(uint(column.maxRep)))
+			}
+		} else if column.optional {
+			levels = encodeTestLevels(pageValues)
+		}
+		if column.v2 {
+			compressed := gzipBytes(t, data)
+			levelsLength := len(repetitionLevels) + len(levels)
+			writeTestPageHeader(file, parquetDataPageV2, levelsLength+len(data), levelsLength+len(compressed),
+				func(h *thriftWriter) {
+					h.begin(8)
+					h.i32(1, int64(n))
+					h.i32(2, int64(n-len(nonNull)))
+					h.i32(3, int64(n))
+					h.i32(4, encoding)
+					h.i32(5, int64(len(levels)))
+					h.i32(6, int64(len(repetitionLevels)))
+					h.end()
+				})
+			file.Write(repetitionLevels)
+			file.Write(levels)
+			file.Write(compressed)
+			continue
+		}
+		page := data
+		for _, l := range [][]byte{levels, repetitionLevels} {
+			if l != nil {
+				length := make([]byte, 4)
+				binary.LittleEndian.PutUint32(length, uint32(len(l)))
+				page = append(append(length, l...), page...)
+			}
+		}
+		compressed := gzipBytes(t, page)
+		writeTestPageHeader(file, parquetDataPage, len(page), len(compressed), func(h *thriftWriter) {
+			h.begin(5)
+			h.i32(1, int64(n))
+			h.i32(2, encoding)
+			h.i32(3, parquetRLE)
+			h.i32(4, parquetRLE)
+			h.end()
+		})
+		file.Write(compressed)
+	}
+	return dictionaryOffset, dataOffset
+}
+
+// writeTestParquet writes a Parquet file of the columns, with row groups of up to rowGroupSize rows.
+func writeTestParquet(t *testing.T, columns []testParquetColumn, rowGroupSize int) []byte {
+	schema := make([]interface{}, len(columns))
+	for i, column := range columns {
+		schema[i] = column
+	}
+	return writeTestParquetSchema(t, schema, len(columns[0].values), rowGroupSize)
+}
+
+// writeTestParquetSchema writes a Parquet file of the schema, whose elements are a testParquetColumn or a
+// testParquetGroup. A file with nested fields has a single row group.
+func writeTestParquetSchema(t *testing.T, schema []interface{}, numRows int, rowGroupSize int) []byte {
+	file := bytes.NewBufferString("PAR1")
+	footer := &thriftWriter{}
+	footer.begin(0)
+	footer.i32(1, 1)
+	footer.list(2, 12, len(schema)+1)
+	footer.begin(0)
+	footer.binary(4, []byte("hive_schema"))
+	fields := 0
+	for i := 0; i < len(schema); i++ {
+		if group, ok := schema[i].(testParquetGroup); ok {
+			// skip the fields of the group
+			for n := group.fields; n > 0; n-- {
+				i++
+				if g, ok := schema[i].(testParquetGroup); ok {
+					n += g.fields
+				}
+			}
+		}
+		fields++
+	}
+	footer.i32(5, int64(fields))
+	footer.end()
+	var columns []testParquetColumn
+	for _, element := range schema {
+		footer.begin(0)
+		if group, ok := element.(testParquetGroup); ok {
+			footer.i32(3, group.repetition)
+			footer.binary(4, []byte(group.name))
+			footer.i32(5, int64(group.fields))
+			if group.convertedType != parquetNone {
+				footer.i32(6, group.convertedType)
+			}
+			footer.end()
+			continue
+		}
+		column := element.(testParquetColumn)
+		columns = append(columns, column)
+		footer.i32(1, column.physicalType)
+		if column.typeLength > 0 {
+			footer.i32(2, column.typeLength)
+		}
+		if column.optional {
+			footer.i32(3, parquetOptional)
+		} else {
+			footer.i32(3, 0)
+		}
+		footer.binary(4, []byte(column.name))
+		if column.convertedType != parquetNone {
+			footer.i32(6, column.convertedType)
+		}
+		if column.convertedType == parquetDecimal {
+			footer.i32(7, column.scale)
+			footer.i32(8, column.precision)
+		}
+		footer.end()
+	}
+	footer.i64(3, int64(numRows))
+	footer.list(4, 12, (numRows+rowGroupSize-1)/rowGroupSize)
+	for start := 0; start < numRows; start += rowGroupSize {
+		end := start + rowGroupSize
+		if end > numRows {
+			end = numRows
+		}
+		footer.begin(0)
+		footer.list(1, 12, len(columns))
+		for _, column := range columns {
+			chunkStart := file.Len()
+			values := column.values[start:end]
+			if column.definitions != nil {
+				assert.True(t, start == 0 && end == numRows, "a single row group")
+				values = column.values
+			}
+			dictionaryOffset, dataOffset := writeTestColumnChunk(t, file, column, values)
+			footer.begin(0)
+			footer.i64(2, int64(chunkStart))
+			footer.begin(3)
+			footer.i32(1, column.physicalType)
+			footer.list(2, 5, 1)
+			footer.uvarint(parquetPlain << 1)
+			footer.list(3, 8, 1)
+			footer.uvarint(uint64(len(column.name)))
+			footer.WriteString(column.name)
+			footer.i32(4, parquetGzip)
+			footer.i64(5, int64(len(values)))
+			footer.i64(6, int64(file.Len()-chunkStart))
+			footer.i64(7, int64(file.Len()-chunkStart))
+			footer.i64(9, dataOffset)
+			if dictionaryOffset > 0 {
+				footer.i64(11, dictionaryOffset)
+			}
+			footer.end()
+			footer.end()
+		}
+		footer.i64(2, 0)
+		footer.i64(3, int64(end-start))
+		footer.end()
+	}
+	footer.end()
+	file.Write(footer.Bytes())
+	_ = binary.Write(file, binary.LittleEndian, uint32(footer.Len()))
+	file.WriteString("PAR1")
+	return file.Bytes()
+}
+
+func le32(v int32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func le64(v int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func int96(t time.Time) []byte {
+	days := t.Unix()/(24*60*60) + julianDayOfUnixEpoch
+	nanos := t.Sub(time.Unix((days-julianDayOfUnixEpoch)*24*60*60, 0))
+	return append(le64(int64(nanos)), le32(int32(days))...)
+}
+
+func newTestParquetColumn(name string, physicalType int64, convertedType int64, optional bool,
+	values ...[]byte) testParquetColumn {
+	return testParquetColumn{
+		parquetColumn: parquetColumn{
+			name:          name,
+			physicalType:  physicalType,
+			convertedType: convertedType,
+			optional:      optional,
+		},
+		values: values,
+	}
+}
+
+var testTimestamp = time.Date(2020, 2, 29, 13, 14, 15, 123000000, time.UTC)
+
+// createTestParquetColumns returns the columns of every type, with 6 rows.
+func createTestParquetColumns() []testParquetColumn {
+	name := newTestParquetColumn("name", parquetByteArray, parquetUTF8, true,
+		[]byte("a"), nil, []byte("b"), []byte("a"), []byte(""), []byte("c"))
+	name.dictionary = true
+	price := newTestParquetColumn("price", parquetFixedLenByteArray, parquetDecimal, true,
+		[]byte{0, 0, 0x04, 0xce}, []byte{0xff, 0xff, 0xff, 0xfb}, nil, []byte{0, 0, 0, 0},
+		[]byte{0, 0x0f, 0x42, 0x40}, nil)
+	price.typeLength, price.scale, price.precision = 4, 2, 9
+	ts := newTestParquetColumn("ts", parquetInt96, parquetNone, true,
+		int96(testTimestamp), nil, int96(time.Unix(0, 0)), nil, nil, int96(testTimestamp.Add(time.Hour)))
+	ts.v2 = true
+	code := newTestParquetColumn("code", parquetInt32, parquetNone, true,
+		le32(7), le32(7), le32(7), nil, le32(-7), le32(7))
+	code.dictionary, code.v2 = true, true
+	return []testParquetColumn{
+		newTestParquetColumn("id", parquetInt64, parquetNone, false,
+			le64(1), le64(2), le64(3), le64(4), le64(5), le64(1<<40)),
+		name, price, ts, code,
+		newTestParquetColumn("flag", parquetBoolean, parquetNone, false,
+			[]byte{1}, []byte{0}, []byte{1}, []byte{1}, []byte{0}, []byte{1}),
+		newTestParquetColumn("day", parquetInt32, parquetDate, true,
+			le32(18321), nil, le32(0), le32(-1), nil, nil),
+		newTestParquetColumn("tiny", parquetInt32, parquetInt8, false,
+			le32(-128), le32(127), le32(0), le32(1), le32(2), le32(3)),
+		newTestParquetColumn("small", parquetInt32, parquetInt16, true,
+			le32(-32768), nil, le32(32767), nil, le32(0), nil),
+		newTestParquetColumn("ratio", parquetDouble, parquetNone, true,
+			le64(int64(math.Float64bits(0.5))), nil, nil, nil, nil, le64(int64(math.Float64bits(-1e100)))),
+		newTestParquetColumn("real", parquetFloat, parquetNone, false,
+			le32(int32(math.Float32bits(1.5))), le32(0), le32(0), le32(0), le32(0), le32(0)),
+		newTestParquetColumn("bin", parquetByteArray, parquetNone, true,
+			[]byte{0, 1, 2}, nil, []byte{}, nil, nil, nil),
+	}
+}
+
+// testParquetRows are the rows of createTestParquetColumns, the way Rows returns them.
+var testParquetRows = [][]driver.Value{
+	{int64(1), "a", "12.30", testTimestamp, int32(7), true, time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		int8(-128), int16(-32768), 0.5, float32(1.5), []byte{0, 1, 2}},
+	{int64(2), nil, "-0.05", nil, int32(7), false, nil, int8(127), nil, nil, float32(0), nil},
+	{int64(3), "b", nil, time.Unix(0, 0).UTC(), int32(7), true, time.Unix(0, 0).UTC(), int8(0), int16(32767),
+		nil, float32(0), []byte{}},
+	{int64(4), "a", "0.00", nil, nil, true, time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), int8(1), nil, nil,
+		float32(0), nil},
+	{int64(5), "", "10000.00", nil, int32(-7), false, nil, int8(2), int16(0), nil, float32(0), nil},
+	{int64(1 << 40), "c", nil, testTimestamp.Add(time.Hour), int32(7), true, nil, int8(3), nil, -1e100,
+		float32(0), nil},
+}
+
+func TestParseParquetFooter(t *testing.T) {
+	data := writeTestParquet(t, createTestParquetColumns(), 4)
+	footerSize := binary.LittleEndian.Uint32(data[len(data)-8:])
+	f, err := parseParquetFooter(data[len(data)-8-int(footerSize) : len(data)-8])
+	assert.Nil(t, err)
+	var types []string
+	for _, column := range f.columns {
+		types = append(types, column.athenaType())
+	}
+	assert.Equal(t, []string{"bigint", "varchar", "decimal", "timestamp", "integer", "boolean", "date", "tinyint",
+		"smallint", "double", "real", "varbinary"}, types)
+	assert.Equal(t, int64(2), f.columns[2].scale)
+	assert.Equal(t, int64(9), *f.columns[2].columnInfo().Precision)
+	assert.Len(t, f.rowGroups, 2)
+	assert.Equal(t, int64(4), f.rowGroups[0].numRows)
+	assert.Equal(t, int64(2), f.rowGroups[1].numRows)
+
+	// a group without its fields
+	w := &thriftWriter{}
+	w.begin(0)
+	w.list(2, 12, 2)
+	w.begin(0)
+	w.binary(4, []byte("hive_schema"))
+	w.i32(5, 1)
+	w.end()
+	w.begin(0)
+	w.i32(3, parquetRepeated)
+	w.binary(4, []byte("tags"))
+	w.i32(5, 1)
+	w.end()
+	w.end()
+	_, err = parseParquetFooter(w.Bytes())
+	assert.True(t, errors.Is(err, ErrParquet))
+
+	_, err = parseParquetFooter([]byte{0x15})
+	assert.True(t, errors.Is(err, ErrParquet))
+}
+
+func TestParquetColumn_FromLogicalType(t *testing.T) {
+	w := &thriftWriter{}
+	w.begin(0)
+	w.begin(8)
+	w.boolean(1, true)
+	w.begin(2)
+	w.begin(2)
+	w.end()
+	w.end()
+	w.end()
+	w.end()
+	logical, err := (&thriftReader{buf: w.Bytes()}).readStruct()
+	assert.Nil(t, err)
+	column := parquetColumn{physicalType: parquetInt64, convertedType: parquetNone}
+	column.fromLogicalType(logical)
+	assert.Equal(t, "timestamp", column.athenaType())
+	assert.Equal(t, time.Unix(1, 500000).UTC(), column.value(le64(1000500)))
+}
+
+func TestDecodeRLEHybrid(t *testing.T) {
+	// an RLE run of 3 fives, and a bit-packed run of 1, 2, 3
+	data := append([]byte{3 << 1, 5}, encodeTestBitPacked([]uint32{1, 2, 3}, 3)...)
+	values, err := decodeRLEHybrid(data, 3, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{5, 5, 5, 1, 2, 3}, values)
+
+	values, err = decodeRLEHybrid([]byte{10 << 1}, 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, values, 10)
+
+	_, err = decodeRLEHybrid(data, 3, 20)
+	assert.True(t, errors.Is(err, ErrParquet))
+}
+
+func TestFormatDecimal(t *testing.T) {
+	for unscaled, expected := range map[int64]string{1230: "12.30", -5: "-0.05", 0: "0.00", 100: "1.00"} {
+		assert.Equal(t, expected, formatDecimal(big.NewInt(unscaled), 2))
+	}
+	assert.Equal(t, "-42", formatDecimal(big.NewInt(-42), 0))
+}
+
+func TestUnloadQuery(t *testing.T) {
+	assert.Equal(t, "UNLOAD (\nSELECT 1 -- one\n) TO 's3://bucket/tmp/x/' WITH (format = 'PARQUET', "+
+		"compression = 'GZIP')", unloadQuery("SELECT 1 -- one;\n", "s3://bucket/tmp/x/"))
+	assert.True(t, isUnloadableQuery(" with t as (select 1) select * from t"))
+	assert.True(t, isUnloadableQuery("SELECT 1"))
+	assert.False(t, isUnloadableQuery("SHOW TABLES"))
+	assert.False(t, isUnloadableQuery("INSERT INTO t SELECT 1"))
+	// the order of the rows isn't kept by UNLOAD
+	assert.False(t, isUnloadableQuery("SELECT a FROM t ORDER BY a"))
+	assert.False(t, isUnloadableQuery("SELECT a FROM t UNION ALL SELECT b FROM u\norder\n  by 1 LIMIT 10"))
+	assert.False(t, isUnloadableQuery("WITH x AS (SELECT a FROM t ORDER BY a) SELECT * FROM x ORDER BY a"))
+	assert.True(t, isUnloadableQuery("WITH x AS (SELECT a FROM t ORDER BY a) SELECT * FROM x"))
+	assert.True(t, isUnloadableQuery("SELECT row_number() OVER (ORDER BY a), array_agg(b ORDER BY b) FROM t"))
+	assert.True(t, isUnloadableQuery("SELECT 'order by' AS \"order by\" FROM t -- order by a"))
+	assert.True(t, isUnloadableQuery("SELECT * FROM t /* ORDER BY a */ WHERE border = 1 AND b = 'y'"))
+
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetOutputBucket("s3://bucket/results/")
+	location := unloadLocation(testConf, "token")
+	assert.Equal(t, location, unloadLocation(testConf, "token"))
+	assert.NotEqual(t, location, unloadLocation(testConf, "another token"))
+	assert.True(t, strings.HasPrefix(location, "s3://bucket/results/tmp/"))
+	assert.True(t, strings.HasSuffix(location, "/"))
+}
+
+func createUnloadTestConnection(t *testing.T) (*Connection, *dirS3Reader) {
+	c := createQueryHandleTestConnection()
+	assert.Nil(t, c.connector.config.SetResultMode(ResultModeUnload))
+	reader := newDirS3Reader(t, nil)
+	c.s3Reader = reader
+	c.athenaAPI.(*mockAthenaClient).queryExecutions = map[string]*athena.QueryExecution{
+		"SELECTQueryContext_OK_QID": {
+			QueryExecutionId: aws.String("SELECTQueryContext_OK_QID"),
+			Status: &athena.QueryExecutionStatus{
+				State: aws.String(athena.QueryExecutionStateSucceeded),
+			},
+			StatementType: aws.String(athena.StatementTypeDml),
+		},
+	}
+	return c, reader
+}
+
+func writeTestObject(t *testing.T, reader *dirS3Reader, location string, data []byte) {
+	bucket, key, err := parseS3Location(location)
+	assert.Nil(t, err)
+	path := reader.root + "/" + bucket + "/" + key
+	assert.Nil(t, os.MkdirAll(path[:strings.LastIndex(path, "/")], 0700))
+	f, err := os.Create(path)
+	assert.Nil(t, err)
+	_, err = f.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestConnection_StartQuery_ResultModeUnload(t *testing.T) {
+	c, reader := createUnloadTestConnection(t)
+	defer os.RemoveAll(reader.root)
+	m := c.athenaAPI.(*mockAthenaClient)
+	c.connector.config.SetMissingAsNil(true)
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	location := h.(*queryHandle).unloadLocation
+	assert.Equal(t, 1, m.startQueryExecutionCalls[unloadQuery("SELECTQueryContext_OK", location)])
+
+	columns := createTestParquetColumns()
+	writeTestObject(t, reader, location+"20200229_000001_00001_abcde_0", writeTestParquet(t, columns, 4))
+	for i := range columns {
+		columns[i].values = columns[i].values[4:]
+	}
+	writeTestObject(t, reader, location+"20200229_000001_00001_abcde_1", writeTestParquet(t, columns, 4))
+
+	rows, err := h.Rows(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name", "price", "ts", "code", "flag", "day", "tiny", "small", "ratio", "real",
+		"bin"}, rows.Columns())
+	assert.Equal(t, "decimal", rows.(*Rows).ColumnTypeDatabaseTypeName(2))
+	var values [][]driver.Value
+	for {
+		dest := make([]driver.Value, len(rows.Columns()))
+		if err := rows.Next(dest); err == io.EOF {
+			break
+		} else if !assert.Nil(t, err) {
+			break
+		}
+		values = append(values, dest)
+	}
+	expected := append(append([][]driver.Value{}, testParquetRows...), testParquetRows[4:]...)
+	assert.Equal(t, expected, values)
+
+	// the result is removed once it is read
+	assert.Nil(t, rows.Close())
+	keys, err := reader.List(context.Background(), "fake-query-results-arbitrary-bucket", "tmp/")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestUnloadResult_Next(t *testing.T) {
+	reader := newDirS3Reader(t, nil)
+	defer os.RemoveAll(reader.root)
+	columns := createTestParquetColumns()
+	writeTestObject(t, reader, "s3://bucket/tmp/0", writeTestParquet(t, columns, 4))
+	writeTestObject(t, reader, "s3://bucket/tmp/1", writeTestParquet(t, columns[:2], 4))
+
+	// the first file is read by next too, if it isn't read before
+	u := &unloadResult{ctx: context.Background(), store: reader, bucket: "bucket", keys: []string{"tmp/0", "tmp/1"},
+		row: -1}
+	for i := range testParquetRows {
+		assert.Nil(t, u.next())
+		assert.Equal(t, testParquetRows[i][0], u.columns[0][u.row])
+	}
+	// the files have to have the same columns
+	assert.True(t, errors.Is(u.next(), ErrParquet))
+}
+
+func TestConnection_QueryContext_ResultModeUnload(t *testing.T) {
+	c, reader := createUnloadTestConnection(t)
+	defer os.RemoveAll(reader.root)
+	c.connector.config.SetMissingAsEmptyString(true)
+	c.connector.config.SetMaskedColumnValue("name", "xxx")
+	token := ClientRequestTokenOf("unload test")
+	location := unloadLocation(c.connector.config, token)
+	writeTestObject(t, reader, location+"0", writeTestParquet(t, createTestParquetColumns(), 2))
+
+	rows, err := c.QueryContext(WithClientRequestToken(context.Background(), token), "SELECTQueryContext_OK",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	dest := make([]driver.Value, len(rows.Columns()))
+	assert.Nil(t, rows.Next(dest))
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, "xxx", dest[1])
+	assert.Equal(t, "", dest[3])
+	assert.Nil(t, rows.Close())
+	// the result of a query with a ClientRequestToken is removed too
+	keys, err := reader.List(context.Background(), "fake-query-results-arbitrary-bucket", "tmp/")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	// submitting the query again returns the same query execution, whose result is removed, so it is run again
+	// with UNLOAD to a new location. UNLOAD writes no file for an empty result, whose columns come from
+	// GetQueryResults.
+	m := c.athenaAPI.(*mockAthenaClient)
+	rows, err = c.QueryContext(WithClientRequestToken(context.Background(), token), "SELECTQueryContext_OK",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"_col0"}, rows.Columns())
+	assert.Equal(t, "integer", rows.(*Rows).ColumnTypeDatabaseTypeName(0))
+	assert.Equal(t, io.EOF, rows.Next(dest))
+	assert.Nil(t, rows.Close())
+	rerunToken := m.clientRequestTokens[len(m.clientRequestTokens)-1]
+	assert.NotEqual(t, token, rerunToken)
+	assert.Equal(t, 1, m.startQueryExecutionCalls[unloadQuery("SELECTQueryContext_OK",
+		unloadLocation(c.connector.config, rerunToken))])
+	// the query run again isn't run once more if its result is empty too
+	assert.Equal(t, 3, len(m.clientRequestTokens))
+
+	// a query without a ClientRequestToken from the context isn't run again for an empty result
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	rows, err = h.Rows(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, io.EOF, rows.Next(dest))
+	assert.Equal(t, 4, len(m.clientRequestTokens))
+	_, err = newUnloadRows(context.Background(), c.athenaAPI, reader, location,
+		&athena.QueryExecution{QueryExecutionId: aws.String("GetQueryResultsWithContext_return_error")},
+		c.connector.config, c.connector.tracer)
+	assert.Equal(t, ErrTestMockGeneric, err)
+
+	// statements other than SELECT are not unloaded, nor are the queries which order their result
+	assert.Equal(t, context.Background(), c.withUnload(context.Background(), "SHOW TABLES"))
+	assert.Equal(t, context.Background(), c.withUnload(context.Background(), "SELECT * FROM t ORDER BY 1"))
+
+	// the files are removed if they can't be read
+	h, err = c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	writeTestObject(t, reader, h.(*queryHandle).unloadLocation+"0", []byte("not parquet"))
+	_, err = h.Rows(context.Background())
+	assert.True(t, errors.Is(err, ErrParquet))
+	keys, err = reader.List(context.Background(), "fake-query-results-arbitrary-bucket", "tmp/")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func newTestNestedColumn(name string, physicalType int64, convertedType int64, maxDef int, maxRep int,
+	repetitions []uint32, definitions []uint32, values ...[]byte) testParquetColumn {
+	column := newTestParquetColumn(name, physicalType, convertedType, true, values...)
+	column.maxDef, column.maxRep = maxDef, maxRep
+	column.repetitions, column.definitions = repetitions, definitions
+	return column
+}
+
+// createTestNestedParquetSchema returns the schema of an ARRAY(VARCHAR), a MAP(VARCHAR, INTEGER) and a
+// ROW(x BIGINT, name VARCHAR, points ARRAY(INTEGER)) column the way Athena writes them, with 4 rows.
+func createTestNestedParquetSchema() []interface{} {
+	tags := newTestNestedColumn("element", parquetByteArray, parquetUTF8, 3, 1,
+		[]uint32{0, 1, 0, 0, 0, 1}, []uint32{3, 3, 1, 0, 2, 3}, []byte("a"), []byte("b"), nil, nil, nil, []byte("c"))
+	tags.v2 = true
+	key := newTestNestedColumn("key", parquetByteArray, parquetUTF8, 2, 1,
+		[]uint32{0, 1, 0, 0, 0}, []uint32{2, 2, 0, 1, 2}, []byte("x"), []byte("y"), nil, nil, []byte("z"))
+	key.optional = false
+	return []interface{}{
+		newTestParquetColumn("id", parquetInt64, parquetNone, false, le64(1), le64(2), le64(3), le64(4)),
+		testParquetGroup{name: "tags", repetition: parquetOptional, convertedType: parquetList, fields: 1},
+		testParquetGroup{name: "list", repetition: parquetRepeated, convertedType: parquetNone, fields: 1},
+		tags,
+		testParquetGroup{name: "scores", repetition: parquetOptional, convertedType: parquetMap, fields: 1},
+		testParquetGroup{name: "key_value", repetition: parquetRepeated, convertedType: parquetNone, fields: 2},
+		key,
+		newTestNestedColumn("value", parquetInt32, parquetNone, 3, 1,
+			[]uint32{0, 1, 0, 0, 0}, []uint32{3, 2, 0, 1, 3}, le32(1), nil, nil, nil, le32(3)),
+		testParquetGroup{name: "item", repetition: parquetOptional, convertedType: parquetNone, fields: 3},
+		newTestNestedColumn("x", parquetInt64, parquetNone, 2, 0,
+			nil, []uint32{2, 0, 1, 2}, le64(10), nil, nil, le64(30)),
+		newTestNestedColumn("name", parquetByteArray, parquetUTF8, 2, 0,
+			nil, []uint32{2, 0, 2, 1}, []byte("n"), nil, []byte("m"), nil),
+		testParquetGroup{name: "points", repetition: parquetOptional, convertedType: parquetList, fields: 1},
+		testParquetGroup{name: "list", repetition: parquetRepeated, convertedType: parquetNone, fields: 1},
+		newTestNestedColumn("element", parquetInt32, parquetNone, 4, 1,
+			[]uint32{0, 1, 0, 0, 0}, []uint32{4, 4, 0, 1, 2}, le32(1), le32(2), nil, nil, nil),
+	}
+}
+
+func TestConnection_QueryContext_ResultModeUnload_Nested(t *testing.T) {
+	c, reader := createUnloadTestConnection(t)
+	defer os.RemoveAll(reader.root)
+	c.connector.config.SetMissingAsNil(true)
+	token := ClientRequestTokenOf("unload test")
+	location := unloadLocation(c.connector.config, token)
+	readRows := func() [][]driver.Value {
+		writeTestObject(t, reader, location+"0", writeTestParquetSchema(t, createTestNestedParquetSchema(), 4, 4))
+		rows, err := c.QueryContext(WithClientRequestToken(context.Background(), token), "SELECTQueryContext_OK",
+			[]driver.NamedValue{})
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		defer rows.Close()
+		assert.Equal(t, []string{"id", "tags", "scores", "item"}, rows.Columns())
+		r := rows.(*Rows)
+		for i, name := range []string{"bigint", "array", "map", "row"} {
+			assert.Equal(t, name, r.ColumnTypeDatabaseTypeName(i))
+		}
+		nullable, _ := r.ColumnTypeNullable(1)
+		assert.True(t, nullable)
+		var values [][]driver.Value
+		for {
+			dest := make([]driver.Value, len(rows.Columns()))
+			if err := rows.Next(dest); err == io.EOF {
+				break
+			} else if !assert.Nil(t, err) {
+				break
+			}
+			values = append(values, dest)
+		}
+		return values
+	}
+
+	// the same text rendering as GetQueryResults
+	assert.Equal(t, [][]driver.Value{
+		{int64(1), "[a, b]", "{x=1, y=null}", "{x=10, name=n, points=[1, 2]}"},
+		{int64(2), "[]", nil, nil},
+		{int64(3), nil, "{}", "{x=null, name=m, points=null}"},
+		{int64(4), "[null, c]", "{z=3}", "{x=30, name=null, points=[]}"},
+	}, readRows())
+
+	c.connector.config.SetDecodeComplexTypes(true)
+	assert.Equal(t, [][]driver.Value{
+		{int64(1), []interface{}{"a", "b"}, map[string]interface{}{"x": int32(1), "y": nil},
+			RowValue{{"x", int64(10)}, {"name", "n"}, {"points", []interface{}{int32(1), int32(2)}}}},
+		{int64(2), []interface{}{}, nil, nil},
+		{int64(3), nil, map[string]interface{}{}, RowValue{{"x", nil}, {"name", "m"}, {"points", nil}}},
+		{int64(4), []interface{}{nil, "c"}, map[string]interface{}{"z": int32(3)},
+			RowValue{{"x", int64(30)}, {"name", nil}, {"points", []interface{}{}}}},
+	}, readRows())
+}
+
+// The files under testdata/parquet are written by the Apache Arrow Go Parquet writer, see testdata/parquet/README.md.
+// They have the same rows, with GZIP, dictionary pages, DataPage v2, INT96 timestamps and nested columns.
+var testParquetFixtureRows = [][]driver.Value{
+	{int64(1), "alpha", "12.30", time.Date(2020, 2, 29, 12, 34, 56, 789000000, time.UTC),
+		time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), true, 0.5, []interface{}{"a", "b"},
+		map[string]interface{}{"x": int32(1), "y": nil},
+		RowValue{{"x", int64(10)}, {"name", "n"}, {"points", []interface{}{int32(1), int32(2)}}}},
+	{int64(2), nil, nil, nil, nil, false, nil, []interface{}{}, nil, nil},
+	{int64(3), "alpha", "-0.05", time.Unix(0, 0).UTC(), time.Unix(0, 0).UTC(), nil, -1.25, nil,
+		map[string]interface{}{}, RowValue{{"x", nil}, {"name", "m"}, {"points", nil}}},
+	{int64(4), "beta", "1234567.89", time.Date(2021, 12, 31, 23, 59, 59, 999999000, time.UTC),
+		time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), true, 1e10, []interface{}{nil, "c"},
+		map[string]interface{}{"z": int32(3)},
+		RowValue{{"x", int64(30)}, {"name", nil}, {"points", []interface{}{}}}},
+}
+
+func TestConnection_StartQuery_ResultModeUnload_Fixtures(t *testing.T) {
+	for _, name := range []string{"gzip_dictionary_v1.parquet", "gzip_dictionary_v2.parquet", "plain_v2.parquet"} {
+		c, reader := createUnloadTestConnection(t)
+		c.connector.config.SetMissingAsNil(true)
+		c.connector.config.SetDecodeComplexTypes(true)
+		h, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+		assert.Nil(t, err)
+		data, err := ioutil.ReadFile("testdata/parquet/" + name)
+		assert.Nil(t, err)
+		writeTestObject(t, reader, h.(*queryHandle).unloadLocation+"0", data)
+
+		rows, err := h.Rows(context.Background())
+		if !assert.Nil(t, err, name) {
+			os.RemoveAll(reader.root)
+			continue
+		}
+		assert.Equal(t, []string{"id", "name", "price", "ts", "day", "flag", "ratio", "tags", "scores", "item"},
+			rows.Columns(), name)
+		r := rows.(*Rows)
+		for i, typ := range []string{"bigint", "varchar", "decimal", "timestamp", "date", "boolean", "double",
+			"array", "map", "row"} {
+			assert.Equal(t, typ, r.ColumnTypeDatabaseTypeName(i), name)
+		}
+		var values [][]driver.Value
+		for {
+			dest := make([]driver.Value, len(rows.Columns()))
+			if err := rows.Next(dest); err == io.EOF {
+				break
+			} else if !assert.Nil(t, err, name) {
+				break
+			}
+			values = append(values, dest)
+		}
+		assert.Equal(t, testParquetFixtureRows, values, name)
+		assert.Nil(t, rows.Close())
+		os.RemoveAll(reader.root)
+	}
+}
+
+func TestRows_ColumnType_ResultModeUnload(t *testing.T) {
+	c, reader := createUnloadTestConnection(t)
+	defer os.RemoveAll(reader.root)
+	token := ClientRequestTokenOf("unload test")
+	location := unloadLocation(c.connector.config, token)
+	columns := createTestParquetColumns()
+	writeTestObject(t, reader, location+"0", writeTestParquet(t, columns, 2))
+
+	rows, err := c.QueryContext(WithClientRequestToken(context.Background(), token), "SELECTQueryContext_OK",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	r := rows.(*Rows)
+	for i, column := range columns {
+		for _, row := range testParquetRows {
+			if row[i] != nil {
+				assert.Equal(t, reflect.TypeOf(row[i]), r.ColumnTypeScanType(i), column.name)
+			}
+		}
+		nullable, ok := r.ColumnTypeNullable(i)
+		assert.True(t, ok)
+		assert.Equal(t, column.optional, nullable, column.name)
+	}
+	precision, scale, ok := r.ColumnTypePrecisionScale(2)
+	assert.True(t, ok)
+	assert.Equal(t, int64(9), precision)
+	assert.Equal(t, int64(2), scale)
+	length, ok := r.ColumnTypeLength(1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(math.MaxInt32), length)
+
+	c.connector.config.SetExactDecimal(true)
+	assert.Equal(t, reflect.TypeOf(""), r.ColumnTypeScanType(2))
+	dest := make([]driver.Value, len(columns))
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, "12.30", dest[2])
+	assert.Nil(t, rows.Close())
+}
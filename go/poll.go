@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// PollStrategy decides how long to wait between two status checks of a running query.
+// It can be set with SQLConnector.SetPollStrategy to replace the one configured in Config.
+type PollStrategy interface {
+	// NextInterval returns how long to wait after the n-th status check of a query, starting from 0.
+	NextInterval(n int) time.Duration
+}
+
+// ConstantPollStrategy polls the query status at a fixed interval.
+type ConstantPollStrategy struct {
+	Interval time.Duration
+}
+
+// NewConstantPollStrategy is to create a ConstantPollStrategy.
+func NewConstantPollStrategy(interval time.Duration) *ConstantPollStrategy {
+	return &ConstantPollStrategy{
+		Interval: interval,
+	}
+}
+
+// NextInterval returns the fixed interval.
+func (p *ConstantPollStrategy) NextInterval(n int) time.Duration {
+	return p.Interval
+}
+
+// BackoffPollStrategy polls the query status with an interval starting from InitialInterval and growing by
+// Factor after every check, up to MaxInterval. Jitter is the fraction of the interval to randomize by,
+// e.g. 0.2 for ±20%. Cheap queries get their result soon, and long queries don't burn the API quota.
+type BackoffPollStrategy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Factor          float64
+	Jitter          float64
+}
+
+// NewBackoffPollStrategy is to create a BackoffPollStrategy.
+func NewBackoffPollStrategy(initialInterval time.Duration, maxInterval time.Duration, factor float64,
+	jitter float64) *BackoffPollStrategy {
+	return &BackoffPollStrategy{
+		InitialInterval: initialInterval,
+		MaxInterval:     maxInterval,
+		Factor:          factor,
+		Jitter:          jitter,
+	}
+}
+
+// NextInterval returns InitialInterval * Factor^n, capped by MaxInterval and randomized by Jitter.
+func (p *BackoffPollStrategy) NextInterval(n int) time.Duration {
+	return backoffInterval(p.InitialInterval, p.MaxInterval, p.Factor, p.Jitter, n)
+}
+
+// backoffInterval is to compute an exponential backoff interval with jitter.
+func backoffInterval(initial time.Duration, max time.Duration, factor float64, jitter float64, n int) time.Duration {
+	if factor < 1 {
+		factor = 1
+	}
+	interval := float64(initial) * math.Pow(factor, float64(n))
+	if max > 0 && interval > float64(max) {
+		interval = float64(max)
+	}
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		interval += interval * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(interval)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstantPollStrategy(t *testing.T) {
+	p := NewConstantPollStrategy(time.Second)
+	assert.Equal(t, time.Second, p.NextInterval(0))
+	assert.Equal(t, time.Second, p.NextInterval(100))
+}
+
+func TestBackoffPollStrategy(t *testing.T) {
+	p := NewBackoffPollStrategy(100*time.Millisecond, time.Second, 2, 0)
+	assert.Equal(t, 100*time.Millisecond, p.NextInterval(0))
+	assert.Equal(t, 200*time.Millisecond, p.NextInterval(1))
+	assert.Equal(t, 800*time.Millisecond, p.NextInterval(3))
+	assert.Equal(t, time.Second, p.NextInterval(4))
+	assert.Equal(t, time.Second, p.NextInterval(1000))
+
+	p = NewBackoffPollStrategy(100*time.Millisecond, time.Second, 0.5, 0)
+	assert.Equal(t, 100*time.Millisecond, p.NextInterval(3))
+}
+
+func TestBackoffPollStrategy_Jitter(t *testing.T) {
+	p := NewBackoffPollStrategy(time.Second, 10*time.Second, 2, 0.2)
+	for i := 0; i < 100; i++ {
+		d := p.NextInterval(1)
+		assert.True(t, d >= 1600*time.Millisecond && d <= 2400*time.Millisecond)
+	}
+	p = NewBackoffPollStrategy(time.Second, 10*time.Second, 2, 5)
+	for i := 0; i < 100; i++ {
+		d := p.NextInterval(0)
+		assert.True(t, d >= 0 && d <= 2*time.Second)
+	}
+}
+
+type countingPollStrategy struct {
+	calls []int
+}
+
+func (p *countingPollStrategy) NextInterval(n int) time.Duration {
+	p.calls = append(p.calls, n)
+	return time.Millisecond
+}
+
+func TestSQLConnector_SetPollStrategy(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	p := &countingPollStrategy{}
+	c.connector.SetPollStrategy(p)
+	h, err := c.StartQuery(context.Background(), "11111111-1111-1111-1111-111111111111", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, h.Wait(context.Background()))
+	assert.Equal(t, []int{0}, p.calls)
+
+	c.connector.SetPollStrategy(nil)
+	h, err = c.StartQuery(context.Background(), "00000000-0000-0000-0000-000000000000", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, c.connector.config.GetPollStrategy(), h.(*queryHandle).poll)
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"go.uber.org/zap"
+)
+
+// QueryHandle is a handle of a query submitted to Athena asynchronously.
+// It is returned by StartQuery and lets the caller poll, wait for and fetch
+// the result of the query as separate steps, without holding a goroutine or
+// a pooled connection while Athena is running the query.
+type QueryHandle interface {
+	// QueryID returns the Athena query execution ID.
+	QueryID() string
+
+	// Status returns the current state of the query execution, which is one of
+	// QUEUED, RUNNING, SUCCEEDED, FAILED or CANCELLED.
+	Status(ctx context.Context) (string, error)
+
+	// Wait blocks until the query execution is finished or ctx is done.
+	// Unlike QueryContext, the query keeps running in Athena when ctx is done.
+	Wait(ctx context.Context) error
+
+	// Rows waits for the query execution to finish and returns its result set.
+	Rows(ctx context.Context) (driver.Rows, error)
+
+	// Cancel stops the query execution.
+	Cancel(ctx context.Context) error
+}
+
+// queryHandle implements QueryHandle.
+type queryHandle struct {
+	athenaAPI athenaiface.AthenaAPI
+	s3Reader  S3Reader
+	config    *Config
+	tracer    *DriverTracer
+	poll      PollStrategy
+	queryID   string
+	workgroup string
+	query     string
+	submitted time.Time
+	execution *athena.QueryExecution
+	done      bool
+	attached  bool
+
+	// unloadLocation is where UNLOAD writes the result of the query, if it is run with UNLOAD.
+	unloadLocation string
+	// clientRequestToken is the ClientRequestToken the query is submitted with, and stableToken is set if it is
+	// the same when the submission is retried.
+	clientRequestToken string
+	stableToken        bool
+	// rerunUnload runs the query again with UNLOAD to a new location. It is set if the query is submitted with a
+	// ClientRequestToken from the context, because submitting it again returns the same query execution, whose
+	// files are removed once they are read.
+	rerunUnload func(ctx context.Context) (*Rows, error)
+}
+
+// attachQueryHandle is to create a handle for a query which was submitted before, e.g. by a previous
+// run of a worker. The handle waits on the query the same way as on a newly submitted one.
+func attachQueryHandle(athenaAPI athenaiface.AthenaAPI, config *Config, tracer *DriverTracer, poll PollStrategy,
+	queryID string, workgroup string) *queryHandle {
+	h := newQueryHandle(athenaAPI, config, tracer, poll, queryID, workgroup, queryID, time.Now())
+	h.attached = true
+	return h
+}
+
+func newQueryHandle(athenaAPI athenaiface.AthenaAPI, config *Config, tracer *DriverTracer, poll PollStrategy,
+	queryID string, workgroup string, query string, submitted time.Time) *queryHandle {
+	if poll == nil {
+		poll = config.GetPollStrategy()
+	}
+	return &queryHandle{
+		athenaAPI: athenaAPI,
+		config:    config,
+		tracer:    tracer,
+		poll:      poll,
+		queryID:   queryID,
+		workgroup: workgroup,
+		query:     query,
+		submitted: submitted,
+	}
+}
+
+// QueryID returns the Athena query execution ID.
+func (h *queryHandle) QueryID() string {
+	return h.queryID
+}
+
+// Status returns the current state of the query execution.
+func (h *queryHandle) Status(ctx context.Context) (string, error) {
+	statusResp, err := h.getQueryExecution(ctx)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(statusResp.QueryExecution.Status.State), nil
+}
+
+// Wait blocks until the query execution is finished or ctx is done.
+func (h *queryHandle) Wait(ctx context.Context) error {
+	return h.wait(ctx, false)
+}
+
+// Rows waits for the query execution to finish and returns its result set.
+func (h *queryHandle) Rows(ctx context.Context) (driver.Rows, error) {
+	if !h.done {
+		if err := h.wait(ctx, false); err != nil {
+			return nil, err
+		}
+	}
+	return h.newRows(ctx)
+}
+
+// newRows is to fetch the result set of the finished query execution.
+func (h *queryHandle) newRows(ctx context.Context) (*Rows, error) {
+	if store, ok := h.s3Reader.(S3Store); ok && h.unloadLocation != "" && h.execution != nil {
+		rows, err := newUnloadRows(ctx, h.athenaAPI, store, h.unloadLocation, h.execution, h.config, h.tracer)
+		if err == nil && len(rows.unload.keys) == 0 && h.rerunUnload != nil {
+			// The result may be empty, or read and removed before. Only running the query again tells them apart.
+			h.tracer.Scope().Counter(DriverName + ".unloadrows.rerun").Inc(1)
+			h.tracer.Log(WarnLevel, "UNLOAD result not found, running the query again",
+				zap.String("workgroup", h.workgroup),
+				zap.String("queryID", h.queryID),
+				zap.String("location", h.unloadLocation))
+			return h.rerunUnload(ctx)
+		}
+		return rows, err
+	}
+	if h.s3Reader != nil && h.config.GetResultMode() == ResultModeS3 && isS3ReadableResult(h.execution) {
+		return newS3Rows(ctx, h.athenaAPI, h.s3Reader, h.execution, h.config, h.tracer)
+	}
+	r, err := NewRows(ctx, h.athenaAPI, h.queryID, h.config, h.tracer)
+	if err != nil {
+		return nil, err
+	}
+	r.queryExecution = h.execution
+	return r, nil
+}
+
+// Cancel stops the query execution.
+func (h *queryHandle) Cancel(ctx context.Context) error {
+	_, err := h.athenaAPI.StopQueryExecutionWithContext(ctx, &athena.StopQueryExecutionInput{
+		QueryExecutionId: aws.String(h.queryID),
+	})
+	if err != nil {
+		h.tracer.Log(ErrorLevel, "StopQueryExecution failed",
+			zap.String("workgroup", h.workgroup),
+			zap.String("queryID", h.queryID),
+			zap.String("error", err.Error()))
+		h.tracer.Scope().Counter(DriverName + ".failure.queryhandle.stopqueryexecution").Inc(1)
+		return err
+	}
+	return nil
+}
+
+func (h *queryHandle) getQueryExecution(ctx context.Context) (*athena.GetQueryExecutionOutput, error) {
+	statusResp, err := h.athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String(h.queryID),
+	})
+	if err != nil {
+		h.tracer.Log(ErrorLevel, "GetQueryExecutionWithContext failed",
+			zap.String("workgroup", h.workgroup),
+			zap.String("queryID", h.queryID),
+			zap.String("error", err.Error()))
+		h.tracer.Scope().Counter(DriverName + ".failure.querycontext.getqueryexecutionwithcontext").Inc(1)
+		return nil, err
+	}
+	return statusResp, nil
+}
+
+// wait polls the query execution status until it is finished. When stopOnCancel is true, the query
+// execution is stopped in Athena once ctx is done, which is what QueryContext has to do to honor
+// the context cancellation.
+func (h *queryHandle) wait(ctx context.Context, stopOnCancel bool) error {
+	var obs = h.tracer
+	now := time.Now()
+	for polls := 0; ; polls++ {
+		statusResp, err := h.getQueryExecution(ctx)
+		if err != nil {
+			return err
+		}
+		if h.attached && polls == 0 {
+			// An attached query could be submitted long ago, and its timeout counts from then.
+			if submitted := statusResp.QueryExecution.Status.SubmissionDateTime; submitted != nil {
+				h.submitted = *submitted
+			}
+			if *statusResp.QueryExecution.Status.State == athena.QueryExecutionStateSucceeded {
+				// The result is already there, and reading it again costs nothing.
+				obs.Scope().Counter(DriverName + ".query.attached.finished").Inc(1)
+				if h.config.IsMoneyWise() {
+					printCost(zeroCostQueryExecution(h.queryID))
+				}
+				h.execution = statusResp.QueryExecution
+				h.done = true
+				return nil
+			}
+		}
+		switch *statusResp.QueryExecution.Status.State {
+		case athena.QueryExecutionStateCancelled:
+			timeCanceled := time.Since(now)
+			obs.Log(ErrorLevel, "QueryExecutionStateCancelled",
+				zap.String("workgroup", h.workgroup),
+				zap.String("queryID", h.queryID))
+			obs.Scope().Timer(DriverName + ".query.canceled").Record(timeCanceled)
+			if h.config.IsMoneyWise() {
+				printCost(statusResp)
+			}
+			return &QueryCancelledError{
+				QueryID:   h.queryID,
+				Workgroup: h.workgroup,
+				Region:    h.config.GetRegion(),
+				Reason:    aws.StringValue(statusResp.QueryExecution.Status.StateChangeReason),
+			}
+		case athena.QueryExecutionStateFailed:
+			reason := aws.StringValue(statusResp.QueryExecution.Status.StateChangeReason)
+			timeQueryExecutionStateFailed := time.Since(now)
+			obs.Log(ErrorLevel, "QueryExecutionStateFailed",
+				zap.String("workgroup", h.workgroup),
+				zap.String("queryID", h.queryID),
+				zap.String("reason", reason))
+			obs.Scope().Timer(DriverName + ".query.queryexecutionstatefailed").Record(timeQueryExecutionStateFailed)
+			return newQueryFailedError(h.queryID, h.workgroup, h.config.GetRegion(), statusResp.QueryExecution.Status)
+		case athena.QueryExecutionStateSucceeded:
+			if h.config.IsMoneyWise() {
+				printCost(statusResp)
+			}
+			if isResultReused(statusResp.QueryExecution) {
+				obs.Scope().Counter(DriverName + ".query.resultreused").Inc(1)
+				obs.Log(DebugLevel, "query result reused",
+					zap.String("workgroup", h.workgroup),
+					zap.String("queryID", h.queryID))
+			}
+			h.execution = statusResp.QueryExecution
+			timeQueryExecutionStateSucceeded := time.Since(now)
+			obs.Scope().Timer(DriverName + ".query.queryexecutionstatesucceeded").Record(timeQueryExecutionStateSucceeded)
+			h.done = true
+			return nil
+		// for athena.QueryExecutionStateQueued and athena.QueryExecutionStateRunning
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			if !stopOnCancel {
+				return ctx.Err()
+			}
+			_, err := h.athenaAPI.
+				StopQueryExecutionWithContext(context.Background(), &athena.StopQueryExecutionInput{
+					QueryExecutionId: aws.String(h.queryID),
+				})
+			if err != nil {
+				obs.Log(ErrorLevel, "StopQueryExecution failed",
+					zap.String("workgroup", h.workgroup),
+					zap.String("queryID", h.queryID),
+					zap.String("query", h.query))
+				obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.failed").Inc(1)
+				return err
+			}
+			if h.config.IsMoneyWise() {
+				statusRespFinal, _ := h.athenaAPI.GetQueryExecutionWithContext(context.Background(), &athena.GetQueryExecutionInput{
+					QueryExecutionId: aws.String(h.queryID),
+				})
+				printCost(statusRespFinal)
+			}
+			obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.succeeded").Inc(1)
+			timeStopQueryExecution := time.Since(now)
+			obs.Scope().Timer(DriverName + ".query.StopQueryExecution").Record(timeStopQueryExecution)
+			obs.Log(ErrorLevel, "query canceled", zap.String("queryID", h.queryID))
+			return ctx.Err()
+		case <-time.After(h.poll.NextInterval(polls)):
+			statementType := aws.StringValue(statusResp.QueryExecution.StatementType)
+			if isQueryTimeOut(h.submitted, statementType, h.config.GetServiceLimitOverride()) {
+				obs.Log(ErrorLevel, "Query timeout failure",
+					zap.String("workgroup", h.workgroup),
+					zap.String("queryID", h.queryID),
+					zap.String("query", h.query))
+				obs.Scope().Counter(DriverName + ".failure.querycontext.timeout").Inc(1)
+				if _, err := h.athenaAPI.
+					StopQueryExecutionWithContext(context.Background(), &athena.StopQueryExecutionInput{
+						QueryExecutionId: aws.String(h.queryID),
+					}); err != nil {
+					obs.Log(ErrorLevel, "StopQueryExecution failed",
+						zap.String("workgroup", h.workgroup),
+						zap.String("queryID", h.queryID),
+						zap.String("query", h.query))
+					obs.Scope().Counter(DriverName + ".failure.querycontext.timeout.stopqueryexecution").Inc(1)
+				}
+				return &QueryTimeoutError{
+					QueryID:       h.queryID,
+					Workgroup:     h.workgroup,
+					Region:        h.config.GetRegion(),
+					StatementType: statementType,
+					Elapsed:       time.Since(h.submitted),
+				}
+			}
+			continue
+		}
+	}
+}
+
+var _ QueryHandle = (*queryHandle)(nil)
+
+// newQueryFailedError is to build a QueryFailedError from the status of a failed query execution.
+func newQueryFailedError(queryID string, workgroup string, region string,
+	status *athena.QueryExecutionStatus) *QueryFailedError {
+	e := &QueryFailedError{
+		QueryID:   queryID,
+		Workgroup: workgroup,
+		Region:    region,
+		Reason:    aws.StringValue(status.StateChangeReason),
+	}
+	if athenaError := status.AthenaError; athenaError != nil {
+		e.ErrorCategory = aws.Int64Value(athenaError.ErrorCategory)
+		e.ErrorType = aws.Int64Value(athenaError.ErrorType)
+		e.ErrorMessage = aws.StringValue(athenaError.ErrorMessage)
+		e.Retryable = aws.BoolValue(athenaError.Retryable)
+	}
+	return e
+}
+
+// isResultReused is to check if Athena reused the result of a previous query execution.
+func isResultReused(e *athena.QueryExecution) bool {
+	return e != nil && e.Statistics != nil && e.Statistics.ResultReuseInformation != nil &&
+		aws.BoolValue(e.Statistics.ResultReuseInformation.ReusedPreviousResult)
+}
+
+// zeroCostQueryExecution is to describe a query execution whose result is read again without scanning any data.
+func zeroCostQueryExecution(queryID string) *athena.GetQueryExecutionOutput {
+	dataScanned := int64(0)
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: aws.String(queryID),
+			Statistics: &athena.QueryExecutionStatistics{
+				DataScannedInBytes: &dataScanned,
+			},
+		},
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func createQueryHandleTestConnection() *Connection {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetOutputBucket("s3://fake-query-results-arbitrary-bucket/")
+	return &Connection{
+		athenaAPI: newMockAthenaClient(),
+		connector: &SQLConnector{
+			config: testConf,
+			tracer: NewDefaultObservability(testConf),
+		},
+	}
+}
+
+func TestConnection_StartQuery(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECTQueryContext_OK_QID", h.QueryID())
+
+	state, err := h.Status(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, athena.QueryExecutionStateSucceeded, state)
+
+	assert.Nil(t, h.Wait(context.Background()))
+	rows, err := h.Rows(context.Background())
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, []string{"_col0"}, rows.Columns())
+}
+
+func TestConnection_StartQuery_Args(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_?",
+		[]driver.NamedValue{{Ordinal: 1, Value: "OK"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECTQueryContext_OK_QID", h.QueryID())
+
+	h, err = c.StartQuery(context.Background(), "SELECTQueryContext_?",
+		[]driver.NamedValue{{Ordinal: 1, Value: struct{}{}}})
+	assert.NotNil(t, err)
+	assert.Nil(t, h)
+}
+
+func TestConnection_StartQuery_Failure(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	h, err := c.StartQuery(context.Background(), "StartQueryExecution_nil_error", nil)
+	assert.Equal(t, ErrTestMockGeneric, err)
+	assert.Nil(t, h)
+
+	h, err = c.StartQuery(context.Background(), "SELECTQueryContext_AWS_FAIL", nil)
+	assert.Nil(t, err)
+	err = h.Wait(context.Background())
+	assert.NotNil(t, err)
+	rows, err := h.Rows(context.Background())
+	assert.NotNil(t, err)
+	assert.Nil(t, rows)
+
+	c.connector.config.SetReadOnly(true)
+	h, err = c.StartQuery(context.Background(), "DROP TABLE abc", nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, h)
+}
+
+func TestConnection_StartQuery_Timeout(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	c.connector.config.SetResultPollIntervalSeconds(0)
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_TIMEOUT", nil)
+	assert.Nil(t, err)
+	err = h.Wait(context.Background())
+	var timeoutErr *QueryTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.True(t, errors.Is(err, ErrQueryTimeout))
+	assert.Equal(t, "SELECTQueryContext_TIMEOUT_QID", timeoutErr.QueryID)
+	assert.Equal(t, "primary", timeoutErr.Workgroup)
+	assert.Equal(t, "TIMEOUT_NOW", timeoutErr.StatementType)
+	assert.Contains(t, timeoutErr.ConsoleURL(), "SELECTQueryContext_TIMEOUT_QID")
+	// the query is stopped in Athena too
+	assert.Equal(t, 1, c.athenaAPI.(*mockAthenaClient).stopQueryExecutionCalls["SELECTQueryContext_TIMEOUT_QID"])
+}
+
+func TestConsoleURL(t *testing.T) {
+	assert.Equal(t, "https://us-west-2.console.aws.amazon.com/athena/home?region=us-west-2"+
+		"#/query-editor/history/abc", consoleURL("us-west-2", "abc"))
+	assert.Equal(t, "", consoleURL("", "abc"))
+	assert.Equal(t, "", consoleURL(DummyRegion, "abc"))
+	assert.Equal(t, "", (&QueryCancelledError{Region: "us-west-2"}).ConsoleURL())
+}
+
+func TestConnection_StartQuery_WaitAndCancel(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	h, err := c.StartQuery(context.Background(), "SELECTQueryContext_CANCEL_OK", nil)
+	assert.Nil(t, err)
+
+	state, err := h.Status(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, athena.QueryExecutionStateQueued, state)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, h.Wait(ctx))
+	assert.Nil(t, h.Cancel(context.Background()))
+
+	h, err = c.StartQuery(context.Background(), "SELECTQueryContext_CANCEL_FAIL", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, h.Cancel(context.Background()))
+}
+
+func TestConnection_StartQuery_QID(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	qid := "c89088ab-595d-4ee6-a9ce-73b55aeb8900"
+	h, err := c.StartQuery(context.Background(), qid, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, qid, h.QueryID())
+	state, err := h.Status(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, athena.QueryExecutionStateQueued, state)
+
+	h, err = c.StartQuery(context.Background(), "c89088ab-595d-4ee6-a9ce-73b55aeb8111", nil)
+	assert.Nil(t, err)
+	_, err = h.Status(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestSQLConnector_StartQuery(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetReadOnly(true)
+	h, err := NewSQLConnector(testConf).StartQuery(context.Background(), "DROP TABLE abc", nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, h)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultResubmitPatterns match the failure reasons of the queries which usually succeed when resubmitted:
+// Athena internal errors, S3 throttling, and running out of resources at the current scale factor.
+var DefaultResubmitPatterns = []string{
+	`(?i)internal[ _]error`,
+	`SlowDown`,
+	`(?i)exhausted resources at this scale factor`,
+}
+
+// isResubmittable is to check if a query failed for a transient reason, i.e. Athena marks the failure as
+// retryable, or its reason matches one of patterns.
+func isResubmittable(err error, patterns []*regexp.Regexp) bool {
+	var failedErr *QueryFailedError
+	if !errors.As(err, &failedErr) {
+		return false
+	}
+	if failedErr.Retryable {
+		return true
+	}
+	for _, p := range patterns {
+		if p.MatchString(failedErr.Reason) || p.MatchString(failedErr.ErrorMessage) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitAndResubmit waits for the query of h to finish. If the query fails for a transient reason,
+// it is submitted again, up to the number of times set by Config.SetResubmitMaxAttempts.
+// The handle of the last submission is returned.
+func (c *Connection) waitAndResubmit(ctx context.Context, h *queryHandle, query string, executionParams []*string,
+	wgName string) (*queryHandle, error) {
+	var obs = c.connector.tracer
+	maxAttempts := c.connector.config.GetResubmitMaxAttempts()
+	var patterns []*regexp.Regexp
+	if maxAttempts > 0 {
+		patterns = c.connector.config.GetResubmitPatterns()
+	}
+	for attempt := 0; ; attempt++ {
+		err := h.wait(ctx, true)
+		if err == nil || attempt >= maxAttempts || !isResubmittable(err, patterns) {
+			return h, err
+		}
+		delay := backoffInterval(c.connector.config.GetResubmitDelay(), 0, 2, 0, attempt)
+		select {
+		case <-ctx.Done():
+			return h, err
+		case <-time.After(delay):
+		}
+		resubmitCtx := ctx
+		if h.stableToken {
+			// the resubmitted query is a new query, which needs a token of its own
+			resubmitCtx = WithClientRequestToken(ctx,
+				ClientRequestTokenOf(h.clientRequestToken, "resubmit", strconv.Itoa(attempt+1)))
+		}
+		newH, startErr := c.startQueryExecution(resubmitCtx, query, executionParams, wgName)
+		if startErr != nil {
+			obs.Log(ErrorLevel, "query resubmission failed",
+				zap.String("workgroup", wgName),
+				zap.String("queryID", h.queryID),
+				zap.String("error", startErr.Error()))
+			return h, err
+		}
+		obs.Scope().Counter(DriverName + ".query.resubmit").Inc(1)
+		obs.Log(WarnLevel, "query resubmitted",
+			zap.String("workgroup", wgName),
+			zap.String("queryID", h.queryID),
+			zap.String("newQueryID", newH.queryID),
+			zap.Int("attempt", attempt+1),
+			zap.String("reason", err.Error()))
+		h = newH
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func createResubmitTestConnection(maxAttempts int) (*Connection, *mockAthenaClient, *observer.ObservedLogs) {
+	c := createQueryHandleTestConnection()
+	c.connector.config.SetResultPollIntervalSeconds(0)
+	c.connector.config.SetResubmitMaxAttempts(maxAttempts)
+	c.connector.config.SetResubmitDelay(0)
+	c.connector.config.SetLogging(true)
+	core, logs := observer.New(zap.WarnLevel)
+	c.connector.tracer = NewObservability(c.connector.config, zap.New(core), tally.NoopScope)
+	return c, c.athenaAPI.(*mockAthenaClient), logs
+}
+
+func TestConnection_QueryContext_Resubmit(t *testing.T) {
+	c, m, logs := createResubmitTestConnection(1)
+	rows, err := c.QueryContext(context.Background(), "RESUBMIT_RETRYABLE", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, 2, m.startQueryExecutionCalls["RESUBMIT_RETRYABLE"])
+	entries := logs.FilterMessage("query resubmitted").All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "44444444-4444-4444-4444-444444444444", entries[0].ContextMap()["queryID"])
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", entries[0].ContextMap()["newQueryID"])
+}
+
+func TestConnection_QueryContext_ResubmitPattern(t *testing.T) {
+	c, m, _ := createResubmitTestConnection(1)
+	rows, err := c.QueryContext(context.Background(), "RESUBMIT_PATTERN", []driver.NamedValue{})
+	var failedErr *QueryFailedError
+	assert.True(t, errors.As(err, &failedErr))
+	assert.Equal(t, "55555555-5555-5555-5555-555555555555", failedErr.QueryID)
+	assert.Nil(t, rows)
+	assert.Equal(t, 2, m.startQueryExecutionCalls["RESUBMIT_PATTERN"])
+
+	c, m, _ = createResubmitTestConnection(2)
+	rows, err = c.QueryContext(context.Background(), "RESUBMIT_PATTERN", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Equal(t, 3, m.startQueryExecutionCalls["RESUBMIT_PATTERN"])
+
+	c, m, _ = createResubmitTestConnection(2)
+	assert.Nil(t, c.connector.config.SetResubmitPatterns([]string{"INTERNAL"}))
+	_, err = c.QueryContext(context.Background(), "RESUBMIT_PATTERN", []driver.NamedValue{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, m.startQueryExecutionCalls["RESUBMIT_PATTERN"])
+}
+
+func TestConnection_QueryContext_NoResubmit(t *testing.T) {
+	c, m, _ := createResubmitTestConnection(0)
+	_, err := c.QueryContext(context.Background(), "RESUBMIT_RETRYABLE", []driver.NamedValue{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, m.startQueryExecutionCalls["RESUBMIT_RETRYABLE"])
+
+	c, m, _ = createResubmitTestConnection(3)
+	_, err = c.QueryContext(context.Background(), "RESUBMIT_NEVER", []driver.NamedValue{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, m.startQueryExecutionCalls["RESUBMIT_NEVER"])
+}
+
+func TestIsResubmittable(t *testing.T) {
+	patterns := []*regexp.Regexp{regexp.MustCompile("SlowDown")}
+	assert.True(t, isResubmittable(&QueryFailedError{Retryable: true}, nil))
+	assert.True(t, isResubmittable(&QueryFailedError{Reason: "Error Code: SlowDown"}, patterns))
+	assert.True(t, isResubmittable(&QueryFailedError{ErrorMessage: "Error Code: SlowDown"}, patterns))
+	assert.False(t, isResubmittable(&QueryFailedError{Reason: "SYNTAX_ERROR"}, patterns))
+	assert.False(t, isResubmittable(&QueryCancelledError{Reason: "SlowDown"}, patterns))
+	assert.False(t, isResubmittable(ErrQueryTimeout, patterns))
+}
+
+func TestConnection_QueryContext_ResubmitClientRequestToken(t *testing.T) {
+	c, m, _ := createResubmitTestConnection(1)
+	token := ClientRequestTokenOf("job-1", "step-2")
+	_, err := c.QueryContext(WithClientRequestToken(context.Background(), token), "RESUBMIT_RETRYABLE",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	// the resubmission is a new query with a token of its own, which is derived from the first one
+	assert.Equal(t, []string{token, ClientRequestTokenOf(token, "resubmit", "1")}, m.clientRequestTokens)
+
+	// the same for a token derived from the job step
+	c, m, _ = createResubmitTestConnection(1)
+	_, err = c.QueryContext(WithJobStep(context.Background(), "job-1/step-3"), "RESUBMIT_RETRYABLE",
+		[]driver.NamedValue{})
+	assert.Nil(t, err)
+	if assert.Len(t, m.clientRequestTokens, 2) {
+		assert.Equal(t, ClientRequestTokenOf(m.clientRequestTokens[0], "resubmit", "1"), m.clientRequestTokens[1])
+	}
+}
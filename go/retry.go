@@ -0,0 +1,240 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"go.uber.org/zap"
+)
+
+// retryAthenaClient wraps the Athena API calls made by the driver, and retries them with exponential backoff
+// and jitter when they are throttled by Athena, or for StartQueryExecution, when they fail for transient reasons.
+// Calls not made by the driver go to the wrapped client as is.
+type retryAthenaClient struct {
+	athenaiface.AthenaAPI
+	config *Config
+	tracer *DriverTracer
+}
+
+// newRetryAthenaClient is to wrap athenaAPI with retries. athenaAPI is returned as is if retries are disabled.
+func newRetryAthenaClient(athenaAPI athenaiface.AthenaAPI, config *Config, tracer *DriverTracer) athenaiface.AthenaAPI {
+	if config.GetAPIRetryBudget() <= 0 {
+		return athenaAPI
+	}
+	return &retryAthenaClient{
+		AthenaAPI: athenaAPI,
+		config:    config,
+		tracer:    tracer,
+	}
+}
+
+// isThrottlingError is to check if err means the request was rejected by Athena for its rate,
+// i.e. it is safe to send it again.
+func isThrottlingError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		if aerr.Code() == athena.ErrCodeTooManyRequestsException || aerr.Code() == "ThrottlingException" {
+			return true
+		}
+	}
+	return request.IsErrorThrottle(err)
+}
+
+// isRetryableSubmission is to check if a StartQueryExecution with a ClientRequestToken can be sent again after err.
+// Besides throttling, this is the case for errors where the request may or may not have reached Athena, like
+// timeouts, dropped connections and server errors, since Athena doesn't start a query twice for the same token.
+func isRetryableSubmission(err error) bool {
+	if isThrottlingError(err) {
+		return true
+	}
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		// not from the AWS SDK, so the request was not sent
+		return false
+	}
+	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() >= 500 {
+		return true
+	}
+	return aerr.Code() == athena.ErrCodeInternalServerException || request.IsErrorRetryable(aerr)
+}
+
+// retry is to call f until it succeeds, fails with an error which is not retryable, or the retry budget runs out.
+func (r *retryAthenaClient) retry(ctx context.Context, op string, retryable func(error) bool, f func() error) error {
+	budget := r.config.GetAPIRetryBudget()
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= budget || !retryable(err) {
+			return err
+		}
+		delay := backoffInterval(r.config.GetAPIRetryBaseDelay(), r.config.GetAPIRetryMaxDelay(), 2, 0.5, attempt)
+		r.tracer.Scope().Counter(DriverName + ".retry." + op).Inc(1)
+		r.tracer.Log(WarnLevel, "Athena API call failed, retrying",
+			zap.String("operation", op),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.String("error", err.Error()))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isIdempotencyMismatchError is to check if err means the ClientRequestToken of a StartQueryExecution was used
+// before with different parameters, like another query string.
+func isIdempotencyMismatchError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case "IdempotentParameterMismatch", "IdempotentParameterMismatchException":
+		return true
+	case athena.ErrCodeInvalidRequestException:
+		return strings.Contains(strings.ToLower(aerr.Message()), "idempoten")
+	}
+	return false
+}
+
+// newClientRequestToken is to create a random idempotency token for StartQueryExecution.
+func newClientRequestToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// StartQueryExecutionWithContext sends the same ClientRequestToken in every retry, so Athena never starts the query
+// twice even if a failed request was accepted after all. Thanks to the token, it is retried on transient errors too.
+func (r *retryAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, input *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	if input.ClientRequestToken == nil {
+		token, err := newClientRequestToken()
+		if err != nil {
+			return nil, err
+		}
+		input.ClientRequestToken = aws.String(token)
+	}
+	var output *athena.StartQueryExecutionOutput
+	err := r.retry(ctx, "startqueryexecution", isRetryableSubmission, func() error {
+		var err error
+		output, err = r.AthenaAPI.StartQueryExecutionWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// GetQueryExecutionWithContext retries a throttled GetQueryExecutionWithContext.
+func (r *retryAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	var output *athena.GetQueryExecutionOutput
+	err := r.retry(ctx, "getqueryexecution", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.GetQueryExecutionWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// GetQueryResultsWithContext retries a throttled GetQueryResultsWithContext.
+func (r *retryAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	opts ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	var output *athena.GetQueryResultsOutput
+	err := r.retry(ctx, "getqueryresults", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.GetQueryResultsWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// GetWorkGroupWithContext retries a throttled GetWorkGroupWithContext.
+func (r *retryAthenaClient) GetWorkGroupWithContext(ctx aws.Context, input *athena.GetWorkGroupInput,
+	opts ...request.Option) (*athena.GetWorkGroupOutput, error) {
+	var output *athena.GetWorkGroupOutput
+	err := r.retry(ctx, "getworkgroup", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.GetWorkGroupWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// CreateWorkGroup retries a throttled CreateWorkGroup. A workgroup which was created by a throttled
+// request after all fails the retry with InvalidRequestException, same as a workgroup created by anyone else.
+func (r *retryAthenaClient) CreateWorkGroup(input *athena.CreateWorkGroupInput) (*athena.CreateWorkGroupOutput,
+	error) {
+	var output *athena.CreateWorkGroupOutput
+	err := r.retry(context.Background(), "createworkgroup", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.CreateWorkGroup(input)
+		return err
+	})
+	return output, err
+}
+
+// CreatePreparedStatementWithContext retries a throttled CreatePreparedStatementWithContext. A prepared statement
+// which was created by a throttled request after all fails the retry with InvalidRequestException.
+func (r *retryAthenaClient) CreatePreparedStatementWithContext(ctx aws.Context,
+	input *athena.CreatePreparedStatementInput, opts ...request.Option) (*athena.CreatePreparedStatementOutput, error) {
+	var output *athena.CreatePreparedStatementOutput
+	err := r.retry(ctx, "createpreparedstatement", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.CreatePreparedStatementWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// DeletePreparedStatementWithContext retries a throttled DeletePreparedStatementWithContext.
+func (r *retryAthenaClient) DeletePreparedStatementWithContext(ctx aws.Context,
+	input *athena.DeletePreparedStatementInput, opts ...request.Option) (*athena.DeletePreparedStatementOutput, error) {
+	var output *athena.DeletePreparedStatementOutput
+	err := r.retry(ctx, "deletepreparedstatement", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.DeletePreparedStatementWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// StopQueryExecutionWithContext retries a throttled StopQueryExecutionWithContext.
+func (r *retryAthenaClient) StopQueryExecutionWithContext(ctx aws.Context, input *athena.StopQueryExecutionInput,
+	opts ...request.Option) (*athena.StopQueryExecutionOutput, error) {
+	var output *athena.StopQueryExecutionOutput
+	err := r.retry(ctx, "stopqueryexecution", isThrottlingError, func() error {
+		var err error
+		output, err = r.AthenaAPI.StopQueryExecutionWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// throttlingAthenaClient throttles the first calls to the mock client.
+type throttlingAthenaClient struct {
+	*mockAthenaClient
+	throttles int
+	calls     int
+	tokens    []string
+	// err is returned instead of a throttling error if it is set.
+	err error
+}
+
+func (m *throttlingAthenaClient) throttle() error {
+	m.calls++
+	if m.calls <= m.throttles {
+		if m.err != nil {
+			return m.err
+		}
+		return awserr.New(athena.ErrCodeTooManyRequestsException, "Rate exceeded", nil)
+	}
+	return nil
+}
+
+func (m *throttlingAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	m.tokens = append(m.tokens, aws.StringValue(s.ClientRequestToken))
+	if err := m.throttle(); err != nil {
+		return nil, err
+	}
+	return m.mockAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+}
+
+func (m *throttlingAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if err := m.throttle(); err != nil {
+		return nil, err
+	}
+	return m.mockAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+}
+
+func (m *throttlingAthenaClient) CreatePreparedStatementWithContext(ctx aws.Context,
+	input *athena.CreatePreparedStatementInput, opts ...request.Option) (*athena.CreatePreparedStatementOutput, error) {
+	if err := m.throttle(); err != nil {
+		return nil, err
+	}
+	return m.mockAthenaClient.CreatePreparedStatementWithContext(ctx, input, opts...)
+}
+
+func (m *throttlingAthenaClient) DeletePreparedStatementWithContext(ctx aws.Context,
+	input *athena.DeletePreparedStatementInput, opts ...request.Option) (*athena.DeletePreparedStatementOutput, error) {
+	if err := m.throttle(); err != nil {
+		return nil, err
+	}
+	return m.mockAthenaClient.DeletePreparedStatementWithContext(ctx, input, opts...)
+}
+
+func newRetryTestClient(throttles int, budget int) (*throttlingAthenaClient, *retryAthenaClient, tally.TestScope) {
+	config := NewNoOpsConfig()
+	config.SetMetrics(true)
+	config.SetAPIRetryBudget(budget)
+	config.SetAPIRetryBaseDelay(time.Millisecond)
+	config.SetAPIRetryMaxDelay(time.Millisecond)
+	scope := tally.NewTestScope("", nil)
+	m := &throttlingAthenaClient{mockAthenaClient: newMockAthenaClient(), throttles: throttles}
+	r := newRetryAthenaClient(m, config, NewObservability(config, zap.NewNop(), scope))
+	return m, r.(*retryAthenaClient), scope
+}
+
+func TestNewRetryAthenaClient_Disabled(t *testing.T) {
+	m := newMockAthenaClient()
+	assert.Equal(t, m, newRetryAthenaClient(m, NewNoOpsConfig(), NewDefaultObservability(NewNoOpsConfig())))
+}
+
+func TestRetryAthenaClient_StartQueryExecution(t *testing.T) {
+	m, r, scope := newRetryTestClient(2, 3)
+	resp, err := r.StartQueryExecutionWithContext(context.Background(),
+		&athena.StartQueryExecutionInput{QueryString: aws.String("select 1")})
+	assert.Nil(t, err)
+	assert.Equal(t, "PING_OK_QID", *resp.QueryExecutionId)
+	assert.Equal(t, 3, m.calls)
+	// every retry sends the same idempotency token
+	assert.Len(t, m.tokens[0], 32)
+	assert.Equal(t, []string{m.tokens[0], m.tokens[0], m.tokens[0]}, m.tokens)
+	assert.Equal(t, int64(2), scope.Snapshot().Counters()[DriverName+".retry.startqueryexecution+"].Value())
+
+	token := "my-own-token-which-is-32-chars-at-least"
+	m, r, _ = newRetryTestClient(1, 3)
+	_, err = r.StartQueryExecutionWithContext(context.Background(), &athena.StartQueryExecutionInput{
+		QueryString:        aws.String("select 1"),
+		ClientRequestToken: aws.String(token),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{token, token}, m.tokens)
+
+	// the retry gives up when the ctx of the query is done
+	m, r, _ = newRetryTestClient(5, 3)
+	r.config.SetAPIRetryBaseDelay(time.Hour)
+	r.config.SetAPIRetryMaxDelay(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.StartQueryExecutionWithContext(ctx, &athena.StartQueryExecutionInput{QueryString: aws.String("select 1")})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, m.calls)
+}
+
+func TestRetryAthenaClient_BudgetExhausted(t *testing.T) {
+	m, r, _ := newRetryTestClient(5, 2)
+	_, err := r.StartQueryExecutionWithContext(context.Background(),
+		&athena.StartQueryExecutionInput{QueryString: aws.String("select 1")})
+	assert.NotNil(t, err)
+	assert.Equal(t, athena.ErrCodeTooManyRequestsException, err.(awserr.Error).Code())
+	assert.Equal(t, 3, m.calls)
+}
+
+func TestRetryAthenaClient_NonThrottlingError(t *testing.T) {
+	_, r, scope := newRetryTestClient(0, 3)
+	_, err := r.StartQueryExecutionWithContext(context.Background(),
+		&athena.StartQueryExecutionInput{QueryString: aws.String("StartQueryExecution_nil_error")})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(scope.Snapshot().Counters()))
+}
+
+func TestRetryAthenaClient_GetQueryExecutionWithContext(t *testing.T) {
+	m, r, scope := newRetryTestClient(1, 3)
+	resp, err := r.GetQueryExecutionWithContext(context.Background(), &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String("00000000-0000-0000-0000-000000000000"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, athena.QueryExecutionStateSucceeded, *resp.QueryExecution.Status.State)
+	assert.Equal(t, 2, m.calls)
+	assert.Equal(t, int64(1), scope.Snapshot().Counters()[DriverName+".retry.getqueryexecution+"].Value())
+
+	// the retry gives up when ctx is done
+	m, r, _ = newRetryTestClient(5, 3)
+	r.config.SetAPIRetryBaseDelay(time.Hour)
+	r.config.SetAPIRetryMaxDelay(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String("00000000-0000-0000-0000-000000000000"),
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, m.calls)
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	assert.True(t, isThrottlingError(awserr.New(athena.ErrCodeTooManyRequestsException, "", nil)))
+	assert.True(t, isThrottlingError(awserr.New("ThrottlingException", "", nil)))
+	assert.False(t, isThrottlingError(awserr.New(athena.ErrCodeInvalidRequestException, "", nil)))
+	assert.False(t, isThrottlingError(ErrTestMockGeneric))
+}
+
+func TestIsRetryableSubmission(t *testing.T) {
+	assert.True(t, isRetryableSubmission(awserr.New(athena.ErrCodeTooManyRequestsException, "Rate exceeded", nil)))
+	assert.True(t, isRetryableSubmission(awserr.New(athena.ErrCodeInternalServerException, "oops", nil)))
+	assert.True(t, isRetryableSubmission(awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "", nil), 503, "")))
+	assert.True(t, isRetryableSubmission(awserr.New(request.ErrCodeRequestError, "send request failed",
+		errors.New("connection reset by peer"))))
+	assert.False(t, isRetryableSubmission(awserr.NewRequestFailure(
+		awserr.New(athena.ErrCodeInvalidRequestException, "bad query", nil), 400, "")))
+	assert.False(t, isRetryableSubmission(errors.New("not from AWS")))
+}
+
+func TestIsIdempotencyMismatchError(t *testing.T) {
+	assert.True(t, isIdempotencyMismatchError(awserr.New(athena.ErrCodeInvalidRequestException,
+		"Idempotent parameters do not match", nil)))
+	assert.True(t, isIdempotencyMismatchError(awserr.New("IdempotentParameterMismatch", "", nil)))
+	assert.False(t, isIdempotencyMismatchError(awserr.New(athena.ErrCodeInvalidRequestException, "bad query", nil)))
+	assert.False(t, isIdempotencyMismatchError(errors.New("Idempotent parameters do not match")))
+}
+
+func TestRetryAthenaClient_StartQueryExecution_ServerError(t *testing.T) {
+	m, r, _ := newRetryTestClient(2, 3)
+	m.err = awserr.NewRequestFailure(awserr.New(athena.ErrCodeInternalServerException, "oops", nil), 500, "")
+	_, err := r.StartQueryExecutionWithContext(context.Background(),
+		&athena.StartQueryExecutionInput{QueryString: aws.String("select 1")})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, m.calls)
+	assert.Equal(t, []string{m.tokens[0], m.tokens[0], m.tokens[0]}, m.tokens)
+
+	// other calls are only retried when they are throttled
+	m, r, _ = newRetryTestClient(1, 3)
+	m.err = awserr.NewRequestFailure(awserr.New(athena.ErrCodeInternalServerException, "oops", nil), 500, "")
+	_, err = r.GetQueryExecutionWithContext(context.Background(), &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String("00000000-0000-0000-0000-000000000000"),
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, m.calls)
+}
+
+func TestRetryAthenaClient_PreparedStatement(t *testing.T) {
+	m, r, scope := newRetryTestClient(1, 3)
+	_, err := r.CreatePreparedStatementWithContext(context.Background(), &athena.CreatePreparedStatementInput{
+		StatementName:  aws.String("stmt"),
+		QueryStatement: aws.String("SELECT ?"),
+		WorkGroup:      aws.String("primary"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.calls)
+	assert.Equal(t, int64(1), scope.Snapshot().Counters()[DriverName+".retry.createpreparedstatement+"].Value())
+
+	// the statement created above is deleted after one throttled call too
+	m.calls, m.throttles = 0, 1
+	_, err = r.DeletePreparedStatementWithContext(context.Background(), &athena.DeletePreparedStatementInput{
+		StatementName: aws.String("stmt"),
+		WorkGroup:     aws.String("primary"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.calls)
+	assert.Equal(t, int64(1), scope.Snapshot().Counters()[DriverName+".retry.deletepreparedstatement+"].Value())
+	assert.Empty(t, m.preparedStatements)
+}
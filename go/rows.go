@@ -25,6 +25,8 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"io"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +49,19 @@ type Rows struct {
 	config          *Config
 	tracer          *DriverTracer
 	pageCount       int64
+	queryExecution  *athena.QueryExecution
+	csv             *resultCSVReader
+	csvBody         io.Closer
+	unload          *unloadResult
+	nativeTypes     bool
+	prefetched      chan prefetchedPage
+	stopPrefetch    func()
+}
+
+// prefetchedPage is a result page fetched in the background, or the error fetching it.
+type prefetchedPage struct {
+	output *athena.GetQueryResultsOutput
+	err    error
 }
 
 // NewNonOpsRows is to create a new Rows.
@@ -77,9 +92,32 @@ func NewRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID strin
 	if err := r.fetchNextPage(nil); err != nil {
 		return nil, err
 	}
+	if depth := driverConfig.GetResultPrefetchDepth(); depth > 0 && !r.reachedLastPage {
+		r.startPrefetch(r.ResultOutput.NextToken, depth)
+	}
 	return &r, nil
 }
 
+// QueryID returns the ID of the query execution of the result set.
+func (r *Rows) QueryID() string {
+	return r.queryID
+}
+
+// ReusedPreviousResult reports whether Athena reused the result of a previous run of the query,
+// instead of running the query again.
+func (r *Rows) ReusedPreviousResult() bool {
+	return isResultReused(r.queryExecution)
+}
+
+// QueryExecutionStatistics returns the statistics of the query execution, e.g. the data scanned and the time
+// spent in every stage. It is nil if the query execution was not checked by the driver.
+func (r *Rows) QueryExecutionStatistics() *athena.QueryExecutionStatistics {
+	if r.queryExecution == nil {
+		return nil
+	}
+	return r.queryExecution.Statistics
+}
+
 // Columns return Columns metadata.
 func (r *Rows) Columns() []string {
 	var columns []string
@@ -100,11 +138,90 @@ func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
 	return ""
 }
 
+// ColumnTypeScanType returns the Go type of the values of a column, which is what athenaTypeToGoType returns.
+// The values of a masked column are always strings.
+func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
+	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
+	if _, masked := r.config.CheckColumnMasked(aws.StringValue(colInfo.Name)); masked {
+		return scanTypeString
+	}
+	return r.scanType(athenaTypeName(aws.StringValue(colInfo.Type)))
+}
+
+// scanType returns the Go type of the values of an Athena type, in the modes of r.
+func (r *Rows) scanType(athenaType string) reflect.Type {
+	if t := r.complexScanType(athenaType); t != nil {
+		return t
+	}
+	if r.nativeTypes && athenaType == "varbinary" {
+		// the Parquet files written by UNLOAD keep varbinary values as bytes.
+		return scanTypeBytes
+	}
+	return athenaTypeToScanType(athenaType)
+}
+
+// complexScanType returns the Go type of decoded ARRAY, MAP and ROW values, or nil if they aren't decoded.
+func (r *Rows) complexScanType(athenaType string) reflect.Type {
+	if !r.config.IsDecodeComplexTypes() {
+		return nil
+	}
+	switch athenaType {
+	case "array":
+		return scanTypeArray
+	case "map":
+		return scanTypeMap
+	case "row", "struct":
+		return scanTypeRow
+	}
+	return nil
+}
+
+// ColumnTypeNullable reports whether a column may be null, as Athena knows it.
+func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
+	switch aws.StringValue(colInfo.Nullable) {
+	case athena.ColumnNullableNotNull:
+		return false, true
+	case athena.ColumnNullableNullable:
+		return true, true
+	}
+	return false, false
+}
+
+// ColumnTypeLength returns the length of a column of a variable length type, e.g. n of varchar(n).
+// It is math.MaxInt64 if the length is unbounded.
+func (r *Rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
+	switch athenaTypeName(aws.StringValue(colInfo.Type)) {
+	case "char", "varchar", "string", "varbinary", "binary", "json":
+		if colInfo.Precision == nil || *colInfo.Precision <= 0 {
+			return math.MaxInt64, true
+		}
+		return *colInfo.Precision, true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale returns the precision and the scale of a decimal column.
+func (r *Rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
+	if athenaTypeName(aws.StringValue(colInfo.Type)) != "decimal" || colInfo.Precision == nil {
+		return 0, 0, false
+	}
+	return *colInfo.Precision, aws.Int64Value(colInfo.Scale), true
+}
+
 // Next is to get next result set page.
 func (r *Rows) Next(dest []driver.Value) error {
 	if r.reachedLastPage {
 		return io.EOF
 	}
+	if r.csv != nil {
+		return r.nextS3Row(dest)
+	}
+	if r.unload != nil {
+		return r.nextUnloadRow(dest)
+	}
 	if len(r.ResultOutput.ResultSet.Rows) == 0 {
 		if r.ResultOutput.NextToken == nil || *r.ResultOutput.NextToken == "" {
 			// this means we reach the last page - no token and no rows
@@ -133,11 +250,11 @@ func (r *Rows) Next(dest []driver.Value) error {
 // fetchNextPage is to get next result set page with a specific token.
 func (r *Rows) fetchNextPage(token *string) error {
 	var err error
-	r.ResultOutput, err = r.athena.GetQueryResultsWithContext(r.ctx,
-		&athena.GetQueryResultsInput{
-			QueryExecutionId: aws.String(r.queryID),
-			NextToken:        token,
-		})
+	if r.prefetched != nil && token != nil {
+		r.ResultOutput, err = r.nextPrefetchedPage()
+	} else {
+		r.ResultOutput, err = r.getQueryResults(r.ctx, token)
+	}
 	if err != nil {
 		r.tracer.Scope().Counter(DriverName + ".failure.fetchnextpage.getqueryresults").Inc(1)
 		r.tracer.Log(ErrorLevel, "GetQueryResults failed", zap.String("error", err.Error()))
@@ -215,22 +332,97 @@ func (r *Rows) fetchNextPage(token *string) error {
 		}
 	}
 
-	// if there is no new row, we should not continue, and this also filters out cases that Rows is nil
+	// if there is no new row, we should not continue, and this also filters out cases that Rows is nil.
+	// A small page size can make the first page hold only the header, though, so keep going if there are more pages.
 	if len(r.ResultOutput.ResultSet.Rows) <= rowOffset {
-		r.reachedLastPage = true
-		return nil
+		if rowOffset == 0 || r.ResultOutput.NextToken == nil || *r.ResultOutput.NextToken == "" {
+			r.reachedLastPage = true
+			return nil
+		}
 	}
 
 	r.ResultOutput.ResultSet.Rows = r.ResultOutput.ResultSet.Rows[rowOffset:]
 	return nil
 }
 
+// getQueryResults is to get the result set page with a specific token.
+func (r *Rows) getQueryResults(ctx context.Context, token *string) (*athena.GetQueryResultsOutput, error) {
+	input := &athena.GetQueryResultsInput{
+		QueryExecutionId: aws.String(r.queryID),
+		NextToken:        token,
+	}
+	if n := r.config.GetResultPageSize(); n > 0 {
+		input.MaxResults = aws.Int64(int64(n))
+	}
+	return r.athena.GetQueryResultsWithContext(ctx, input)
+}
+
+// startPrefetch starts a goroutine fetching the pages from token on, at most depth pages ahead of Next.
+// The pages and the error ending the fetching are delivered in order through r.prefetched.
+func (r *Rows) startPrefetch(token *string, depth int) {
+	if token == nil || *token == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	// The goroutine holds one more page while it is blocked on sending.
+	pages := make(chan prefetchedPage, depth-1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(pages)
+		for token != nil && *token != "" {
+			output, err := r.getQueryResults(ctx, token)
+			select {
+			case pages <- prefetchedPage{output: output, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+			token = output.NextToken
+		}
+	}()
+	r.prefetched = pages
+	r.stopPrefetch = func() {
+		cancel()
+		<-done
+	}
+	r.tracer.Scope().Counter(DriverName + ".rows.prefetch").Inc(1)
+}
+
+// nextPrefetchedPage is to get the next page fetched by the prefetching goroutine.
+func (r *Rows) nextPrefetchedPage() (*athena.GetQueryResultsOutput, error) {
+	page, ok := <-r.prefetched
+	if !ok {
+		// the goroutine stops without a page only when the context is done.
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	return page.output, page.err
+}
+
 // Close is to close Rows after reading all data.
 func (r *Rows) Close() error {
 	if r.ResultOutput != nil && r.ResultOutput.NextToken != nil {
 		r.tracer.Log(WarnLevel, "rows close prematurely, queryID: "+r.queryID)
 		r.ResultOutput = nil
 	}
+	if r.csvBody != nil {
+		if !r.reachedLastPage {
+			r.tracer.Log(WarnLevel, "rows close prematurely, queryID: "+r.queryID)
+		}
+		_ = r.csvBody.Close()
+	}
+	if r.unload != nil {
+		r.closeUnload()
+	}
+	if r.stopPrefetch != nil {
+		r.stopPrefetch()
+		r.stopPrefetch = nil
+	}
 	r.reachedLastPage = true
 	return nil
 }
@@ -242,7 +434,7 @@ func (r *Rows) convertRow(columns []*athena.ColumnInfo, rdata []*athena.Datum, r
 		if val == nil {
 			return ErrAthenaNilDatum
 		}
-		value, err := r.athenaTypeToGoType(columns[i], val.VarCharValue, driverConfig)
+		value, err := r.columnValue(columns[i], val.VarCharValue, driverConfig)
 		if err != nil {
 			r.tracer.Log(ErrorLevel, "convertrow failed", zap.String("error", err.Error()))
 			r.tracer.Scope().Counter(DriverName + ".failure.convertrow").Inc(1)
@@ -258,6 +450,17 @@ func (r *Rows) convertRow(columns []*athena.ColumnInfo, rdata []*athena.Datum, r
 	return nil
 }
 
+// columnValue is to convert a value of a column with athenaTypeToGoType. A Decimal is not a driver.Value, so it is
+// returned as its string, which *Decimal.Scan parses.
+func (r *Rows) columnValue(columnInfo *athena.ColumnInfo, rawValue *string, driverConfig *Config) (interface{},
+	error) {
+	value, err := r.athenaTypeToGoType(columnInfo, rawValue, driverConfig)
+	if d, ok := value.(Decimal); ok {
+		return d.String(), err
+	}
+	return value, err
+}
+
 // athenaTypeToGoType converts Athena type to Golang SQL type.
 // https://docs.aws.amazon.com/en_pv/athena/latest/ug/data-types.html
 // https://docs.aws.amazon.com/athena/latest/ug/geospatial-input-data-formats-supported-geometry-types.html#geometry-data-types
@@ -295,7 +498,7 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 	var err error
 	var i int64
 	var f float64
-	switch *columnInfo.Type {
+	switch athenaTypeName(*columnInfo.Type) {
 	case "tinyint":
 		// strconv.ParseInt() behavior is to return (int64(0), err)
 		// which is not as good as just return (nil, err)
@@ -330,10 +533,33 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 		return f, nil
 	// for binary, we assume all chars are 0 or 1; for json,
 	// we assume the json syntax is correct. Leave to caller to verify it.
-	case "json", "char", "varchar", "varbinary", "row", "string", "binary",
-		"struct", "interval year to month", "interval day to second", "decimal",
-		"ipaddress", "array", "map", "unknown":
+	case "json", "char", "varchar", "varbinary", "string", "binary",
+		"interval year to month", "interval day to second",
+		"ipaddress", "unknown":
 		return val, nil
+	case "array", "map", "row", "struct":
+		if !driverConfig.IsDecodeComplexTypes() {
+			return val, nil
+		}
+		v, err := r.decodeComplexValue(columnInfo, val, driverConfig)
+		if err != nil {
+			r.tracer.Scope().Counter(DriverName + ".failure.convertvalue.complex").Inc(1)
+			r.tracer.Log(ErrorLevel, "complex data error", zap.String("val", val),
+				zap.String("type", *columnInfo.Type))
+			return nil, err
+		}
+		return v, nil
+	case "decimal":
+		if !driverConfig.IsExactDecimal() {
+			return val, nil
+		}
+		d, err := decimalOfColumn(columnInfo, val)
+		if err != nil {
+			r.tracer.Scope().Counter(DriverName + ".failure.convertvalue.decimal").Inc(1)
+			r.tracer.Log(ErrorLevel, "decimal data error", zap.String("val", val))
+			return nil, err
+		}
+		return d, nil
 	case "boolean":
 		if val == "true" {
 			return true, nil
@@ -361,25 +587,63 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 	}
 }
 
-// getDefaultValueForColumnType is used internally by athenaTypeToGoType to get default value for a column type.
-// This is helpful when column has missing value and we want to display it anyway.
-func (r *Rows) getDefaultValueForColumnType(athenaType string) interface{} {
+var (
+	scanTypeInt8    = reflect.TypeOf(int8(0))
+	scanTypeInt16   = reflect.TypeOf(int16(0))
+	scanTypeInt32   = reflect.TypeOf(int32(0))
+	scanTypeInt64   = reflect.TypeOf(int64(0))
+	scanTypeFloat32 = reflect.TypeOf(float32(0))
+	scanTypeFloat64 = reflect.TypeOf(float64(0))
+	scanTypeBool    = reflect.TypeOf(false)
+	scanTypeString  = reflect.TypeOf("")
+	scanTypeBytes   = reflect.TypeOf([]byte{})
+	scanTypeTime    = reflect.TypeOf(time.Time{})
+	scanTypeArray   = reflect.TypeOf([]interface{}{})
+	scanTypeMap     = reflect.TypeOf(map[string]interface{}{})
+	scanTypeRow     = reflect.TypeOf(RowValue{})
+	scanTypeUnknown = reflect.TypeOf(new(interface{})).Elem()
+)
+
+// athenaTypeToScanType returns the Go type athenaTypeToGoType converts the values of an Athena type to.
+func athenaTypeToScanType(athenaType string) reflect.Type {
 	switch athenaType {
-	case "tinyint", "smallint", "integer", "bigint":
-		return 0
-	case "boolean":
-		return false
-	case "float", "double", "real":
-		return 0.0
-	case "date", "time", "time with time zone", "timestamp", "timestamp with time zone":
-		return time.Time{}
+	case "tinyint":
+		return scanTypeInt8
+	case "smallint":
+		return scanTypeInt16
+	case "integer":
+		return scanTypeInt32
+	case "bigint":
+		return scanTypeInt64
+	case "float", "real":
+		return scanTypeFloat32
+	case "double":
+		return scanTypeFloat64
 	case "json", "char", "varchar", "varbinary", "row", "string", "binary",
 		"struct", "interval year to month", "interval day to second", "decimal",
 		"ipaddress", "array", "map", "unknown":
-		return ""
-	default:
+		return scanTypeString
+	case "boolean":
+		return scanTypeBool
+	case "date", "time", "time with time zone", "timestamp", "timestamp with time zone":
+		return scanTypeTime
+	}
+	return scanTypeUnknown
+}
+
+// getDefaultValueForColumnType is used internally by athenaTypeToGoType to get default value for a column type.
+// This is helpful when column has missing value and we want to display it anyway.
+// The default value is the zero value of the scan type of the column, so it has the same Go type as the other values.
+func (r *Rows) getDefaultValueForColumnType(athenaType string) interface{} {
+	t := r.scanType(athenaTypeName(athenaType))
+	if t == scanTypeString && athenaTypeName(athenaType) == "decimal" && r.config.IsExactDecimal() {
+		// "" can't be scanned into a Decimal
+		return Decimal{}.String()
+	}
+	if t == scanTypeUnknown {
 		r.tracer.Scope().Counter(DriverName + ".failure.defaultvalueforcolumntype.type").Inc(1)
 		r.tracer.Log(ErrorLevel, "column data type error", zap.String("columnInfo.Type", athenaType))
 		return ""
 	}
+	return reflect.Zero(t).Interface()
 }
@@ -24,12 +24,19 @@ import (
 	"context"
 	"database/sql/driver"
 	"io"
+	"math"
 	"reflect"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
 )
 
 // variadicToSlice, https://blog.learngoprogramming.com/golang-variadic-funcs-how-to-patterns-369408f19085
@@ -249,17 +256,18 @@ func TestRows_GetDefaultValueForColumnType(t *testing.T) {
 		r, _ := NewRows(context.Background(), newMockAthenaClient(),
 			test.queryID,
 			testConf, NewDefaultObservability(testConf))
-		for _, v := range []string{"tinyint", "smallint", "integer", "bigint"} {
-			assert.Equal(t, r.getDefaultValueForColumnType(v), 0)
-		}
+		assert.Equal(t, r.getDefaultValueForColumnType("tinyint"), int8(0))
+		assert.Equal(t, r.getDefaultValueForColumnType("smallint"), int16(0))
+		assert.Equal(t, r.getDefaultValueForColumnType("integer"), int32(0))
+		assert.Equal(t, r.getDefaultValueForColumnType("bigint"), int64(0))
 		for _, v := range []string{"json", "char", "varchar", "varbinary", "row", "string", "binary",
 			"struct", "interval year to month", "interval day to second", "decimal",
 			"ipaddress", "array", "map", "unknown"} {
 			assert.Equal(t, r.getDefaultValueForColumnType(v), "")
 		}
-		for _, v := range []string{"float", "double", "real"} {
-			assert.Equal(t, r.getDefaultValueForColumnType(v), 0.0)
-		}
+		assert.Equal(t, r.getDefaultValueForColumnType("float"), float32(0))
+		assert.Equal(t, r.getDefaultValueForColumnType("real"), float32(0))
+		assert.Equal(t, r.getDefaultValueForColumnType("double"), float64(0))
 		for _, v := range []string{"date", "time", "time with time zone", "timestamp", "timestamp with time zone"} {
 			assert.Equal(t, r.getDefaultValueForColumnType(v), time.Time{})
 		}
@@ -268,6 +276,44 @@ func TestRows_GetDefaultValueForColumnType(t *testing.T) {
 	}
 }
 
+func TestRows_GetDefaultValueForColumnType_ScanType(t *testing.T) {
+	types := []string{"tinyint", "smallint", "integer", "bigint", "float", "real", "double", "boolean",
+		"json", "char", "varchar(10)", "varbinary", "string", "binary", "interval year to month",
+		"interval day to second", "ipaddress", "unknown", "decimal(10,2)", "array(integer)", "map(varchar,integer)",
+		"row(a integer)", "struct", "date", "time", "time with time zone", "timestamp", "timestamp with time zone"}
+	for _, exactDecimal := range []bool{false, true} {
+		for _, decodeComplexTypes := range []bool{false, true} {
+			for _, nativeTypes := range []bool{false, true} {
+				testConf := NewNoOpsConfig()
+				testConf.SetMissingAsEmptyString(false)
+				testConf.SetMissingAsDefault(true)
+				testConf.SetMissingAsNil(false)
+				testConf.SetExactDecimal(exactDecimal)
+				testConf.SetDecodeComplexTypes(decodeComplexTypes)
+				columns := make([]*athena.ColumnInfo, len(types))
+				for i, athenaType := range types {
+					columns[i] = newColumnInfo("c"+strconv.Itoa(i), athenaType)
+				}
+				r := &Rows{
+					config:      testConf,
+					tracer:      NewNoOpsObservability(),
+					nativeTypes: nativeTypes,
+					ResultOutput: &athena.GetQueryResultsOutput{
+						ResultSet: &athena.ResultSet{
+							ResultSetMetadata: &athena.ResultSetMetadata{ColumnInfo: columns},
+						},
+					},
+				}
+				for i, athenaType := range types {
+					value, err := r.athenaTypeToGoType(columns[i], nil, testConf)
+					assert.Nil(t, err)
+					assert.Equal(t, r.ColumnTypeScanType(i).String(), reflect.TypeOf(value).String(), athenaType)
+				}
+			}
+		}
+	}
+}
+
 func TestRows_AthenaTypeToGoType(t *testing.T) {
 	testConf := NewNoOpsConfig()
 	r, _ := NewRows(context.Background(), newMockAthenaClient(),
@@ -420,7 +466,7 @@ func TestRows_AthenaTypeToGoType(t *testing.T) {
 	testConf.SetMissingAsNil(false)
 	g, e = r.athenaTypeToGoType(c, nil, testConf)
 	assert.Nil(t, e)
-	assert.Equal(t, g, 0)
+	assert.Equal(t, g, int32(0))
 
 	testConf.SetMissingAsEmptyString(false)
 	testConf.SetMissingAsDefault(false)
@@ -571,3 +617,244 @@ func TestRows_NewRows(t *testing.T) {
 	}
 
 }
+
+// pagingAthenaClient returns an endless sequence of result pages with one row each, after a first page with the
+// header only.
+type pagingAthenaClient struct {
+	*mockAthenaClient
+	calls      int32
+	maxResults int64
+}
+
+func (m *pagingAthenaClient) GetQueryResultsWithContext(ctx aws.Context, query *athena.GetQueryResultsInput,
+	opt ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	n := atomic.AddInt32(&m.calls, 1)
+	if query.MaxResults != nil {
+		atomic.StoreInt64(&m.maxResults, *query.MaxResults)
+	}
+	nextToken := strconv.Itoa(int(n))
+	if query.NextToken == nil {
+		return newRandomHeaderResultPage(createTestColumns(), &nextToken, 1), nil
+	}
+	return newRandomHeaderlessResultPage(createTestColumns(), &nextToken, 1), nil
+}
+
+func readAllRows(r *Rows) (int, error) {
+	dest := make([]driver.Value, len(r.Columns()))
+	cnt := 0
+	for {
+		if err := r.Next(dest); err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+}
+
+func TestRows_Prefetch(t *testing.T) {
+	for _, depth := range []int{0, 1, 3, 10} {
+		testConf := NewNoOpsConfig()
+		testConf.SetResultPrefetchDepth(depth)
+		r, e := NewRows(context.Background(), newMockAthenaClient(), "SELECT_OK", testConf,
+			NewDefaultObservability(testConf))
+		assert.Nil(t, e)
+		assert.Equal(t, depth > 0, r.prefetched != nil)
+		cnt, e := readAllRows(r)
+		assert.Equal(t, io.EOF, e)
+		assert.Equal(t, 5+10+5+5+10, cnt)
+		assert.Nil(t, r.Close())
+
+		// the pages before the failed one are returned first.
+		r, e = NewRows(context.Background(), newMockAthenaClient(), "SELECT_GetQueryResults_ERR", testConf,
+			NewDefaultObservability(testConf))
+		assert.Nil(t, e)
+		cnt, e = readAllRows(r)
+		assert.Equal(t, ErrTestMockGeneric, e)
+		assert.Equal(t, 5+3+5+5, cnt)
+		assert.Nil(t, r.Close())
+	}
+}
+
+func TestRows_Prefetch_OnePage(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetResultPrefetchDepth(2)
+	r, e := NewRows(context.Background(), newMockAthenaClient(), "show", testConf,
+		NewDefaultObservability(testConf))
+	assert.Nil(t, e)
+	assert.Nil(t, r.prefetched)
+	cnt, e := readAllRows(r)
+	assert.Equal(t, io.EOF, e)
+	assert.Equal(t, 5, cnt)
+	assert.Nil(t, r.Close())
+}
+
+func TestRows_Prefetch_Bounded(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetMetrics(true)
+	testConf.SetResultPrefetchDepth(3)
+	scope := tally.NewTestScope("", nil)
+	client := &pagingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	r, e := NewRows(context.Background(), client, "SELECT_OK", testConf,
+		NewObservability(testConf, zap.NewNop(), scope))
+	assert.Nil(t, e)
+	assert.Equal(t, int64(1), scope.Snapshot().Counters()[DriverName+".rows.prefetch+"].Value())
+
+	// the first page and 3 pages ahead of it.
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&client.calls) == 4 }, time.Second,
+		time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&client.calls))
+
+	dest := make([]driver.Value, len(r.Columns()))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, r.Next(dest))
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&client.calls) == 7 }, time.Second,
+		time.Millisecond)
+
+	// Close stops the goroutine.
+	assert.Nil(t, r.Close())
+	calls := atomic.LoadInt32(&client.calls)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, calls, atomic.LoadInt32(&client.calls))
+	assert.Equal(t, io.EOF, r.Next(dest))
+}
+
+func TestRows_Prefetch_ContextCanceled(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetResultPrefetchDepth(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &pagingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	r, e := NewRows(ctx, client, "SELECT_OK", testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, e)
+	dest := make([]driver.Value, len(r.Columns()))
+	assert.Nil(t, r.Next(dest))
+	cancel()
+
+	// the pages fetched already may still be returned, but the fetching ends with the context.
+	for i := 0; i < 10; i++ {
+		if e = r.Next(dest); e != nil {
+			break
+		}
+	}
+	assert.Equal(t, context.Canceled, e)
+	assert.Nil(t, r.Close())
+}
+
+func TestRows_ResultPageSize(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	client := &pagingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	_, e := NewRows(context.Background(), client, "SELECT_OK", testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, e)
+	assert.Equal(t, int64(0), client.maxResults)
+
+	assert.Nil(t, testConf.SetResultPageSize(1))
+	r, e := NewRows(context.Background(), client, "SELECT_OK", testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, e)
+	assert.Equal(t, int64(1), client.maxResults)
+	// a first page with the header only is not the last page.
+	assert.False(t, r.reachedLastPage)
+	dest := make([]driver.Value, len(r.Columns()))
+	assert.Nil(t, r.Next(dest))
+	assert.Nil(t, r.Close())
+}
+
+func TestRows_ColumnTypeScanType(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetMaskedColumnValue("masked", "xxx")
+	values := map[string]string{
+		"tinyint":                  "1",
+		"smallint":                 "1",
+		"integer":                  "1",
+		"bigint":                   "1",
+		"float":                    "1.5",
+		"real":                     "1.5",
+		"double":                   "1.5",
+		"boolean":                  "true",
+		"char":                     "a",
+		"varchar":                  "a",
+		"varbinary":                "61 62",
+		"json":                     "{}",
+		"decimal":                  "1.10",
+		"array":                    "[1, 2]",
+		"map":                      "{a=1}",
+		"row":                      "{a=1}",
+		"ipaddress":                "10.0.0.1",
+		"interval day to second":   "1 00:00:00.000",
+		"date":                     "2020-01-20",
+		"time":                     "12:00:00.000",
+		"timestamp":                "2020-01-20 12:00:00.000",
+		"timestamp with time zone": "2020-01-20 12:00:00.000 UTC",
+	}
+	var columns []*athena.ColumnInfo
+	for athenaType := range values {
+		columns = append(columns, newColumnInfo(athenaType, athenaType))
+	}
+	columns = append(columns, newColumnInfo("masked", "bigint"), newColumnInfo("other", "hyperloglog"))
+	r := &Rows{
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{
+				ResultSetMetadata: &athena.ResultSetMetadata{ColumnInfo: columns},
+			},
+		},
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+	for i, column := range columns[:len(values)] {
+		v, err := r.athenaTypeToGoType(column, aws.String(values[*column.Type]), testConf)
+		assert.Nil(t, err, *column.Type)
+		assert.Equal(t, reflect.TypeOf(v), r.ColumnTypeScanType(i), *column.Type)
+	}
+	assert.Equal(t, reflect.TypeOf(""), r.ColumnTypeScanType(len(values)))
+	assert.Equal(t, reflect.TypeOf(new(interface{})).Elem(), r.ColumnTypeScanType(len(values)+1))
+}
+
+func TestRows_ColumnTypeMetadata(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	decimal := newColumnInfo("price", "decimal")
+	decimal.Precision, decimal.Scale = aws.Int64(10), aws.Int64(2)
+	decimal.Nullable = aws.String(athena.ColumnNullableNotNull)
+	varchar := newColumnInfo("name", "varchar")
+	varchar.Precision = aws.Int64(255)
+	varchar.Nullable = aws.String(athena.ColumnNullableNullable)
+	varbinary := newColumnInfo("data", "varbinary")
+	varbinary.Precision = nil
+	r := &Rows{
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{
+				ResultSetMetadata: &athena.ResultSetMetadata{
+					ColumnInfo: []*athena.ColumnInfo{decimal, varchar, varbinary, newColumnInfo("id", "bigint")},
+				},
+			},
+		},
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+
+	nullable, ok := r.ColumnTypeNullable(0)
+	assert.True(t, ok)
+	assert.False(t, nullable)
+	nullable, ok = r.ColumnTypeNullable(1)
+	assert.True(t, ok)
+	assert.True(t, nullable)
+	_, ok = r.ColumnTypeNullable(3)
+	assert.False(t, ok)
+
+	_, ok = r.ColumnTypeLength(0)
+	assert.False(t, ok)
+	length, ok := r.ColumnTypeLength(1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(255), length)
+	length, ok = r.ColumnTypeLength(2)
+	assert.True(t, ok)
+	assert.Equal(t, int64(math.MaxInt64), length)
+
+	precision, scale, ok := r.ColumnTypePrecisionScale(0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), precision)
+	assert.Equal(t, int64(2), scale)
+	_, _, ok = r.ColumnTypePrecisionScale(3)
+	assert.False(t, ok)
+}
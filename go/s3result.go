@@ -0,0 +1,544 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.uber.org/zap"
+)
+
+// S3Reader reads the query results Athena writes to the output bucket. NewS3Reader creates one with an S3 client,
+// and SQLConnector.SetS3Reader replaces it with a custom one, e.g. to read through a proxy.
+// An S3Reader must be safe for concurrent use.
+type S3Reader interface {
+	// Size returns the size of an object in bytes. For an object which doesn't exist, the error is an awserr.Error
+	// with the code NotFound or NoSuchKey as from the S3 client, or an error wrapping os.ErrNotExist.
+	Size(ctx context.Context, bucket string, key string) (int64, error)
+
+	// ReadRange returns length bytes of an object, starting at offset.
+	ReadRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error)
+}
+
+// s3Reader implements S3Reader with an S3 client.
+type s3Reader struct {
+	s3API s3iface.S3API
+}
+
+// NewS3Reader is to create an S3Reader with an S3 client.
+func NewS3Reader(s3API s3iface.S3API) S3Reader {
+	return &s3Reader{s3API: s3API}
+}
+
+// Size returns the size of an object in bytes.
+func (s *s3Reader) Size(ctx context.Context, bucket string, key string) (int64, error) {
+	head, err := s.s3API.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.Int64Value(head.ContentLength), nil
+}
+
+// ReadRange returns length bytes of an object, starting at offset.
+func (s *s3Reader) ReadRange(ctx context.Context, bucket string, key string, offset int64,
+	length int64) ([]byte, error) {
+	object, err := s.s3API.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+	return ioutil.ReadAll(object.Body)
+}
+
+// parseS3Location splits an S3 URI like s3://bucket/path/to/object into the bucket and the key.
+func parseS3Location(location string) (string, string, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("%w: %s", ErrS3ResultLocation, location)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// rangePart is a part of an object read by parallelRangeReader.
+type rangePart struct {
+	data []byte
+	err  error
+}
+
+// parallelRangeReader reads an S3 object in parts of partSize bytes, with up to concurrency ranged GETs ahead
+// of the part being consumed, so a big object is read at the speed of several connections but kept in memory
+// only a few parts at a time.
+type parallelRangeReader struct {
+	cancel context.CancelFunc
+	parts  chan chan rangePart
+	buf    []byte
+	err    error
+}
+
+func newParallelRangeReader(ctx context.Context, reader S3Reader, bucket string, key string, size int64,
+	partSize int64, concurrency int) *parallelRangeReader {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &parallelRangeReader{
+		cancel: cancel,
+		parts:  make(chan chan rangePart, concurrency),
+	}
+	go func() {
+		defer close(p.parts)
+		for offset := int64(0); offset < size; offset += partSize {
+			length := partSize
+			if offset+length > size {
+				length = size - offset
+			}
+			part := make(chan rangePart, 1)
+			select {
+			case p.parts <- part:
+			case <-ctx.Done():
+				return
+			}
+			go func(offset int64, length int64) {
+				data, err := reader.ReadRange(ctx, bucket, key, offset, length)
+				if err == nil && int64(len(data)) != length {
+					err = fmt.Errorf("s3://%s/%s: read %d bytes at offset %d, expected %d", bucket, key,
+						len(data), offset, length)
+				}
+				part <- rangePart{data: data, err: err}
+			}(offset, length)
+		}
+	}()
+	return p
+}
+
+// Read returns the bytes of the object in order.
+func (p *parallelRangeReader) Read(b []byte) (int, error) {
+	for len(p.buf) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		part, ok := <-p.parts
+		if !ok {
+			return 0, io.EOF
+		}
+		r := <-part
+		p.buf, p.err = r.data, r.err
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+// Close stops reading the parts ahead.
+func (p *parallelRangeReader) Close() error {
+	p.cancel()
+	return nil
+}
+
+// resultCSVReader reads the records of a query result CSV. Athena quotes every value, and writes NULL as an
+// empty unquoted value, which encoding/csv can't tell from an empty string.
+type resultCSVReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newResultCSVReader(r io.Reader) *resultCSVReader {
+	return &resultCSVReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// read returns the next record, where a NULL value is nil. It returns io.EOF after the last record.
+func (c *resultCSVReader) read() ([]*string, error) {
+	var record []*string
+	for {
+		b, err := c.r.ReadByte()
+		if err == io.EOF && record != nil {
+			// the last value of the last line is NULL, and there is no line break after it
+			return append(record, nil), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var value *string
+		switch b {
+		case '"':
+			s, err := c.readQuoted()
+			if err != nil {
+				return nil, err
+			}
+			value = &s
+			if b, err = c.r.ReadByte(); err == io.EOF {
+				return append(record, value), nil
+			} else if err != nil {
+				return nil, err
+			}
+		case ',', '\r', '\n':
+		default:
+			s, next, err := c.readUnquoted(b)
+			if err != nil {
+				return nil, err
+			}
+			value = &s
+			if next == 0 {
+				return append(record, value), nil
+			}
+			b = next
+		}
+		record = append(record, value)
+		switch b {
+		case ',':
+		case '\n':
+			return record, nil
+		case '\r':
+			if next, err := c.r.Peek(1); err == nil && next[0] == '\n' {
+				_, _ = c.r.ReadByte()
+			}
+			return record, nil
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q after a quoted value", ErrResultCSV, b)
+		}
+	}
+}
+
+// readQuoted reads a quoted value after its opening quote, where a quote is escaped as two.
+func (c *resultCSVReader) readQuoted() (string, error) {
+	c.buf = c.buf[:0]
+	for {
+		chunk, err := c.r.ReadSlice('"')
+		c.buf = append(c.buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return "", fmt.Errorf("%w: unterminated quoted value", ErrResultCSV)
+		}
+		if err != nil {
+			return "", err
+		}
+		c.buf = c.buf[:len(c.buf)-1]
+		if next, err := c.r.Peek(1); err == nil && next[0] == '"' {
+			_, _ = c.r.ReadByte()
+			c.buf = append(c.buf, '"')
+			continue
+		}
+		return string(c.buf), nil
+	}
+}
+
+// readUnquoted reads an unquoted value starting with first, and returns the delimiter after it, which is 0 at
+// the end of the CSV.
+func (c *resultCSVReader) readUnquoted(first byte) (string, byte, error) {
+	c.buf = append(c.buf[:0], first)
+	for {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			return string(c.buf), 0, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if b == ',' || b == '\n' || b == '\r' {
+			return string(c.buf), b, nil
+		}
+		c.buf = append(c.buf, b)
+	}
+}
+
+// isS3ReadableResult is to check if the result of a query execution is a CSV which can be read from S3. The result
+// of DDL and utility statements is a text file, which is read through GetQueryResults.
+func isS3ReadableResult(execution *athena.QueryExecution) bool {
+	if execution == nil || aws.StringValue(execution.StatementType) != athena.StatementTypeDml ||
+		execution.ResultConfiguration == nil {
+		return false
+	}
+	return strings.HasSuffix(aws.StringValue(execution.ResultConfiguration.OutputLocation), ".csv")
+}
+
+// newS3Rows is to create a Rows which reads the result CSV of a finished query execution from S3, instead of
+// paging through GetQueryResults 1000 rows at a time.
+func newS3Rows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, reader S3Reader,
+	execution *athena.QueryExecution, driverConfig *Config, obs *DriverTracer) (*Rows, error) {
+	queryID := aws.StringValue(execution.QueryExecutionId)
+	location := aws.StringValue(execution.ResultConfiguration.OutputLocation)
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := readResultMetadata(ctx, reader, bucket, key+".metadata")
+	if isS3NotFound(err) {
+		// the result was written without the .metadata file, so the column types come from GetQueryResults
+		obs.Scope().Counter(DriverName + ".s3rows.metadata.missing").Inc(1)
+		columns, err = getResultColumns(ctx, athenaAPI, queryID)
+		if err != nil {
+			obs.Scope().Counter(DriverName + ".failure.s3rows.getqueryresults").Inc(1)
+			obs.Log(ErrorLevel, "GetQueryResults failed", zap.String("queryID", queryID),
+				zap.String("error", err.Error()))
+			return nil, err
+		}
+	} else if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.s3rows.metadata").Inc(1)
+		obs.Log(ErrorLevel, "reading query result metadata from S3 failed", zap.String("queryID", queryID),
+			zap.String("location", location), zap.String("error", err.Error()))
+		return nil, err
+	}
+	size, err := reader.Size(ctx, bucket, key)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.s3rows.size").Inc(1)
+		obs.Log(ErrorLevel, "reading query result from S3 failed", zap.String("queryID", queryID),
+			zap.String("location", location), zap.String("error", err.Error()))
+		return nil, err
+	}
+	body := newParallelRangeReader(ctx, reader, bucket, key, size, driverConfig.GetS3ReadPartSize(),
+		driverConfig.GetS3ReadConcurrency())
+	r := &Rows{
+		athena:  athenaAPI,
+		ctx:     ctx,
+		queryID: queryID,
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{
+				ResultSetMetadata: &athena.ResultSetMetadata{ColumnInfo: columns},
+			},
+		},
+		config:         driverConfig,
+		tracer:         obs,
+		queryExecution: execution,
+		csv:            newResultCSVReader(body),
+		csvBody:        body,
+	}
+	// skip the header
+	if _, err := r.csv.read(); err != nil && err != io.EOF {
+		_ = body.Close()
+		return nil, err
+	}
+	obs.Scope().Counter(DriverName + ".s3rows").Inc(1)
+	return r, nil
+}
+
+// getResultColumns is to get the column types of a query result with a GetQueryResults call for one row.
+func getResultColumns(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID string) ([]*athena.ColumnInfo,
+	error) {
+	output, err := athenaAPI.GetQueryResultsWithContext(ctx, &athena.GetQueryResultsInput{
+		QueryExecutionId: aws.String(queryID),
+		MaxResults:       aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if output.ResultSet == nil || output.ResultSet.ResultSetMetadata == nil {
+		return nil, nil
+	}
+	return output.ResultSet.ResultSetMetadata.ColumnInfo, nil
+}
+
+// isS3NotFound is to check if err means an S3 object doesn't exist, as returned by the S3 client, or by an S3Reader
+// keeping the objects in files.
+func isS3NotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if reqerr, ok := err.(awserr.RequestFailure); ok && reqerr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// readResultMetadata is to read the column types of a query result from the .metadata file Athena writes next to
+// the result CSV.
+func readResultMetadata(ctx context.Context, reader S3Reader, bucket string, key string) ([]*athena.ColumnInfo,
+	error) {
+	size, err := reader.Size(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := reader.ReadRange(ctx, bucket, key, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return parseResultMetadata(data)
+}
+
+// parseResultMetadata is to decode a .metadata file. It is a protobuf message with the ColumnInfo of each column in
+// field 1, and the fields of ColumnInfo numbered in the order of the Athena API, i.e. 1 CatalogName to 10
+// CaseSensitive. Unknown fields are skipped, so a field added by Athena later doesn't break the decoding.
+func parseResultMetadata(data []byte) ([]*athena.ColumnInfo, error) {
+	var columns []*athena.ColumnInfo
+	err := readProtoFields(data, func(field uint64, value uint64, bytes []byte) error {
+		if field != 1 || bytes == nil {
+			return nil
+		}
+		column, err := parseColumnInfo(bytes)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, column)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: no columns", ErrResultMetadata)
+	}
+	return columns, nil
+}
+
+// columnNullability are the values of ColumnInfo.Nullable by their number in a .metadata file.
+var columnNullability = []string{
+	athena.ColumnNullableNotNull,
+	athena.ColumnNullableNullable,
+	athena.ColumnNullableUnknown,
+}
+
+// parseColumnInfo is to decode the ColumnInfo of a column in a .metadata file.
+func parseColumnInfo(data []byte) (*athena.ColumnInfo, error) {
+	column := &athena.ColumnInfo{}
+	err := readProtoFields(data, func(field uint64, value uint64, bytes []byte) error {
+		switch field {
+		case 1:
+			column.CatalogName = aws.String(string(bytes))
+		case 2:
+			column.SchemaName = aws.String(string(bytes))
+		case 3:
+			column.TableName = aws.String(string(bytes))
+		case 4:
+			column.Name = aws.String(string(bytes))
+		case 5:
+			column.Label = aws.String(string(bytes))
+		case 6:
+			column.Type = aws.String(string(bytes))
+		case 7:
+			column.Precision = aws.Int64(int64(value))
+		case 8:
+			column.Scale = aws.Int64(int64(value))
+		case 9:
+			if value < uint64(len(columnNullability)) {
+				column.Nullable = aws.String(columnNullability[value])
+			}
+		case 10:
+			column.CaseSensitive = aws.Bool(value != 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(column.Name) == "" || aws.StringValue(column.Type) == "" {
+		return nil, fmt.Errorf("%w: column without a name or a type", ErrResultMetadata)
+	}
+	return column, nil
+}
+
+// readProtoFields is to call f with each field of a protobuf message in data, with the value of a varint field in
+// value, and the content of a length-delimited field in bytes. Fixed-size fields are skipped.
+func readProtoFields(data []byte, f func(field uint64, value uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("%w: bad field tag", ErrResultMetadata)
+		}
+		data = data[n:]
+		var value uint64
+		var bytes []byte
+		switch tag & 7 {
+		case 0:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("%w: bad varint", ErrResultMetadata)
+			}
+			data = data[n:]
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(data) < size {
+				return fmt.Errorf("%w: truncated field", ErrResultMetadata)
+			}
+			data = data[size:]
+			continue
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return fmt.Errorf("%w: truncated field", ErrResultMetadata)
+			}
+			bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d", ErrResultMetadata, tag&7)
+		}
+		if err := f(tag>>3, value, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextS3Row is to read the next row of the result CSV.
+func (r *Rows) nextS3Row(dest []driver.Value) error {
+	record, err := r.csv.read()
+	if err == io.EOF {
+		r.reachedLastPage = true
+		return io.EOF
+	}
+	if err != nil {
+		r.tracer.Scope().Counter(DriverName + ".failure.s3rows.read").Inc(1)
+		r.tracer.Log(ErrorLevel, "reading query result from S3 failed", zap.String("queryID", r.queryID),
+			zap.String("error", err.Error()))
+		return err
+	}
+	columns := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
+	if len(record) != len(columns) {
+		return fmt.Errorf("%w: %d values in a row of %d columns", ErrResultCSV, len(record), len(columns))
+	}
+	for i, val := range record {
+		value, err := r.columnValue(columns[i], val, r.config)
+		if err != nil {
+			r.tracer.Log(ErrorLevel, "convertrow failed", zap.String("error", err.Error()))
+			r.tracer.Scope().Counter(DriverName + ".failure.convertrow").Inc(1)
+			return err
+		}
+		dest[i] = value
+	}
+	return nil
+}
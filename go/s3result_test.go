@@ -0,0 +1,404 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// dirS3Reader is an S3Store keeping the objects in the files under a local directory, where s3://bucket/key
+// is the file bucket/key.
+type dirS3Reader struct {
+	root  string
+	reads int32
+
+	// err is returned by ReadRange from errOffset on.
+	err       error
+	errOffset int64
+}
+
+func (d *dirS3Reader) Size(ctx context.Context, bucket string, key string) (int64, error) {
+	info, err := os.Stat(filepath.Join(d.root, bucket, key))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (d *dirS3Reader) ReadRange(ctx context.Context, bucket string, key string, offset int64,
+	length int64) ([]byte, error) {
+	atomic.AddInt32(&d.reads, 1)
+	if d.err != nil && offset >= d.errOffset {
+		return nil, d.err
+	}
+	f, err := os.Open(filepath.Join(d.root, bucket, key))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, length)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (d *dirS3Reader) List(ctx context.Context, bucket string, prefix string) ([]string, error) {
+	var keys []string
+	root := filepath.Join(d.root, bucket)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		key, err := filepath.Rel(root, path)
+		if strings.HasPrefix(filepath.ToSlash(key), prefix) {
+			keys = append(keys, filepath.ToSlash(key))
+		}
+		return err
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return keys, err
+}
+
+func (d *dirS3Reader) Delete(ctx context.Context, bucket string, keys []string) error {
+	for _, key := range keys {
+		if err := os.Remove(filepath.Join(d.root, bucket, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newDirS3Reader(t *testing.T, objects map[string]string) *dirS3Reader {
+	root, err := ioutil.TempDir("", "athenadriver")
+	assert.Nil(t, err)
+	for location, content := range objects {
+		bucket, key, err := parseS3Location(location)
+		assert.Nil(t, err)
+		path := filepath.Join(root, bucket, key)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	return &dirS3Reader{root: root}
+}
+
+// appendProtoField is to append a protobuf field to buf, length-delimited if value is a string and a varint
+// otherwise.
+func appendProtoField(buf []byte, field uint64, value interface{}) []byte {
+	varint := make([]byte, binary.MaxVarintLen64)
+	if s, ok := value.(string); ok {
+		buf = append(buf, varint[:binary.PutUvarint(varint, field<<3|2)]...)
+		buf = append(buf, varint[:binary.PutUvarint(varint, uint64(len(s)))]...)
+		return append(buf, s...)
+	}
+	buf = append(buf, varint[:binary.PutUvarint(varint, field<<3)]...)
+	return append(buf, varint[:binary.PutUvarint(varint, value.(uint64))]...)
+}
+
+// newResultMetadata is to encode columns of name and type pairs like a .metadata file.
+func newResultMetadata(columns ...string) string {
+	var buf []byte
+	for i := 0; i+1 < len(columns); i += 2 {
+		var column []byte
+		column = appendProtoField(column, 1, "hive")
+		column = appendProtoField(column, 4, columns[i])
+		column = appendProtoField(column, 5, columns[i])
+		column = appendProtoField(column, 6, columns[i+1])
+		column = appendProtoField(column, 9, uint64(1))
+		buf = appendProtoField(buf, 1, string(column))
+	}
+	return string(buf)
+}
+
+func readCSVRecords(t *testing.T, content string) ([][]*string, error) {
+	c := newResultCSVReader(strings.NewReader(content))
+	var records [][]*string
+	for {
+		record, err := c.read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestResultCSVReader(t *testing.T) {
+	records, err := readCSVRecords(t, "\"a\",\"b\",\"c\"\n\"1\",,\"x, \"\"y\"\"\nz\"\r\n\"\",\"2\",\n,\"\",")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]*string{
+		{aws.String("a"), aws.String("b"), aws.String("c")},
+		{aws.String("1"), nil, aws.String("x, \"y\"\nz")},
+		{aws.String(""), aws.String("2"), nil},
+		{nil, aws.String(""), nil},
+	}, records)
+
+	records, err = readCSVRecords(t, "1,abc\n\n\"2\",\"3\"")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]*string{
+		{aws.String("1"), aws.String("abc")},
+		{nil},
+		{aws.String("2"), aws.String("3")},
+	}, records)
+
+	long := strings.Repeat("\"\"x", 50000)
+	records, err = readCSVRecords(t, "\""+long+"\"\n")
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("\"x", 50000), *records[0][0])
+
+	_, err = readCSVRecords(t, "\"1\",\"2")
+	assert.True(t, errors.Is(err, ErrResultCSV))
+	_, err = readCSVRecords(t, "\"1\"x,\"2\"")
+	assert.True(t, errors.Is(err, ErrResultCSV))
+}
+
+func TestParseResultMetadata(t *testing.T) {
+	var column []byte
+	column = appendProtoField(column, 1, "hive")
+	column = appendProtoField(column, 2, "db")
+	column = appendProtoField(column, 3, "t")
+	column = appendProtoField(column, 4, "price")
+	column = appendProtoField(column, 5, "Price")
+	column = appendProtoField(column, 6, "decimal")
+	column = appendProtoField(column, 7, uint64(10))
+	column = appendProtoField(column, 8, uint64(2))
+	column = appendProtoField(column, 9, uint64(0))
+	column = appendProtoField(column, 10, uint64(1))
+	// unknown fields are skipped
+	column = appendProtoField(column, 99, "x")
+	column = append(column, 11<<3|5, 0, 0, 0, 0)
+	metadata := appendProtoField(nil, 1, string(column))
+	metadata = append(metadata, 12<<3|1, 0, 0, 0, 0, 0, 0, 0, 0)
+	metadata = appendProtoField(metadata, 2, uint64(7))
+	columns, err := parseResultMetadata(metadata)
+	assert.Nil(t, err)
+	assert.Equal(t, []*athena.ColumnInfo{{
+		CatalogName:   aws.String("hive"),
+		SchemaName:    aws.String("db"),
+		TableName:     aws.String("t"),
+		Name:          aws.String("price"),
+		Label:         aws.String("Price"),
+		Type:          aws.String("decimal"),
+		Precision:     aws.Int64(10),
+		Scale:         aws.Int64(2),
+		Nullable:      aws.String(athena.ColumnNullableNotNull),
+		CaseSensitive: aws.Bool(true),
+	}}, columns)
+
+	columns, err = parseResultMetadata([]byte(newResultMetadata("a", "integer", "b", "varchar")))
+	assert.Nil(t, err)
+	assert.Len(t, columns, 2)
+	assert.Equal(t, "b", *columns[1].Name)
+	assert.Equal(t, athena.ColumnNullableNullable, *columns[1].Nullable)
+
+	for _, metadata := range []string{
+		"",
+		newResultMetadata("a", "integer")[:5],
+		newResultMetadata("a", ""),
+		string(appendProtoField(nil, 1, string(appendProtoField(nil, 6, "integer")))),
+		"\x0f",
+	} {
+		_, err = parseResultMetadata([]byte(metadata))
+		assert.True(t, errors.Is(err, ErrResultMetadata), metadata)
+	}
+}
+
+func TestIsS3NotFound(t *testing.T) {
+	assert.True(t, isS3NotFound(awserr.New("NotFound", "Not Found", nil)))
+	assert.True(t, isS3NotFound(awserr.New("NoSuchKey", "The specified key does not exist.", nil)))
+	assert.True(t, isS3NotFound(awserr.NewRequestFailure(awserr.New("Forbidden", "", nil), 404, "")))
+	_, err := os.Stat(filepath.Join(os.TempDir(), "athenadriver-missing"))
+	assert.True(t, isS3NotFound(err))
+	assert.False(t, isS3NotFound(awserr.NewRequestFailure(awserr.New("Forbidden", "", nil), 403, "")))
+	assert.False(t, isS3NotFound(ErrTestMockGeneric))
+	assert.False(t, isS3NotFound(nil))
+}
+
+func TestParseS3Location(t *testing.T) {
+	bucket, key, err := parseS3Location("s3://bucket/path/to/QID.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket", bucket)
+	assert.Equal(t, "path/to/QID.csv", key)
+
+	_, _, err = parseS3Location("/path/to/QID.csv")
+	assert.True(t, errors.Is(err, ErrS3ResultLocation))
+}
+
+func TestParallelRangeReader(t *testing.T) {
+	content := randString(10000)
+	reader := newDirS3Reader(t, map[string]string{"s3://bucket/QID.csv": content})
+	defer os.RemoveAll(reader.root)
+	for _, partSize := range []int64{7, 1000, 20000} {
+		reader.reads = 0
+		p := newParallelRangeReader(context.Background(), reader, "bucket", "QID.csv", int64(len(content)),
+			partSize, 3)
+		data, err := ioutil.ReadAll(p)
+		assert.Nil(t, err)
+		assert.Equal(t, content, string(data))
+		assert.Equal(t, int32((int64(len(content))+partSize-1)/partSize), reader.reads)
+		assert.Nil(t, p.Close())
+	}
+
+	// an error of any part is returned in order, after the parts before it
+	failing := &dirS3Reader{root: reader.root, err: ErrTestMockGeneric, errOffset: 100}
+	p := newParallelRangeReader(context.Background(), failing, "bucket", "QID.csv", int64(len(content)), 100, 3)
+	data, err := ioutil.ReadAll(p)
+	assert.Equal(t, ErrTestMockGeneric, err)
+	assert.Equal(t, content[:100], string(data))
+	assert.Nil(t, p.Close())
+
+	// closing it early stops reading ahead
+	p = newParallelRangeReader(context.Background(), &dirS3Reader{root: reader.root}, "bucket", "QID.csv",
+		int64(len(content)), 1, 2)
+	buf := make([]byte, 1)
+	_, err = p.Read(buf)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Close())
+}
+
+func createS3ResultTestConnection(t *testing.T, csv string, statementType string) (*Connection, *dirS3Reader) {
+	c := createQueryHandleTestConnection()
+	assert.Nil(t, c.connector.config.SetResultMode(ResultModeS3))
+	c.s3Reader = newDirS3Reader(t, map[string]string{
+		"s3://fake-query-results-arbitrary-bucket/SELECTQueryContext_OK_QID.csv": csv,
+	})
+	c.athenaAPI.(*mockAthenaClient).queryExecutions = map[string]*athena.QueryExecution{
+		"SELECTQueryContext_OK_QID": {
+			QueryExecutionId: aws.String("SELECTQueryContext_OK_QID"),
+			Status: &athena.QueryExecutionStatus{
+				State: aws.String(athena.QueryExecutionStateSucceeded),
+			},
+			StatementType: aws.String(statementType),
+			ResultConfiguration: &athena.ResultConfiguration{
+				OutputLocation: aws.String(
+					"s3://fake-query-results-arbitrary-bucket/SELECTQueryContext_OK_QID.csv"),
+			},
+		},
+	}
+	return c, c.s3Reader.(*dirS3Reader)
+}
+
+func TestConnection_QueryContext_ResultModeS3(t *testing.T) {
+	c, reader := createS3ResultTestConnection(t, "\"_col0\"\n\"1\"\n\"2\"\n\"3\"\n", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"_col0"}, rows.Columns())
+	dest := make([]driver.Value, 1)
+	var values []driver.Value
+	for rows.Next(dest) == nil {
+		values = append(values, dest[0])
+	}
+	assert.Equal(t, []driver.Value{int32(1), int32(2), int32(3)}, values)
+	assert.Equal(t, io.EOF, rows.Next(dest))
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, int32(1), reader.reads)
+	// without a .metadata file, the column types come from GetQueryResults
+	assert.Equal(t, 1, c.athenaAPI.(*mockAthenaClient).getQueryResultsCalls["SELECTQueryContext_OK_QID"])
+
+	rows, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+
+	// a value which isn't an integer fails the conversion like it does in GetQueryResults
+	c, reader = createS3ResultTestConnection(t, "\"_col0\"\n\"x\"\n", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	rows, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.NotNil(t, rows.Next(dest))
+	assert.Nil(t, rows.Close())
+
+	c, reader = createS3ResultTestConnection(t, "\"_col0\"\n\"1\",\"2\"\n", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	rows, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(rows.Next(dest), ErrResultCSV))
+}
+
+func TestConnection_QueryContext_ResultModeS3_Metadata(t *testing.T) {
+	c, reader := createS3ResultTestConnection(t, "\"id\",\"name\"\n\"1\",\"a\"\n\"2\",\n", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	metadataPath := filepath.Join(reader.root, "fake-query-results-arbitrary-bucket",
+		"SELECTQueryContext_OK_QID.csv.metadata")
+	assert.Nil(t, ioutil.WriteFile(metadataPath, []byte(newResultMetadata("id", "bigint", "name", "varchar")), 0600))
+	rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name"}, rows.Columns())
+	assert.Equal(t, "bigint", rows.(*Rows).ColumnTypeDatabaseTypeName(0))
+	dest := make([]driver.Value, 2)
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, []driver.Value{int64(1), "a"}, dest)
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, int64(2), dest[0])
+	assert.Equal(t, io.EOF, rows.Next(dest))
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, 0, c.athenaAPI.(*mockAthenaClient).getQueryResultsCalls["SELECTQueryContext_OK_QID"])
+
+	// a malformed .metadata file fails the query instead of falling back to GetQueryResults
+	assert.Nil(t, ioutil.WriteFile(metadataPath, []byte("\x0a\x05id"), 0600))
+	_, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.True(t, errors.Is(err, ErrResultMetadata))
+	assert.Equal(t, 0, c.athenaAPI.(*mockAthenaClient).getQueryResultsCalls["SELECTQueryContext_OK_QID"])
+}
+
+func TestConnection_QueryContext_ResultModeS3_Fallback(t *testing.T) {
+	// the result of a DDL statement is read with GetQueryResults
+	c, reader := createS3ResultTestConnection(t, "", athena.StatementTypeDdl)
+	defer os.RemoveAll(reader.root)
+	rows, err := c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Nil(t, rows.(*Rows).csv)
+	assert.Equal(t, int32(0), reader.reads)
+
+	c, reader = createS3ResultTestConnection(t, "", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	assert.Nil(t, c.connector.config.SetResultMode(ResultModeAPI))
+	rows, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.Nil(t, err)
+	assert.Nil(t, rows.(*Rows).csv)
+
+	// a missing result object fails the query
+	c, reader = createS3ResultTestConnection(t, "", athena.StatementTypeDml)
+	defer os.RemoveAll(reader.root)
+	assert.Nil(t, os.RemoveAll(filepath.Join(reader.root, "fake-query-results-arbitrary-bucket")))
+	_, err = c.QueryContext(context.Background(), "SELECTQueryContext_OK", []driver.NamedValue{})
+	assert.True(t, os.IsNotExist(err))
+}
@@ -23,29 +23,94 @@ package athenadriver
 import (
 	"context"
 	"database/sql/driver"
-	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"go.uber.org/zap"
 )
 
 // Statement is to implement Go's database/sql Statement.
+// A Statement can be run any number of times until it is closed.
 type Statement struct {
 	connection *Connection
 	closed     bool
 	query      string
 	numInput   int
+	// name and workgroup of the Athena prepared statement, if it is prepared on the server side.
+	name      string
+	workgroup string
+}
+
+// createPreparedStatement is to prepare the query of the statement in Athena.
+func (s *Statement) createPreparedStatement(ctx context.Context) error {
+	ctx, query, err := applyQueryDirectives(ctx, s.query, false)
+	if err != nil {
+		return err
+	}
+	c, err := s.connection.withContext(ctx)
+	if err != nil {
+		return err
+	}
+	var obs = c.connector.tracer
+	wgName, err := c.checkWorkgroup(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := newClientRequestToken()
+	if err != nil {
+		return err
+	}
+	name := "athenadriver_" + token
+	_, err = c.athenaAPI.CreatePreparedStatementWithContext(ctx, &athena.CreatePreparedStatementInput{
+		StatementName:  aws.String(name),
+		WorkGroup:      aws.String(wgName),
+		QueryStatement: aws.String(toPositionalPlaceholders(query)),
+	})
+	if err != nil {
+		obs.Log(ErrorLevel, "CreatePreparedStatement failed",
+			zap.String("workgroup", wgName),
+			zap.String("query", s.query),
+			zap.String("error", err.Error()))
+		obs.Scope().Counter(DriverName + ".failure.preparedstatement.create").Inc(1)
+		return err
+	}
+	obs.Scope().Counter(DriverName + ".preparedstatement.create").Inc(1)
+	s.name = name
+	s.workgroup = wgName
+	return nil
 }
 
-// Close is to close an open statement.
+// Close is to close an open statement. The Athena prepared statement of it is deleted.
 func (s *Statement) Close() error {
-	if s.connection == nil || s.closed {
+	if s.closed {
 		// driver.Stmt.Close can be called more than once, thus this function
 		// has to be idempotent.
 		// See also Issue #450 and golang/go#16019.
+		return nil
+	}
+	if s.connection == nil {
 		return driver.ErrBadConn
 	}
+	var err error
+	if s.name != "" && s.connection.athenaAPI != nil {
+		_, err = s.connection.athenaAPI.DeletePreparedStatementWithContext(context.Background(),
+			&athena.DeletePreparedStatementInput{
+				StatementName: aws.String(s.name),
+				WorkGroup:     aws.String(s.workgroup),
+			})
+		if err != nil {
+			s.connection.connector.tracer.Log(WarnLevel, "DeletePreparedStatement failed",
+				zap.String("workgroup", s.workgroup),
+				zap.String("statement", s.name),
+				zap.String("error", err.Error()))
+			s.connection.connector.tracer.Scope().Counter(DriverName + ".failure.preparedstatement.delete").Inc(1)
+		}
+	}
 	s.query = ""
+	s.name = ""
 	s.closed = true
 	s.numInput = 0
-	return nil
+	return err
 }
 
 // NumInput returns the number of prepared arguments.
@@ -54,8 +119,12 @@ func (s *Statement) Close() error {
 // will not sanity check Exec or Query argument counts.
 // -- From Go `sql/driver`
 func (s *Statement) NumInput() int {
+	if len(findNamedPlaceholders(s.query)) > 0 {
+		// the arguments are checked by name when the statement is run
+		return -1
+	}
 	if s.numInput == 0 {
-		s.numInput = strings.Count(s.query, "?")
+		s.numInput = countPlaceholders(s.query)
 	}
 	return s.numInput
 }
@@ -67,22 +136,40 @@ func (s *Statement) ColumnConverter(idx int) driver.ValueConverter {
 
 // Exec is to execute a prepared statement.
 func (s *Statement) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueToNamedValue(args))
+}
+
+// Query is to query based on a prepared statement.
+func (s *Statement) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueToNamedValue(args))
+}
+
+// ExecContext is to execute a prepared statement with the context.
+func (s *Statement) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	if s.closed {
 		return nil, driver.ErrBadConn
 	}
-	r, e := s.connection.ExecContext(context.Background(), s.query,
-		valueToNamedValue(args))
-	s.closed = true
-	return r, e
+	if s.name == "" {
+		return s.connection.ExecContext(ctx, s.query, args)
+	}
+	rows, err := s.connection.queryContext(WithWorkgroup(ctx, s.workgroup), s.query, args, s.name)
+	if err != nil {
+		return nil, err
+	}
+	return newExecResult(rows), nil
 }
 
-// Query is to query based on a prepared statement.
-func (s *Statement) Query(args []driver.Value) (driver.Rows, error) {
+// QueryContext is to query based on a prepared statement with the context.
+func (s *Statement) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
 	if s.closed {
 		return nil, driver.ErrBadConn
 	}
-	r, e := s.connection.QueryContext(context.Background(), s.query,
-		valueToNamedValue(args))
-	s.closed = true
-	return r, e
+	if s.name != "" {
+		// the Athena prepared statement can only be executed in its workgroup
+		ctx = WithWorkgroup(ctx, s.workgroup)
+	}
+	return s.connection.queryContext(ctx, s.query, args, s.name)
 }
+
+var _ driver.StmtExecContext = (*Statement)(nil)
+var _ driver.StmtQueryContext = (*Statement)(nil)
@@ -182,3 +182,111 @@ func TestStatement_Close_AfterConnectionClose(t *testing.T) {
 	err := st.Close()
 	assert.Equal(t, err, driver.ErrBadConn)
 }
+
+func TestStatement_CloseTwice(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	c.connector.config.SetServerSidePrepare(true)
+	m := c.athenaAPI.(*mockAthenaClient)
+	stmt, err := c.PrepareContext(context.Background(), "SELECTQueryContext_?")
+	assert.Nil(t, err)
+	assert.Len(t, m.preparedStatements, 1)
+	assert.Nil(t, stmt.Close())
+	assert.Empty(t, m.preparedStatements)
+	// the second Close doesn't delete the prepared statement again, which would fail
+	assert.Nil(t, stmt.Close())
+}
+
+func TestStatement_Reuse(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	m := c.athenaAPI.(*mockAthenaClient)
+	stmt, err := c.PrepareContext(context.Background(), "SELECTQueryContext_?")
+	assert.Nil(t, err)
+	st := stmt.(*Statement)
+	assert.Equal(t, "", st.name)
+	for i := 0; i < 3; i++ {
+		rows, err := st.QueryContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: "OK"}})
+		assert.Nil(t, err)
+		assert.NotNil(t, rows)
+	}
+	_, err = st.Exec([]driver.Value{"OK"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, m.startQueryExecutionCalls["SELECTQueryContext_?"])
+	assert.Equal(t, 1, m.startQueryExecutionCalls["SELECTQueryContext_'OK'"])
+	assert.Nil(t, st.Close())
+	_, err = st.QueryContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: "OK"}})
+	assert.Equal(t, driver.ErrBadConn, err)
+	_, err = st.ExecContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: "OK"}})
+	assert.Equal(t, driver.ErrBadConn, err)
+
+	_, err = c.Prepare(randString(MAXQueryStringLength * 10))
+	assert.Equal(t, ErrInvalidQuery, err)
+}
+
+func TestStatement_ServerSidePrepare(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	c.connector.config.SetServerSidePrepare(true)
+	m := c.athenaAPI.(*mockAthenaClient)
+	stmt, err := c.PrepareContext(context.Background(), "SELECT * FROM t WHERE a = ? AND b = ?")
+	assert.Nil(t, err)
+	st := stmt.(*Statement)
+	assert.Regexp(t, "^athenadriver_[0-9a-f]{32}$", st.name)
+	assert.Equal(t, "primary", st.workgroup)
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? AND b = ?", m.preparedStatements[st.name])
+	assert.Equal(t, 2, st.NumInput())
+
+	for i := 0; i < 2; i++ {
+		rows, err := st.QueryContext(context.Background(), []driver.NamedValue{
+			{Ordinal: 1, Value: int64(1)},
+			{Ordinal: 2, Value: "x"},
+		})
+		assert.Nil(t, err)
+		assert.NotNil(t, rows)
+	}
+	assert.Equal(t, 2, m.startQueryExecutionCalls["EXECUTE "+st.name])
+	assert.Equal(t, "1", *m.executionParameters[0])
+	assert.Equal(t, "x", *m.executionParameters[1])
+
+	result, err := st.ExecContext(context.Background(), []driver.NamedValue{
+		{Ordinal: 1, Value: int64(1)},
+		{Ordinal: 2, Value: "x"},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+
+	name := st.name
+	assert.Nil(t, st.Close())
+	_, ok := m.preparedStatements[name]
+	assert.False(t, ok)
+	assert.Nil(t, st.Close())
+
+	// a failed deletion is reported
+	stmt, err = c.PrepareContext(context.Background(), "SELECT 1")
+	assert.Nil(t, err)
+	delete(m.preparedStatements, stmt.(*Statement).name)
+	assert.Equal(t, ErrTestMockGeneric, stmt.Close())
+
+	_, err = c.PrepareContext(context.Background(), "CreatePreparedStatement_error")
+	assert.Equal(t, ErrTestMockGeneric, err)
+
+	// pseudo commands and query IDs are not prepared in Athena
+	stmt, err = c.PrepareContext(context.Background(), "00000000-0000-0000-0000-000000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, "", stmt.(*Statement).name)
+}
+
+func TestStatement_ServerSidePrepare_Workgroup(t *testing.T) {
+	c := createQueryHandleTestConnection()
+	c.connector.config.SetServerSidePrepare(true)
+	m := c.athenaAPI.(*mockAthenaClient)
+	m.GetWGStatus = true
+	stmt, err := c.PrepareContext(WithWorkgroup(context.Background(), "etl"), "SELECT * FROM t WHERE a = ?")
+	assert.Nil(t, err)
+	st := stmt.(*Statement)
+	assert.Equal(t, "etl", st.workgroup)
+
+	// the statement runs in its workgroup, whatever the workgroup of the query context is
+	_, err = st.QueryContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: int64(1)}})
+	assert.Nil(t, err)
+	assert.Equal(t, "etl", m.workGroup)
+	assert.Nil(t, stmt.Close())
+}
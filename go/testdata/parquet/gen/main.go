@@ -0,0 +1,171 @@
+// Command gen writes the Parquet files under testdata/parquet with the Apache Arrow Go Parquet writer, an
+// implementation of Parquet independent of the reader in parquet.go.
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+var schema = arrow.NewSchema([]arrow.Field{
+	{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "price", Type: &arrow.Decimal128Type{Precision: 9, Scale: 2}, Nullable: true},
+	{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}, Nullable: true},
+	{Name: "day", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+	{Name: "flag", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+	{Name: "ratio", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+	{Name: "scores", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int32), Nullable: true},
+	{Name: "item", Type: arrow.StructOf(
+		arrow.Field{Name: "x", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		arrow.Field{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		arrow.Field{Name: "points", Type: arrow.ListOf(arrow.PrimitiveTypes.Int32), Nullable: true},
+	), Nullable: true},
+}, nil)
+
+func record() arrow.Record {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	id := b.Field(0).(*array.Int64Builder)
+	name := b.Field(1).(*array.StringBuilder)
+	price := b.Field(2).(*array.Decimal128Builder)
+	ts := b.Field(3).(*array.TimestampBuilder)
+	day := b.Field(4).(*array.Date32Builder)
+	flag := b.Field(5).(*array.BooleanBuilder)
+	ratio := b.Field(6).(*array.Float64Builder)
+	tags := b.Field(7).(*array.ListBuilder)
+	tag := tags.ValueBuilder().(*array.StringBuilder)
+	scores := b.Field(8).(*array.MapBuilder)
+	scoreKey := scores.KeyBuilder().(*array.StringBuilder)
+	scoreValue := scores.ItemBuilder().(*array.Int32Builder)
+	item := b.Field(9).(*array.StructBuilder)
+	itemX := item.FieldBuilder(0).(*array.Int64Builder)
+	itemName := item.FieldBuilder(1).(*array.StringBuilder)
+	itemPoints := item.FieldBuilder(2).(*array.ListBuilder)
+	itemPoint := itemPoints.ValueBuilder().(*array.Int32Builder)
+	timestamp := func(s string) arrow.Timestamp {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return arrow.Timestamp(t.UnixNano())
+	}
+
+	// row 1
+	id.Append(1)
+	name.Append("alpha")
+	price.Append(decimal128.FromI64(1230))
+	ts.Append(timestamp("2020-02-29T12:34:56.789Z"))
+	day.Append(arrow.Date32(18321))
+	flag.Append(true)
+	ratio.Append(0.5)
+	tags.Append(true)
+	tag.Append("a")
+	tag.Append("b")
+	scores.Append(true)
+	scoreKey.Append("x")
+	scoreValue.Append(1)
+	scoreKey.Append("y")
+	scoreValue.AppendNull()
+	item.Append(true)
+	itemX.Append(10)
+	itemName.Append("n")
+	itemPoints.Append(true)
+	itemPoint.Append(1)
+	itemPoint.Append(2)
+
+	// row 2
+	id.Append(2)
+	name.AppendNull()
+	price.AppendNull()
+	ts.AppendNull()
+	day.AppendNull()
+	flag.Append(false)
+	ratio.AppendNull()
+	tags.Append(true)
+	scores.AppendNull()
+	item.AppendNull()
+
+	// row 3
+	id.Append(3)
+	name.Append("alpha")
+	price.Append(decimal128.FromI64(-5))
+	ts.Append(timestamp("1970-01-01T00:00:00Z"))
+	day.Append(arrow.Date32(0))
+	flag.AppendNull()
+	ratio.Append(-1.25)
+	tags.AppendNull()
+	scores.Append(true)
+	item.Append(true)
+	itemX.AppendNull()
+	itemName.Append("m")
+	itemPoints.AppendNull()
+
+	// row 4
+	id.Append(4)
+	name.Append("beta")
+	price.Append(decimal128.FromI64(123456789))
+	ts.Append(timestamp("2021-12-31T23:59:59.999999Z"))
+	day.Append(arrow.Date32(18992))
+	flag.Append(true)
+	ratio.Append(1e10)
+	tags.Append(true)
+	tag.AppendNull()
+	tag.Append("c")
+	scores.Append(true)
+	scoreKey.Append("z")
+	scoreValue.Append(3)
+	item.Append(true)
+	itemX.Append(30)
+	itemName.AppendNull()
+	itemPoints.Append(true)
+
+	return b.NewRecord()
+}
+
+func write(path string, props ...parquet.WriterProperty) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	rec := record()
+	defer rec.Release()
+	table := array.NewTableFromRecords(schema, []arrow.Record{rec})
+	defer table.Release()
+	props = append(props, parquet.WithCreatedBy("athenadriver testdata"))
+	err = pqarrow.WriteTable(table, f, 2, parquet.NewWriterProperties(props...),
+		pqarrow.NewArrowWriterProperties(pqarrow.WithDeprecatedInt96Timestamps(true)))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	// GZIP, dictionary pages and DataPage v1, the defaults of the UNLOAD files
+	write("gzip_dictionary_v1.parquet",
+		parquet.WithCompression(compress.Codecs.Gzip),
+		parquet.WithDictionaryDefault(true),
+		parquet.WithDataPageVersion(parquet.DataPageV1))
+	// GZIP, dictionary pages and DataPage v2
+	write("gzip_dictionary_v2.parquet",
+		parquet.WithCompression(compress.Codecs.Gzip),
+		parquet.WithDictionaryDefault(true),
+		parquet.WithDataPageVersion(parquet.DataPageV2))
+	// no compression, plain encoding, DataPage v2 and decimals as integers
+	write("plain_v2.parquet",
+		parquet.WithCompression(compress.Codecs.Uncompressed),
+		parquet.WithDictionaryDefault(false),
+		parquet.WithDataPageVersion(parquet.DataPageV2),
+		parquet.WithStoreDecimalAsInteger(true))
+}
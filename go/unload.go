@@ -0,0 +1,405 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+)
+
+// S3Store is an S3Reader which can also list and delete objects. ResultModeUnload needs one to read the files
+// written by UNLOAD, and to remove them afterwards. The S3Reader created by NewS3Reader is an S3Store.
+type S3Store interface {
+	S3Reader
+
+	// List returns the keys of the objects under prefix.
+	List(ctx context.Context, bucket string, prefix string) ([]string, error)
+
+	// Delete removes objects.
+	Delete(ctx context.Context, bucket string, keys []string) error
+}
+
+// List returns the keys of the objects under prefix.
+func (s *s3Reader) List(ctx context.Context, bucket string, prefix string) ([]string, error) {
+	var keys []string
+	err := s.s3API.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	return keys, err
+}
+
+// Delete removes objects, up to 1000 in a request.
+func (s *s3Reader) Delete(ctx context.Context, bucket string, keys []string) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > 1000 {
+			n = 1000
+		}
+		objects := make([]*s3.ObjectIdentifier, n)
+		for i, key := range keys[:n] {
+			objects[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+		}
+		_, err := s.s3API.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// unloadKey marks the context of a query whose result is written to S3 by UNLOAD.
+const unloadKey TContextKey = "unload"
+
+// withUnload returns a copy of ctx which runs query with UNLOAD, if Config asks for ResultModeUnload and the query
+// is a SELECT. Otherwise it returns ctx.
+func (c *Connection) withUnload(ctx context.Context, query string) context.Context {
+	if c.connector.config.GetResultMode() != ResultModeUnload || !isUnloadableQuery(query) {
+		return ctx
+	}
+	if _, ok := c.s3Reader.(S3Store); !ok {
+		c.connector.tracer.Log(WarnLevel, "result mode unload needs an S3Store to read the query result")
+		return ctx
+	}
+	return context.WithValue(ctx, unloadKey, true)
+}
+
+// valuesContext is a context with the values of another context, which is used to run a query again with the
+// values of the context it was submitted with, and the deadline and cancellation of the current one.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+// Value returns the value of key in the other context.
+func (v valuesContext) Value(key interface{}) interface{} {
+	return v.values.Value(key)
+}
+
+// orderByPattern matches an ORDER BY clause.
+var orderByPattern = regexp.MustCompile(`(?i)\border\s+by\b`)
+
+// isUnloadableQuery is to check if a query is a SELECT, which UNLOAD can run. A query which orders its result
+// isn't unloaded, because UNLOAD writes the rows to several files in parallel, and their order isn't kept.
+func isUnloadableQuery(query string) bool {
+	nQuery := strings.TrimSpace(strings.ToLower(query))
+	if !strings.HasPrefix(nQuery, "select") && !strings.HasPrefix(nQuery, "with") {
+		return false
+	}
+	return !hasTopLevelOrderBy(query)
+}
+
+// hasTopLevelOrderBy is to check if query has an ORDER BY out of parentheses, which orders its result rather than
+// the rows of a subquery, a window or an aggregation.
+func hasTopLevelOrderBy(query string) bool {
+	var b strings.Builder
+	depth := 0
+	for _, t := range lexSQL(query) {
+		if t.kind != sqlCode {
+			b.WriteByte(' ')
+			continue
+		}
+		for i := t.start; i < t.end; i++ {
+			switch query[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				b.WriteByte(' ')
+				continue
+			}
+			if depth == 0 {
+				b.WriteByte(query[i])
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	return orderByPattern.MatchString(b.String())
+}
+
+// unloadLocation returns the S3 location UNLOAD writes the result of a query to. Every submission has a
+// location of its own, because UNLOAD fails if there is anything in it. A query submitted again with the same
+// ClientRequestToken isn't run again, so it has the same location, whose files may be removed already.
+func unloadLocation(config *Config, clientRequestToken string) string {
+	return strings.TrimSuffix(config.GetOutputBucket(), "/") + "/tmp/" +
+		ClientRequestTokenOf(clientRequestToken, "unload")[:32] + "/"
+}
+
+// unloadQuery wraps a query with UNLOAD, to write its result to location as GZIP compressed Parquet files.
+func unloadQuery(query string, location string) string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	// the line breaks keep a trailing line comment from commenting out the closing parenthesis
+	return "UNLOAD (\n" + query + "\n) TO '" + location + "' WITH (format = 'PARQUET', compression = 'GZIP')"
+}
+
+// unloadResult reads the rows of the Parquet files written by UNLOAD, a row group at a time.
+type unloadResult struct {
+	ctx        context.Context
+	store      S3Store
+	bucket     string
+	keys       []string
+	numColumns int
+	nextFile   int
+	file       *parquetFile
+	fileKey    string
+	nextRG     int
+	columns    [][]interface{}
+	row        int64
+	numRows    int64
+}
+
+// next is to move to the next row. It returns io.EOF after the last row.
+func (u *unloadResult) next() error {
+	u.row++
+	for u.row >= u.numRows {
+		if u.file == nil || u.nextRG >= len(u.file.rowGroups) {
+			if u.nextFile >= len(u.keys) {
+				return io.EOF
+			}
+			file, err := readParquetFile(u.ctx, u.store, u.bucket, u.keys[u.nextFile])
+			if err != nil {
+				return err
+			}
+			if u.file != nil && len(file.fields) != u.numColumns {
+				return ErrParquet
+			}
+			u.numColumns = len(file.fields)
+			u.file, u.fileKey, u.nextRG = file, u.keys[u.nextFile], 0
+			u.nextFile++
+			continue
+		}
+		if err := u.readRowGroup(u.file.rowGroups[u.nextRG]); err != nil {
+			return err
+		}
+		u.nextRG++
+	}
+	return nil
+}
+
+// readRowGroup is to read and decode the column chunks of a row group in parallel, and assemble the values of the
+// result columns from them.
+func (u *unloadResult) readRowGroup(rowGroup parquetRowGroup) error {
+	columns := make([]*parquetColumnValues, len(rowGroup.chunks))
+	errs := make([]error, len(rowGroup.chunks))
+	var wg sync.WaitGroup
+	for i, chunk := range rowGroup.chunks {
+		wg.Add(1)
+		go func(i int, chunk parquetColumnChunk) {
+			defer wg.Done()
+			data, err := u.store.ReadRange(u.ctx, u.bucket, u.fileKey, chunk.offset, chunk.size)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			columns[i], errs[i] = u.file.columns[i].decodeColumnChunk(data, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	values, err := u.file.assemble(columns, rowGroup.numRows)
+	if err != nil {
+		return err
+	}
+	u.columns, u.row, u.numRows = values, 0, rowGroup.numRows
+	return nil
+}
+
+// cleanup is to remove the files written by UNLOAD.
+func (u *unloadResult) cleanup() error {
+	if len(u.keys) == 0 {
+		return nil
+	}
+	return u.store.Delete(context.Background(), u.bucket, u.keys)
+}
+
+// newUnloadRows is to create a Rows which reads the Parquet files written by UNLOAD to location. The files are
+// removed when the rows are closed.
+func newUnloadRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, store S3Store, location string,
+	execution *athena.QueryExecution, driverConfig *Config, obs *DriverTracer) (*Rows, error) {
+	queryID := aws.StringValue(execution.QueryExecutionId)
+	bucket, prefix, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.List(ctx, bucket, prefix)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.unloadrows.list").Inc(1)
+		obs.Log(ErrorLevel, "listing UNLOAD result failed", zap.String("queryID", queryID),
+			zap.String("location", location), zap.String("error", err.Error()))
+		return nil, err
+	}
+	sort.Strings(keys)
+	u := &unloadResult{
+		ctx:    ctx,
+		store:  store,
+		bucket: bucket,
+		keys:   keys,
+		row:    -1,
+	}
+	columns := []*athena.ColumnInfo{}
+	if len(keys) > 0 {
+		if u.file, err = readParquetFile(ctx, store, bucket, keys[0]); err != nil {
+			obs.Scope().Counter(DriverName + ".failure.unloadrows.read").Inc(1)
+			obs.Log(ErrorLevel, "reading UNLOAD result failed", zap.String("queryID", queryID),
+				zap.String("location", location), zap.String("error", err.Error()))
+			_ = u.cleanup()
+			return nil, err
+		}
+		u.fileKey, u.nextFile, u.numColumns = keys[0], 1, len(u.file.fields)
+		for _, field := range u.file.fields {
+			columns = append(columns, u.file.columnInfo(field))
+		}
+	} else {
+		// UNLOAD writes no file for an empty result, so the columns come from GetQueryResults.
+		metadata, err := athenaAPI.GetQueryResultsWithContext(ctx, &athena.GetQueryResultsInput{
+			QueryExecutionId: aws.String(queryID),
+			MaxResults:       aws.Int64(1),
+		})
+		if err != nil {
+			obs.Scope().Counter(DriverName + ".failure.unloadrows.getqueryresults").Inc(1)
+			obs.Log(ErrorLevel, "GetQueryResults failed", zap.String("queryID", queryID),
+				zap.String("error", err.Error()))
+			return nil, err
+		}
+		if metadata.ResultSet != nil && metadata.ResultSet.ResultSetMetadata != nil {
+			columns = metadata.ResultSet.ResultSetMetadata.ColumnInfo
+		}
+	}
+	obs.Scope().Counter(DriverName + ".unloadrows").Inc(1)
+	return &Rows{
+		athena:  athenaAPI,
+		ctx:     ctx,
+		queryID: queryID,
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{
+				ResultSetMetadata: &athena.ResultSetMetadata{ColumnInfo: columns},
+			},
+		},
+		config:         driverConfig,
+		tracer:         obs,
+		queryExecution: execution,
+		unload:         u,
+		nativeTypes:    true,
+	}, nil
+}
+
+// nextUnloadRow is to read the next row of the Parquet files written by UNLOAD. The values already have their
+// Go types, and only column masking, decimals, complex values and missing values are handled like in
+// athenaTypeToGoType.
+func (r *Rows) nextUnloadRow(dest []driver.Value) error {
+	if err := r.unload.next(); err == io.EOF {
+		r.reachedLastPage = true
+		return io.EOF
+	} else if err != nil {
+		r.tracer.Scope().Counter(DriverName + ".failure.unloadrows.read").Inc(1)
+		r.tracer.Log(ErrorLevel, "reading UNLOAD result failed", zap.String("queryID", r.queryID),
+			zap.String("error", err.Error()))
+		return err
+	}
+	columns := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
+	for i, column := range columns {
+		value := r.unload.columns[i][r.unload.row]
+		if maskedValue, masked := r.config.CheckColumnMasked(*column.Name); masked {
+			value = maskedValue
+		} else if value == nil {
+			var err error
+			if value, err = r.athenaTypeToGoType(column, nil, r.config); err != nil {
+				return err
+			}
+		} else if d, ok := value.(Decimal); ok {
+			// like in Rows.columnValue
+			value = d.String()
+		} else {
+			value = r.unloadValue(value)
+		}
+		dest[i] = value
+	}
+	return nil
+}
+
+// unloadValue is to convert a value read from the files written by UNLOAD to the value returned with Config.
+// Decimals in ARRAY, MAP and ROW values are strings unless they are exact, and ARRAY, MAP and ROW values are their text rendering unless they
+// are decoded.
+func (r *Rows) unloadValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Decimal:
+		if !r.config.IsExactDecimal() {
+			return v.String()
+		}
+	case []interface{}:
+		if !r.config.IsDecodeComplexTypes() {
+			return formatComplexValue(v)
+		}
+		for i := range v {
+			v[i] = r.unloadValue(v[i])
+		}
+	case map[string]interface{}:
+		if !r.config.IsDecodeComplexTypes() {
+			return formatComplexValue(v)
+		}
+		for k := range v {
+			v[k] = r.unloadValue(v[k])
+		}
+	case RowValue:
+		if !r.config.IsDecodeComplexTypes() {
+			return formatComplexValue(v)
+		}
+		for i := range v {
+			v[i].Value = r.unloadValue(v[i].Value)
+		}
+	}
+	return value
+}
+
+// closeUnload is to remove the files written by UNLOAD once the rows are closed.
+func (r *Rows) closeUnload() {
+	if err := r.unload.cleanup(); err != nil {
+		r.tracer.Scope().Counter(DriverName + ".failure.unloadrows.cleanup").Inc(1)
+		r.tracer.Log(WarnLevel, "removing UNLOAD result failed", zap.String("queryID", r.queryID),
+			zap.String("error", err.Error()))
+	}
+	r.unload = nil
+}
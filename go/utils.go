@@ -29,6 +29,7 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -64,6 +65,31 @@ func scanNullString(v interface{}) (sql.NullString, error) {
 	return sql.NullString{Valid: true, String: vv}, nil
 }
 
+// textCell is a cell of a row printed as text. It scans the values like *[]byte does, and also the values which
+// database/sql can't convert to []byte, e.g. Decimal and decoded ARRAY values.
+type textCell []byte
+
+// Scan is to implement interface sql.Scanner.
+func (c *textCell) Scan(src interface{}) error {
+	switch src.(type) {
+	case []interface{}, map[string]interface{}, RowValue:
+		*c = textCell(formatComplexValue(src))
+		return nil
+	}
+	if v, ok := src.(driver.Valuer); ok {
+		var err error
+		if src, err = v.Value(); err != nil {
+			return err
+		}
+	}
+	var s sql.NullString
+	if err := s.Scan(src); err != nil {
+		return err
+	}
+	*c = textCell(s.String)
+	return nil
+}
+
 func mockRowsToSQLRows(mockRows *sqlmock.Rows) *sql.Rows {
 	db, mock, _ := sqlmock.New()
 	mock.ExpectQuery("SELECT_OK").WillReturnRows(mockRows)
@@ -99,7 +125,7 @@ func RowsToCSV(rows *sql.Rows) string {
 	csvWriter := csv.NewWriter(&buf)
 	records := make([][]string, 0)
 	for rows.Next() {
-		rawResult := make([][]byte, len(columns))
+		rawResult := make([]textCell, len(columns))
 		row := make([]interface{}, len(columns))
 		for i := range rawResult {
 			row[i] = &rawResult[i] // pointers to each string in the interface slice
@@ -186,7 +212,7 @@ func PrettyPrintSQLRows(rows *sql.Rows, style string, render string, page int) {
 	}
 	columns, _ := rows.Columns()
 	for rows.Next() {
-		rawResult := make([][]byte, len(columns))
+		rawResult := make([]textCell, len(columns))
 		row := make([]interface{}, len(columns))
 		for i := range rawResult {
 			row[i] = &rawResult[i] // pointers to each string in the interface slice
@@ -220,7 +246,7 @@ func PrettyPrintSQLColsRows(rows *sql.Rows, style string, render string, page in
 		t.AppendHeader(myrow)
 	}
 	for rows.Next() {
-		rawResult := make([][]byte, len(columns))
+		rawResult := make([]textCell, len(columns))
 		row := make([]interface{}, len(columns))
 		for i := range rawResult {
 			row[i] = &rawResult[i] // pointers to each string in the interface slice
@@ -589,62 +615,96 @@ func newRandomHeaderlessResultPage(columns []*athena.ColumnInfo, nextToken *stri
 	}
 }
 
-// escapeBytesBackslash escapes []byte with backslashes (\)
-// This escapes the contents of a string (provided as []byte) by adding backslashes before special
-// characters, and turning others into specific escape sequences, such as
-// turning newlines into \n and null bytes into \0.
-//
-// \xNN notation to define a string constant holding some peculiar byte values.
-// (Of course, bytes range from hexadecimal values 00 through FF, inclusive.)
-func escapeBytesBackslash(buf, v []byte) []byte {
+// escapeBytesQuote escapes []byte for a single-quoted Athena string literal.
+// Athena's engine doesn't interpret backslash escape sequences, so the only character that needs escaping is the
+// single quote, which is escaped by adding another single quote. Other bytes, including newlines, backslashes and
+// double quotes, are kept as they are.
+// https://docs.aws.amazon.com/athena/latest/ug/select.html#select-escaping
+// https://trino.io/docs/current/language/types.html#varchar
+func escapeBytesQuote(buf, v []byte) []byte {
 	pos := len(buf)
 	buf = reserveBuffer(buf, len(v)*2)
 
 	for _, c := range v {
-		switch c {
-		case '\x00':
-			buf[pos] = '\\'
-			buf[pos+1] = '0'
-			pos += 2
-		case '\n':
-			buf[pos] = '\\'
-			buf[pos+1] = 'n'
-			pos += 2
-		case '\r':
-			buf[pos] = '\\'
-			buf[pos+1] = 'r'
-			pos += 2
-		case '\x1a':
-			buf[pos] = '\\'
-			buf[pos+1] = 'Z'
-			pos += 2
-		case '\'':
-			// Single quotes can be escaped by adding another single quote.
-			// https://docs.aws.amazon.com/athena/latest/ug/select.html
-			// https://docs.aws.amazon.com/athena/latest/ug/data-types.html#data-types-considerations
+		if c == '\'' {
 			buf[pos] = '\''
-			buf[pos+1] = '\''
-			pos += 2
-		case '"':
-			buf[pos] = '\\'
-			buf[pos+1] = '"'
-			pos += 2
-		case '\\':
-			buf[pos] = '\\'
-			buf[pos+1] = '\\'
-			pos += 2
-		default:
-			buf[pos] = c
 			pos++
 		}
+		buf[pos] = c
+		pos++
 	}
 
 	return buf[:pos]
 }
 
-// escapeStringBackslash is similar to escapeBytesBackslash but for string.
-func escapeStringBackslash(buf []byte, v string) []byte {
-	return escapeBytesBackslash(buf, []byte(v))
+// escapeStringQuote is similar to escapeBytesQuote but for string.
+func escapeStringQuote(buf []byte, v string) []byte {
+	return escapeBytesQuote(buf, []byte(v))
+}
+
+// appendHexBytes appends v as a varbinary literal, X'0A1B'.
+// https://trino.io/docs/current/language/types.html#varbinary
+func appendHexBytes(buf, v []byte) []byte {
+	const hexDigits = "0123456789ABCDEF"
+	buf = append(buf, "X'"...)
+	for _, c := range v {
+		buf = append(buf, hexDigits[c>>4], hexDigits[c&0x0f])
+	}
+	return append(buf, '\'')
+}
+
+// appendTimestamp appends v as a TIMESTAMP literal in UTC, rounded to milliseconds, which is the precision of Athena
+// timestamps.
+// https://docs.aws.amazon.com/athena/latest/ug/data-types.html
+func appendTimestamp(buf []byte, v time.Time) []byte {
+	v = v.In(time.UTC).Add(time.Microsecond * 500) // To round to milliseconds
+	buf = append(buf, "TIMESTAMP '"...)
+	buf = v.AppendFormat(buf, timestampFormatDriver)
+	return append(buf, '\'')
+}
+
+// appendSQLLiteral appends the Athena SQL literal of a query argument to buf.
+func appendSQLLiteral(buf []byte, arg driver.Value) ([]byte, error) {
+	// type switches of arg to handle different query parameter types
+	switch v := arg.(type) {
+	case nil:
+		buf = append(buf, "NULL"...)
+	case int64:
+		buf = strconv.AppendInt(buf, v, 10)
+	case uint64:
+		buf = strconv.AppendUint(buf, v, 10)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			buf = append(buf, "nan()"...)
+		case math.IsInf(v, 1):
+			buf = append(buf, "infinity()"...)
+		case math.IsInf(v, -1):
+			buf = append(buf, "-infinity()"...)
+		default:
+			buf = strconv.AppendFloat(buf, v, 'g', -1, 64)
+		}
+	case bool:
+		buf = strconv.AppendBool(buf, v)
+	case time.Time:
+		buf = appendTimestamp(buf, v)
+	case Decimal:
+		buf = append(buf, "DECIMAL '"...)
+		buf = append(buf, v.String()...)
+		buf = append(buf, '\'')
+	case []byte:
+		buf = appendHexBytes(buf, v)
+	case string:
+		buf = append(buf, '\'')
+		buf = escapeStringQuote(buf, v)
+		buf = append(buf, '\'')
+	default:
+		if isCompositeValue(v) {
+			return appendCompositeLiteral(buf, reflect.ValueOf(v))
+		}
+		return buf, ErrQueryUnknownType
+	}
+	return buf, nil
 }
 
 // reserveBuffer checks cap(buf) and expand buffer to len(buf) + appendSize.
@@ -732,7 +792,9 @@ func printCost(o *athena.GetQueryExecutionOutput) {
 		return
 	}
 	dataScannedBytes := o.QueryExecution.Statistics.DataScannedInBytes
-	if dataScannedBytes == nil {
+	if isResultReused(o.QueryExecution) {
+		println("query cost: 0.0 USD, scanned data: 0 B, qid: " + *o.QueryExecution.QueryExecutionId + " (reused result)")
+	} else if dataScannedBytes == nil {
 		println("query cost: 0.0 USD, scanned data: 0 B, qid: NA")
 	} else if *dataScannedBytes == 0 {
 		println("query cost: 0.0 USD, scanned data: 0 B, qid: " + *o.QueryExecution.QueryExecutionId)
@@ -771,17 +833,30 @@ var qIDPattern = regexp.MustCompile(`^[0-9a-f-]{36}$`)
 // https://regoio.herokuapp.com/
 // https://golang.org/pkg/regexp/syntax/
 func GetTableNamesInQuery(query string) map[string]bool {
+	return GetTableNamesInQueryWithCatalog(query, "")
+}
+
+// GetTableNamesInQueryWithCatalog is like GetTableNamesInQuery, but returns tables in format of CATALOG.DB.TABLE,
+// where catalog is the catalog of tables not qualified with one, like Config.GetCatalog(). If catalog is empty,
+// only the tables qualified with a catalog in query have one.
+func GetTableNamesInQueryWithCatalog(query string, catalog string) map[string]bool {
 	query = multiLineCommentPattern.ReplaceAllString(query, "")
 	query = oneLineCommentPattern.ReplaceAllString(query, "")
 	matchedResults := getTableNamePattern.FindAllStringSubmatch(query, -1)
 	tables := map[string]bool{}
 	for _, matchedTableName := range matchedResults {
 		if len(matchedTableName) == 2 {
-			if strings.IndexByte(matchedTableName[1], '.') == -1 {
-				tables[DefaultDBName+"."+matchedTableName[1]] = true
-			} else {
-				tables[matchedTableName[1]] = true
+			tableName := matchedTableName[1]
+			switch strings.Count(tableName, ".") {
+			case 0:
+				tableName = DefaultDBName + "." + tableName
+				fallthrough
+			case 1:
+				if catalog != "" {
+					tableName = catalog + "." + tableName
+				}
 			}
+			tables[tableName] = true
 		}
 	}
 	return tables
@@ -811,7 +886,7 @@ func IsQID(q string) bool {
 	return qIDPattern.MatchString(q)
 }
 
-// FormatString formats a string type query argument for Athena by escaping special characters and surrounding the
+// FormatString formats a string type query argument for Athena by escaping single quotes and surrounding the
 // string with single quotes. Using FormatString allows for selective formatting of the query argument, if
 // typecasting or function calls are part of the query argument.
 //
@@ -823,14 +898,12 @@ func IsQID(q string) bool {
 //		 aws.String(fmt.Sprintf("TIMESTAMP %s", athenadriver.FormatString("2024-07-01 00:00:00")))
 //	}
 func FormatString(v string) string {
-	return fmt.Sprintf("'%s'", escapeBytesBackslash([]byte{}, []byte(v)))
+	return fmt.Sprintf("'%s'", escapeStringQuote([]byte{}, v))
 }
 
-// FormatBytes formats a byte slice query argument for Athena by escaping special characters and surrounding it with
-// single quotes.
+// FormatBytes formats a byte slice as an Athena varbinary literal, X'0A1B'. A []byte query argument is formatted the
+// same way, so FormatBytes is only needed to build a string query argument with function calls, like
+// `from_utf8(X'0A1B')`.
 func FormatBytes(v []byte) []byte {
-	buf := append([]byte{}, "_binary'"...)
-	buf = escapeBytesBackslash(buf, v)
-	buf = append(buf, '\'')
-	return buf
+	return appendHexBytes([]byte{}, v)
 }
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
 )
@@ -225,33 +226,58 @@ func TestIsQueryTimeOut(t *testing.T) {
 	assert.True(t, isQueryTimeOut(OneHourAgo, "UNKNOWN", testConf))
 }
 
-func TestEscapeBytesBackslash(t *testing.T) {
-	r := escapeBytesBackslash([]byte{}, []byte{'\x00'})
-	assert.Equal(t, string(r), "\\0")
-
-	r = escapeBytesBackslash([]byte{}, []byte{'\n'})
-	assert.Equal(t, string(r), "\\n")
-
-	r = escapeBytesBackslash([]byte{}, []byte{'\r'})
-	assert.Equal(t, string(r), "\\r")
-
-	r = escapeBytesBackslash([]byte{}, []byte{'\x1a'})
-	assert.Equal(t, string(r), "\\Z")
-
+func TestEscapeBytesQuote(t *testing.T) {
 	// Single quotes can be escaped by adding another single quote.
 	// https://docs.aws.amazon.com/athena/latest/ug/select.html#select-escaping
 	// https://docs.aws.amazon.com/athena/latest/ug/data-types.html#data-types-considerations
-	r = escapeBytesBackslash([]byte{}, []byte{'\''})
-	assert.Equal(t, string(r), `''`)
+	r := escapeBytesQuote([]byte{}, []byte{'\''})
+	assert.Equal(t, `''`, string(r))
+
+	// Athena doesn't interpret backslash escape sequences, so nothing else is escaped.
+	for _, c := range []byte{'\x00', '\n', '\r', '\x1a', '"', '\\', 'x'} {
+		r = escapeBytesQuote([]byte{}, []byte{c})
+		assert.Equal(t, string([]byte{c}), string(r))
+	}
 
-	r = escapeBytesBackslash([]byte{}, []byte{'"'})
-	assert.Equal(t, string(r), `\"`)
+	r = escapeStringQuote([]byte("'"), `it's a \'path\'`)
+	assert.Equal(t, `'it''s a \''path\''`, string(r))
+}
 
-	r = escapeBytesBackslash([]byte{}, []byte{'\\'})
-	assert.Equal(t, string(r), `\\`)
+func TestAppendSQLLiteral(t *testing.T) {
+	testTime, err := time.Parse(time.RFC3339Nano, "2024-07-02T01:02:03.123456+02:00")
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		arg      driver.Value
+		expected string
+	}{
+		{nil, "NULL"},
+		{int64(-10), "-10"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{1.5, "1.5"},
+		{1e21, "1e+21"},
+		{math.NaN(), "nan()"},
+		{math.Inf(1), "infinity()"},
+		{math.Inf(-1), "-infinity()"},
+		{true, "true"},
+		{false, "false"},
+		{testTime, "TIMESTAMP '2024-07-01 23:02:03.123'"},
+		{testTime.Add(time.Microsecond * 500), "TIMESTAMP '2024-07-01 23:02:03.124'"},
+		{time.Time{}, "TIMESTAMP '0001-01-01 00:00:00.000'"},
+		{[]byte{}, "X''"},
+		{[]byte{0x00, 0x0a, 0xff, 'A'}, "X'000AFF41'"},
+		{"", "''"},
+		{"it's\na \\n", "'it''s\na \\n'"},
+	}
+	for _, tc := range testCases {
+		r, err := appendSQLLiteral([]byte{}, tc.arg)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, string(r))
+	}
 
-	r = escapeBytesBackslash([]byte{}, []byte{'x'})
-	assert.Equal(t, string(r), `x`)
+	r, err := appendSQLLiteral([]byte("x"), 1)
+	assert.Equal(t, ErrQueryUnknownType, err)
+	assert.Equal(t, "x", string(r))
 }
 
 func TestGetFromEnvVal(t *testing.T) {
@@ -301,6 +327,11 @@ func TestPrintCost(t *testing.T) {
 	cost = int64(0)
 	o.QueryExecution.Statistics.DataScannedInBytes = &cost
 	printCost(o)
+	cost = int64(12345678123456)
+	o.QueryExecution.Statistics.ResultReuseInformation = &athena.ResultReuseInformation{
+		ReusedPreviousResult: aws.Bool(true),
+	}
+	printCost(o)
 }
 
 func TestUilts_GetTableNamesInQuery(t *testing.T) {
@@ -485,9 +516,9 @@ func TestFormatString(t *testing.T) {
 			expected: "'This is a description string with no special characters'",
 		},
 		{
-			name:     "Special characters are escaped",
+			name:     "Only single quotes are escaped",
 			input:    "Athena's query's param\n",
-			expected: "'Athena''s query''s param\\n'",
+			expected: "'Athena''s query''s param\n'",
 		},
 	}
 	for _, tc := range testCases {
@@ -506,17 +537,17 @@ func TestFormatBytes(t *testing.T) {
 		{
 			name:     "Empty byte slice",
 			input:    []byte{},
-			expected: []byte("_binary''"),
+			expected: []byte("X''"),
 		},
 		{
 			name:     "No special characters",
-			input:    []byte("This is a description string with no special characters"),
-			expected: []byte("_binary'This is a description string with no special characters'"),
+			input:    []byte("This is a description"),
+			expected: []byte("X'546869732069732061206465736372697074696F6E'"),
 		},
 		{
-			name:     "Special characters are escaped",
-			input:    []byte("Athena's query's param\n"),
-			expected: []byte("_binary'Athena''s query''s param\\n'"),
+			name:     "Special characters are hex encoded",
+			input:    []byte("Athena's\n"),
+			expected: []byte("X'417468656E6127730A'"),
 		},
 	}
 	for _, tc := range testCases {
@@ -525,3 +556,17 @@ func TestFormatBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestUtils_GetTableNamesInQueryWithCatalog(t *testing.T) {
+	query := "SELECT * FROM abc JOIN sampledb.elb_logs ON a = b JOIN glue_catalog.db.t ON b = c"
+	assert.Equal(t, map[string]bool{
+		"default.abc":       true,
+		"sampledb.elb_logs": true,
+		"glue_catalog.db.t": true,
+	}, GetTableNamesInQuery(query))
+	assert.Equal(t, map[string]bool{
+		"lambda_catalog.default.abc":       true,
+		"lambda_catalog.sampledb.elb_logs": true,
+		"glue_catalog.db.t":                true,
+	}, GetTableNamesInQueryWithCatalog(query, "lambda_catalog"))
+}
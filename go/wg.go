@@ -24,6 +24,7 @@ import (
 	"context"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
 )
@@ -76,6 +77,12 @@ func getWG(ctx context.Context, athenaService athenaiface.AthenaAPI, Name string
 	return getWorkGroupOutput.WorkGroup, nil
 }
 
+// isWGNotFoundError is to check if the error of a GetWorkGroup call is because the workgroup doesn't exist.
+func isWGNotFoundError(err error) bool {
+	reqerr, ok := err.(awserr.RequestFailure)
+	return ok && reqerr.Message() == "WorkGroup is not found."
+}
+
 // CreateWGRemotely is to create a Workgroup remotely.
 func (w *Workgroup) CreateWGRemotely(athenaService athenaiface.AthenaAPI) error {
 	tags := w.Tags.Get()
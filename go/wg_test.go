@@ -24,6 +24,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,3 +78,16 @@ func TestWorkgroup_CreateWGRemotely2(t *testing.T) {
 	e = wg.CreateWGRemotely(athenaClient)
 	assert.Nil(t, e)
 }
+
+func TestWorkgroup_CreateWGRemotely_ResultConfiguration(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Nil(t, testConf.SetEncryption(athena.EncryptionOptionSseKms, "alias/k"))
+	testConf.SetExpectedBucketOwner("123456789012")
+	athenaClient := newMockAthenaClient()
+	athenaClient.CreateWGStatus = true
+	wg := testConf.GetWorkgroup()
+	wg.Name = "henry_wu"
+	assert.Nil(t, wg.CreateWGRemotely(athenaClient))
+	assert.Equal(t, testConf.GetResultConfiguration(),
+		athenaClient.createWorkGroupInput.Configuration.ResultConfiguration)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// workgroupCacheEntry is the result of a GetWorkGroup call cached by workgroupCache.
+type workgroupCacheEntry struct {
+	workgroup *athena.WorkGroup
+	err       error
+	expires   time.Time
+}
+
+// workgroupCache caches the workgroups got from AWS, so a query doesn't need a GetWorkGroup call before it starts.
+// A workgroup which doesn't exist or is disabled is cached for negativeTTL only, so it can be used shortly after
+// it is created or enabled. Other errors are never cached.
+type workgroupCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[string]workgroupCacheEntry
+}
+
+// newWorkgroupCache is to create a workgroupCache. Workgroups are not cached if ttl is not positive, and the errors
+// are not cached if negativeTTL is not positive.
+func newWorkgroupCache(ttl time.Duration, negativeTTL time.Duration) *workgroupCache {
+	return &workgroupCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]workgroupCacheEntry),
+	}
+}
+
+// get returns the cached workgroup or error, and false if there is none or it has expired.
+func (w *workgroupCache) get(name string) (workgroupCacheEntry, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry, ok := w.entries[name]
+	if !ok {
+		return workgroupCacheEntry{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(w.entries, name)
+		return workgroupCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// set caches the result of a GetWorkGroup call.
+func (w *workgroupCache) set(name string, workgroup *athena.WorkGroup, err error) {
+	ttl := w.ttl
+	if err != nil || workgroup == nil || aws.StringValue(workgroup.State) != athena.WorkGroupStateEnabled {
+		if err != nil && !isWGNotFoundError(err) {
+			return
+		}
+		ttl = w.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries[name] = workgroupCacheEntry{
+		workgroup: workgroup,
+		err:       err,
+		expires:   time.Now().Add(ttl),
+	}
+}
+
+// invalidate removes a workgroup from the cache, e.g. after it is created or changed.
+func (w *workgroupCache) invalidate(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.entries, name)
+}
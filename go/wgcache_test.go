@@ -0,0 +1,158 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+)
+
+func TestWorkgroupCache(t *testing.T) {
+	c := newWorkgroupCache(time.Hour, time.Hour)
+	_, ok := c.get("wg")
+	assert.False(t, ok)
+
+	enabled := &athena.WorkGroup{State: aws.String(athena.WorkGroupStateEnabled)}
+	c.set("wg", enabled, nil)
+	entry, ok := c.get("wg")
+	assert.True(t, ok)
+	assert.Equal(t, enabled, entry.workgroup)
+	assert.Nil(t, entry.err)
+
+	c.invalidate("wg")
+	_, ok = c.get("wg")
+	assert.False(t, ok)
+
+	notFound := awserr.NewRequestFailure(awserr.New(athena.ErrCodeInvalidRequestException,
+		"WorkGroup is not found.", nil), 400, "")
+	c.set("missing", nil, notFound)
+	entry, ok = c.get("missing")
+	assert.True(t, ok)
+	assert.Equal(t, notFound, entry.err)
+
+	// transient errors are never cached
+	c.set("throttled", nil, awserr.New(athena.ErrCodeTooManyRequestsException, "Rate exceeded", nil))
+	_, ok = c.get("throttled")
+	assert.False(t, ok)
+	c.set("failed", nil, ErrTestMockGeneric)
+	_, ok = c.get("failed")
+	assert.False(t, ok)
+}
+
+func TestWorkgroupCache_TTL(t *testing.T) {
+	c := newWorkgroupCache(time.Hour, time.Millisecond)
+	disabled := &athena.WorkGroup{State: aws.String(athena.WorkGroupStateDisabled)}
+	c.set("disabled", disabled, nil)
+	_, ok := c.get("disabled")
+	assert.True(t, ok)
+	time.Sleep(5 * time.Millisecond)
+	_, ok = c.get("disabled")
+	assert.False(t, ok)
+
+	c = newWorkgroupCache(0, time.Hour)
+	c.set("wg", &athena.WorkGroup{State: aws.String(athena.WorkGroupStateEnabled)}, nil)
+	_, ok = c.get("wg")
+	assert.False(t, ok)
+}
+
+func createWGCacheTestConnection(scope tally.Scope) (*Connection, *mockAthenaClient) {
+	c := createQueryHandleTestConnection()
+	_ = c.connector.config.SetWorkGroup(NewWG("analytics", nil, nil))
+	c.connector.tracer.SetScope(scope)
+	m := c.athenaAPI.(*mockAthenaClient)
+	m.GetWGStatus = true
+	return c, m
+}
+
+func TestConnection_WorkgroupCache(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	c, m := createWGCacheTestConnection(scope)
+	c.connector.config.SetMetrics(true)
+	for i := 0; i < 3; i++ {
+		_, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, m.getWorkGroupCalls)
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(1), counters[DriverName+".query.workgroup.cachemiss+"].Value())
+	assert.Equal(t, int64(2), counters[DriverName+".query.workgroup.cachehit+"].Value())
+
+	// the cache is shared by the queries with per-query settings
+	_, err := c.StartQuery(WithDatabase(context.Background(), "sales"), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, m.getWorkGroupCalls)
+
+	c.connector.InvalidateWorkgroup("analytics")
+	_, err = c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.getWorkGroupCalls)
+}
+
+func TestConnection_WorkgroupCache_Disabled(t *testing.T) {
+	c, m := createWGCacheTestConnection(tally.NoopScope)
+	m.WGDisabled = true
+	for i := 0; i < 2; i++ {
+		_, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+		assert.EqualError(t, err, `workgroup "analytics" is disabled`)
+	}
+	assert.Equal(t, 1, m.getWorkGroupCalls)
+
+	c, m = createWGCacheTestConnection(tally.NoopScope)
+	c.connector.config.SetWGCacheTTL(0)
+	for i := 0; i < 2; i++ {
+		_, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, m.getWorkGroupCalls)
+}
+
+func TestConnection_WorkgroupCache_NotFound(t *testing.T) {
+	c, m := createWGCacheTestConnection(tally.NoopScope)
+	m.WGNotFound = true
+	for i := 0; i < 2; i++ {
+		_, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 1, m.getWorkGroupCalls)
+
+	// the missing workgroup is checked again after it is created remotely
+	c, m = createWGCacheTestConnection(tally.NoopScope)
+	c.connector.config.SetWGRemoteCreationAllowed(true)
+	m.WGNotFound = true
+	m.CreateWGStatus = true
+	_, err := c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, m.createWorkGroupInput)
+	m.WGNotFound = false
+	_, err = c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.getWorkGroupCalls)
+	_, err = c.StartQuery(context.Background(), "SELECTQueryContext_OK", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.getWorkGroupCalls)
+}